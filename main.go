@@ -7,8 +7,10 @@ import (
 	"github.com/execd/task-store/pkg/rabbit"
 	"github.com/execd/task-store/pkg/redis"
 	"github.com/execd/task-store/pkg/route"
+	"github.com/execd/task-store/pkg/schedule"
 	"github.com/execd/task-store/pkg/task"
 	"github.com/execd/task-store/pkg/util"
+	"github.com/execd/task-store/pkg/workflow"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
@@ -25,14 +27,19 @@ func main() {
 	conf := parseConfig(configFile)
 
 	taskStore := initializeStore()
+	scheduleStore := initializeScheduleStore()
+	workflowStore := initializeWorkflowStore()
+	eventManager := initializeEventManager()
 
-	initializeAndLaunchManager(taskStore, conf)
+	initializeAndLaunchManager(taskStore, eventManager, conf)
+	initializeAndLaunchScheduler(scheduleStore, taskStore, conf)
+	initializeAndLaunchCallbackDeliverer(taskStore, conf)
 
-	router := initializeRouter(taskStore, conf)
+	router := initializeRouter(taskStore, scheduleStore, workflowStore, eventManager, conf)
 	log.Fatal(http.ListenAndServe("localhost:8080", router))
 }
 
-func initializeAndLaunchManager(taskStore task.Store, config *model.Config) {
+func initializeEventManager() task.EventManager {
 	rabbitMq, err := rabbit.NewRabbitMqImpl("amqp://localhost:5672")
 	if err != nil {
 		panic(err.Error())
@@ -41,31 +48,169 @@ func initializeAndLaunchManager(taskStore task.Store, config *model.Config) {
 	if err != nil {
 		panic(err.Error())
 	}
+	return eventManager
+}
 
+func initializeAndLaunchManager(taskStore task.Store, eventManager task.EventManager, config *model.Config) {
 	taskManager := manager.NewTaskManagerImpl(taskStore, eventManager, config)
 	quit := make(chan int)
 	taskManager.ManageTasks(quit)
 }
 
+func initializeAndLaunchScheduler(scheduleStore schedule.Store, taskStore task.Store, config *model.Config) {
+	scheduler := manager.NewSchedulerImpl(scheduleStore, taskStore, config)
+	quit := make(chan int)
+	scheduler.ScheduleTasks(quit)
+}
+
+func initializeAndLaunchCallbackDeliverer(taskStore task.Store, config *model.Config) {
+	deliverer := manager.NewCallbackDelivererImpl(taskStore, config)
+	quit := make(chan int)
+	deliverer.DeliverCallbacks(quit)
+}
+
 func initializeStore() task.Store {
 	redisDb := redis.NewClient("localhost:6379")
 	uuidGen := util.NewUUIDGenImpl()
-	return task.NewStoreImpl(redisDb, uuidGen)
+	return task.NewStoreImpl(redisDb, uuidGen).WithStatusFeed(task.NewRedisStatusFeed(redisDb))
+}
+
+func initializeScheduleStore() schedule.Store {
+	redisDb := redis.NewClient("localhost:6379")
+	uuidGen := util.NewUUIDGenImpl()
+	return schedule.NewStoreImpl(redisDb, uuidGen)
+}
+
+func initializeWorkflowStore() workflow.Store {
+	redisDb := redis.NewClient("localhost:6379")
+	uuidGen := util.NewUUIDGenImpl()
+	return workflow.NewStoreImpl(redisDb, uuidGen)
 }
 
-func initializeRouter(taskStore task.Store, config *model.Config) *mux.Router {
-	taskHandler := route.NewTaskHandlerImpl(taskStore, config)
+func initializeRouter(taskStore task.Store, scheduleStore schedule.Store, workflowStore workflow.Store,
+	eventManager task.EventManager, config *model.Config) *mux.Router {
+	taskHandler := route.NewTaskHandlerImpl(taskStore, eventManager, config)
+	scheduleHandler := route.NewScheduleHandlerImpl(scheduleStore, config)
+	workflowHandler := route.NewWorkflowHandlerImpl(taskStore, workflowStore, util.NewUUIDGenImpl(), config)
+	shareHandler := route.NewShareHandlerImpl(taskStore, config)
+	workerHandler := route.NewWorkerHandlerImpl(taskStore)
 	router := mux.NewRouter()
 
 	router.HandleFunc("/tasks/", taskHandler.CreateTask).Methods(http.MethodPost)
+	listTasksH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.ListTasks(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/", listTasksH).Methods(http.MethodGet)
+	router.HandleFunc("/tasks/batch", taskHandler.CreateTaskBatch).Methods(http.MethodPost)
+	watchTasksH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.WatchTasks(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/watch", watchTasksH).Methods(http.MethodGet)
 	getTaskH := func(w http.ResponseWriter, r *http.Request) {
 		taskHandler.GetTask(w, r, mux.Vars(r))
 	}
 	router.HandleFunc("/tasks/{id}", getTaskH).Methods(http.MethodGet)
+	cancelTaskH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.CancelTask(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/{id}", cancelTaskH).Methods(http.MethodDelete)
+	router.HandleFunc("/tasks/{id}/cancel", cancelTaskH).Methods(http.MethodPost)
+	renewLeaseH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.RenewLease(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/{id}/lease", renewLeaseH).Methods(http.MethodPost)
+	getTaskEventsH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.GetTaskEvents(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/{id}/events", getTaskEventsH).Methods(http.MethodGet)
+	getTaskInfoH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.GetTaskInfo(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/{id}/info", getTaskInfoH).Methods(http.MethodGet)
+	watchTaskH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.WatchTask(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/{id}/watch", watchTaskH).Methods(http.MethodGet)
+	getTaskCallbackH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.GetTaskCallback(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/tasks/{id}/callback", getTaskCallbackH).Methods(http.MethodGet)
+	listDeadCallbacksH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.ListDeadCallbacks(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/callbacks/dead", listDeadCallbacksH).Methods(http.MethodGet)
+	getQueueDepthH := func(w http.ResponseWriter, r *http.Request) {
+		taskHandler.GetQueueDepth(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/queue/priorities/{priority}", getQueueDepthH).Methods(http.MethodGet)
+
+	createTask := func(h *route.TaskHandlerImpl, w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		h.CreateTask(w, r)
+	}
+	createTaskBatch := func(h *route.TaskHandlerImpl, w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		h.CreateTaskBatch(w, r)
+	}
+	router.HandleFunc("/namespaces/{ns}/tasks/", inNamespace(taskHandler, createTask)).Methods(http.MethodPost)
+	router.HandleFunc("/namespaces/{ns}/tasks/", inNamespace(taskHandler, (*route.TaskHandlerImpl).ListTasks)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/tasks/batch", inNamespace(taskHandler, createTaskBatch)).Methods(http.MethodPost)
+	router.HandleFunc("/namespaces/{ns}/tasks/watch", inNamespace(taskHandler, (*route.TaskHandlerImpl).WatchTasks)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}", inNamespace(taskHandler, (*route.TaskHandlerImpl).GetTask)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}", inNamespace(taskHandler, (*route.TaskHandlerImpl).CancelTask)).Methods(http.MethodDelete)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}/cancel", inNamespace(taskHandler, (*route.TaskHandlerImpl).CancelTask)).Methods(http.MethodPost)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}/lease", inNamespace(taskHandler, (*route.TaskHandlerImpl).RenewLease)).Methods(http.MethodPost)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}/events", inNamespace(taskHandler, (*route.TaskHandlerImpl).GetTaskEvents)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}/info", inNamespace(taskHandler, (*route.TaskHandlerImpl).GetTaskInfo)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}/watch", inNamespace(taskHandler, (*route.TaskHandlerImpl).WatchTask)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/tasks/{id}/callback", inNamespace(taskHandler, (*route.TaskHandlerImpl).GetTaskCallback)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/callbacks/dead", inNamespace(taskHandler, (*route.TaskHandlerImpl).ListDeadCallbacks)).Methods(http.MethodGet)
+	router.HandleFunc("/namespaces/{ns}/queue/priorities/{priority}", inNamespace(taskHandler, (*route.TaskHandlerImpl).GetQueueDepth)).Methods(http.MethodGet)
+
+	router.HandleFunc("/shares", shareHandler.GetShares).Methods(http.MethodGet)
+
+	router.HandleFunc("/workers", workerHandler.ListWorkers).Methods(http.MethodGet)
+	registerWorkerH := func(w http.ResponseWriter, r *http.Request) {
+		workerHandler.RegisterWorker(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/workers/{id}", registerWorkerH).Methods(http.MethodPut)
+	heartbeatH := func(w http.ResponseWriter, r *http.Request) {
+		workerHandler.Heartbeat(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/workers/{id}/heartbeat", heartbeatH).Methods(http.MethodPost)
+
+	router.HandleFunc("/schedules/", scheduleHandler.CreateSchedule).Methods(http.MethodPost)
+	router.HandleFunc("/schedules/", scheduleHandler.ListSchedules).Methods(http.MethodGet)
+	getScheduleH := func(w http.ResponseWriter, r *http.Request) {
+		scheduleHandler.GetSchedule(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/schedules/{id}", getScheduleH).Methods(http.MethodGet)
+	deleteScheduleH := func(w http.ResponseWriter, r *http.Request) {
+		scheduleHandler.DeleteSchedule(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/schedules/{id}", deleteScheduleH).Methods(http.MethodDelete)
+
+	router.HandleFunc("/workflows/", workflowHandler.CreateWorkflow).Methods(http.MethodPost)
+	getWorkflowH := func(w http.ResponseWriter, r *http.Request) {
+		workflowHandler.GetWorkflow(w, r, mux.Vars(r))
+	}
+	router.HandleFunc("/workflows/{id}", getWorkflowH).Methods(http.MethodGet)
 
 	return router
 }
 
+// inNamespace : serve a task route against the namespace named in the request path
+func inNamespace(taskHandler *route.TaskHandlerImpl,
+	handle func(*route.TaskHandlerImpl, http.ResponseWriter, *http.Request, map[string]string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		handler, err := taskHandler.InNamespace(vars["ns"])
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		handle(handler, w, r, vars)
+	}
+}
+
 func parseConfig(path string) *model.Config {
 	parser := config.NewParserImpl()
 	return parser.ParseConfig(path)
@@ -3,6 +3,8 @@ package mocks
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/execd/task-store/pkg/model"
 
+import uuid "github.com/satori/go.uuid"
+
 // EventManager is an autogenerated mock type for the EventManager type
 type EventManager struct {
 	mock.Mock
@@ -33,6 +35,20 @@ func (_m *EventManager) ListenForProgress(quit <-chan int) (<-chan model.Info, <
 	return r0, r1
 }
 
+// PublishCancel provides a mock function with given fields: id
+func (_m *EventManager) PublishCancel(id *uuid.UUID) error {
+	ret := _m.Called(id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) error); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // PublishWork provides a mock function with given fields: _a0
 func (_m *EventManager) PublishWork(_a0 *model.Spec) error {
 	ret := _m.Called(_a0)
@@ -4,6 +4,7 @@ import "github.com/stretchr/testify/mock"
 import (
 	"github.com/NeowayLabs/wabbit"
 	"github.com/execd/task-store/pkg/model"
+	"github.com/satori/go.uuid"
 )
 
 // Rabbit is an autogenerated mock type for the Rabbit type
@@ -27,6 +28,20 @@ func (_m *Rabbit) GetTaskStatusQueueChan() <-chan wabbit.Delivery {
 	return r0
 }
 
+// PublishCancel provides a mock function with given fields: id
+func (_m *Rabbit) PublishCancel(id *uuid.UUID) error {
+	ret := _m.Called(id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) error); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // PublishWork provides a mock function with given fields: task
 func (_m *Rabbit) PublishWork(task *model.Spec) error {
 	ret := _m.Called(task)
@@ -0,0 +1,115 @@
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import model "github.com/execd/task-store/pkg/model"
+
+import uuid "github.com/satori/go.uuid"
+
+// ScheduleStore is an autogenerated mock type for the Store type
+type ScheduleStore struct {
+	mock.Mock
+}
+
+// DeleteSchedule provides a mock function with given fields: id
+func (_m *ScheduleStore) DeleteSchedule(id *uuid.UUID) (bool, error) {
+	ret := _m.Called(id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) bool); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSchedule provides a mock function with given fields: id
+func (_m *ScheduleStore) GetSchedule(id *uuid.UUID) (*model.Schedule, error) {
+	ret := _m.Called(id)
+
+	var r0 *model.Schedule
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Schedule); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Schedule)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSchedules provides a mock function with given fields:
+func (_m *ScheduleStore) ListSchedules() ([]*model.Schedule, error) {
+	ret := _m.Called()
+
+	var r0 []*model.Schedule
+	if rf, ok := ret.Get(0).(func() []*model.Schedule); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Schedule)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StoreSchedule provides a mock function with given fields: _a0
+func (_m *ScheduleStore) StoreSchedule(_a0 model.Schedule) (*uuid.UUID, error) {
+	ret := _m.Called(_a0)
+
+	var r0 *uuid.UUID
+	if rf, ok := ret.Get(0).(func(model.Schedule) *uuid.UUID); ok {
+		r0 = rf(_a0)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Schedule) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateSchedule provides a mock function with given fields: _a0
+func (_m *ScheduleStore) UpdateSchedule(_a0 *model.Schedule) error {
+	ret := _m.Called(_a0)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.Schedule) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
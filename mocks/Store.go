@@ -2,7 +2,9 @@ package mocks
 
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/execd/task-store/pkg/model"
+import task "github.com/execd/task-store/pkg/task"
 
+import time "time"
 import uuid "github.com/satori/go.uuid"
 
 // Store is an autogenerated mock type for the Store type
@@ -10,13 +12,807 @@ type Store struct {
 	mock.Mock
 }
 
-// AddTaskToExecutingSet provides a mock function with given fields: id
-func (_m *Store) AddTaskToExecutingSet(id *uuid.UUID) error {
+// AddTaskToExecutingSet provides a mock function with given fields: id, leaseUntil
+func (_m *Store) AddTaskToExecutingSet(id *uuid.UUID, leaseUntil time.Time) error {
+	ret := _m.Called(id, leaseUntil)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, time.Time) error); ok {
+		r0 = rf(id, leaseUntil)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BindIdempotencyKey provides a mock function with given fields: key, id, window
+func (_m *Store) BindIdempotencyKey(key string, id *uuid.UUID, window time.Duration) error {
+	ret := _m.Called(key, id, window)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *uuid.UUID, time.Duration) error); ok {
+		r0 = rf(key, id, window)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateTask provides a mock function with given fields: _a0, capacity, now
+func (_m *Store) CreateTask(_a0 model.Spec, capacity int64, now time.Time) (*task.CreatedTask, error) {
+	ret := _m.Called(_a0, capacity, now)
+
+	var r0 *task.CreatedTask
+	if rf, ok := ret.Get(0).(func(model.Spec, int64, time.Time) *task.CreatedTask); ok {
+		r0 = rf(_a0, capacity, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*task.CreatedTask)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Spec, int64, time.Time) error); ok {
+		r1 = rf(_a0, capacity, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateTasks provides a mock function with given fields: tasks, capacity, now
+func (_m *Store) CreateTasks(tasks []model.Spec, capacity int64, now time.Time) ([]*task.CreatedTask, error) {
+	ret := _m.Called(tasks, capacity, now)
+
+	var r0 []*task.CreatedTask
+	if rf, ok := ret.Get(0).(func([]model.Spec, int64, time.Time) []*task.CreatedTask); ok {
+		r0 = rf(tasks, capacity, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*task.CreatedTask)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]model.Spec, int64, time.Time) error); ok {
+		r1 = rf(tasks, capacity, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DelayTask provides a mock function with given fields: id, until
+func (_m *Store) DelayTask(id *uuid.UUID, until time.Time) error {
+	ret := _m.Called(id, until)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, time.Time) error); ok {
+		r0 = rf(id, until)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExecutingSetSize provides a mock function with given fields:
+func (_m *Store) ExecutingSetSize() (int64, error) {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCallback provides a mock function with given fields: id
+func (_m *Store) GetCallback(id *uuid.UUID) (*model.Callback, error) {
+	ret := _m.Called(id)
+
+	var r0 *model.Callback
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Callback); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Callback)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLease provides a mock function with given fields: id
+func (_m *Store) GetLease(id *uuid.UUID) (*model.Lease, error) {
+	ret := _m.Called(id)
+
+	var r0 *model.Lease
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Lease); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Lease)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMergedCallers provides a mock function with given fields: id
+func (_m *Store) GetMergedCallers(id *uuid.UUID) ([]*model.MergedCaller, error) {
+	ret := _m.Called(id)
+
+	var r0 []*model.MergedCaller
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) []*model.MergedCaller); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.MergedCaller)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPendingDependencies provides a mock function with given fields: id
+func (_m *Store) GetPendingDependencies(id *uuid.UUID) ([]*uuid.UUID, error) {
+	ret := _m.Called(id)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) []*uuid.UUID); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetResourceUsage provides a mock function with given fields:
+func (_m *Store) GetResourceUsage() (model.Resources, error) {
+	ret := _m.Called()
+
+	var r0 model.Resources
+	if rf, ok := ret.Get(0).(func() model.Resources); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(model.Resources)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTask provides a mock function with given fields: id
+func (_m *Store) GetTask(id *uuid.UUID) (*model.Spec, error) {
+	ret := _m.Called(id)
+
+	var r0 *model.Spec
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Spec); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Spec)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskAttempts provides a mock function with given fields: id
+func (_m *Store) GetTaskAttempts(id *uuid.UUID) ([]*model.Info, error) {
+	ret := _m.Called(id)
+
+	var r0 []*model.Info
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) []*model.Info); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Info)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskChildren provides a mock function with given fields: id
+func (_m *Store) GetTaskChildren(id *uuid.UUID) ([]*uuid.UUID, error) {
+	ret := _m.Called(id)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) []*uuid.UUID); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskDueTime provides a mock function with given fields: id
+func (_m *Store) GetTaskDueTime(id *uuid.UUID) (*time.Time, error) {
+	ret := _m.Called(id)
+
+	var r0 *time.Time
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *time.Time); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*time.Time)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskEvents provides a mock function with given fields: id
+func (_m *Store) GetTaskEvents(id *uuid.UUID) ([]*model.Event, error) {
+	ret := _m.Called(id)
+
+	var r0 []*model.Event
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) []*model.Event); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Event)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskInfo provides a mock function with given fields: id
+func (_m *Store) GetTaskInfo(id *uuid.UUID) (*model.Info, error) {
+	ret := _m.Called(id)
+
+	var r0 *model.Info
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Info); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Info)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskNamespace provides a mock function with given fields: id
+func (_m *Store) GetTaskNamespace(id *uuid.UUID) (string, error) {
+	ret := _m.Called(id)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) string); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskProgress provides a mock function with given fields: id
+func (_m *Store) GetTaskProgress(id *uuid.UUID) (*model.Progress, error) {
+	ret := _m.Called(id)
+
+	var r0 *model.Progress
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Progress); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Progress)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskState provides a mock function with given fields: id
+func (_m *Store) GetTaskState(id *uuid.UUID) (model.State, error) {
+	ret := _m.Called(id)
+
+	var r0 model.State
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) model.State); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(model.State)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTaskWorker provides a mock function with given fields: id
+func (_m *Store) GetTaskWorker(id *uuid.UUID) (string, error) {
+	ret := _m.Called(id)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) string); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InNamespace provides a mock function with given fields: namespace
+func (_m *Store) InNamespace(namespace string) task.Store {
+	ret := _m.Called(namespace)
+
+	var r0 task.Store
+	if rf, ok := ret.Get(0).(func(string) task.Store); ok {
+		r0 = rf(namespace)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(task.Store)
+		}
+	}
+
+	return r0
+}
+
+// IsTaskExecuting provides a mock function with given fields: id
+func (_m *Store) IsTaskExecuting(id *uuid.UUID) (bool, error) {
+	ret := _m.Called(id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) bool); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeadCallbacks provides a mock function with given fields:
+func (_m *Store) ListDeadCallbacks() ([]*model.Callback, error) {
+	ret := _m.Called()
+
+	var r0 []*model.Callback
+	if rf, ok := ret.Get(0).(func() []*model.Callback); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Callback)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListNamespaces provides a mock function with given fields:
+func (_m *Store) ListNamespaces() ([]string, error) {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListTasks provides a mock function with given fields: filter, after, limit
+func (_m *Store) ListTasks(filter *model.TaskFilter, after *model.TaskCursor, limit int) (*model.TaskPage, error) {
+	ret := _m.Called(filter, after, limit)
+
+	var r0 *model.TaskPage
+	if rf, ok := ret.Get(0).(func(*model.TaskFilter, *model.TaskCursor, int) *model.TaskPage); ok {
+		r0 = rf(filter, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TaskPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*model.TaskFilter, *model.TaskCursor, int) error); ok {
+		r1 = rf(filter, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListWorkers provides a mock function with given fields:
+func (_m *Store) ListWorkers() ([]*model.Worker, error) {
+	ret := _m.Called()
+
+	var r0 []*model.Worker
+	if rf, ok := ret.Get(0).(func() []*model.Worker); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Worker)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListenForTaskCreatedEvents provides a mock function with given fields:
+func (_m *Store) ListenForTaskCreatedEvents() <-chan *uuid.UUID {
+	ret := _m.Called()
+
+	var r0 <-chan *uuid.UUID
+	if rf, ok := ret.Get(0).(func() <-chan *uuid.UUID); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan *uuid.UUID)
+		}
+	}
+
+	return r0
+}
+
+// Namespace provides a mock function with given fields:
+func (_m *Store) Namespace() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// PopDueCallbacks provides a mock function with given fields: now
+func (_m *Store) PopDueCallbacks(now time.Time) ([]*uuid.UUID, error) {
+	ret := _m.Called(now)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func(time.Time) []*uuid.UUID); ok {
+		r0 = rf(now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PopDueTasks provides a mock function with given fields: now
+func (_m *Store) PopDueTasks(now time.Time) ([]*uuid.UUID, error) {
+	ret := _m.Called(now)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func(time.Time) []*uuid.UUID); ok {
+		r0 = rf(now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PopExpiredLeases provides a mock function with given fields: now
+func (_m *Store) PopExpiredLeases(now time.Time) ([]*uuid.UUID, error) {
+	ret := _m.Called(now)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func(time.Time) []*uuid.UUID); ok {
+		r0 = rf(now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PopExpiredTasks provides a mock function with given fields: now
+func (_m *Store) PopExpiredTasks(now time.Time) ([]*uuid.UUID, error) {
+	ret := _m.Called(now)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func(time.Time) []*uuid.UUID); ok {
+		r0 = rf(now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PopLapsedWorkers provides a mock function with given fields: since
+func (_m *Store) PopLapsedWorkers(since time.Time) ([]*model.Worker, error) {
+	ret := _m.Called(since)
+
+	var r0 []*model.Worker
+	if rf, ok := ret.Get(0).(func(time.Time) []*model.Worker); ok {
+		r0 = rf(since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Worker)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PopTask provides a mock function with given fields:
+func (_m *Store) PopTask() (*uuid.UUID, error) {
+	ret := _m.Called()
+
+	var r0 *uuid.UUID
+	if rf, ok := ret.Get(0).(func() *uuid.UUID); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*uuid.UUID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PublishTaskCreatedEvent provides a mock function with given fields: id
+func (_m *Store) PublishTaskCreatedEvent(id *uuid.UUID) {
+	_m.Called(id)
+}
+
+// PushTask provides a mock function with given fields: id
+func (_m *Store) PushTask(id *uuid.UUID) (int64, error) {
 	ret := _m.Called(id)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(*uuid.UUID) error); ok {
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) int64); ok {
 		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordHeartbeat provides a mock function with given fields: workerID, tasks, now
+func (_m *Store) RecordHeartbeat(workerID string, tasks []*uuid.UUID, now time.Time) (bool, error) {
+	ret := _m.Called(workerID, tasks, now)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, []*uuid.UUID, time.Time) bool); ok {
+		r0 = rf(workerID, tasks, now)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, []*uuid.UUID, time.Time) error); ok {
+		r1 = rf(workerID, tasks, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordMergedCaller provides a mock function with given fields: id, caller
+func (_m *Store) RecordMergedCaller(id *uuid.UUID, caller *model.MergedCaller) error {
+	ret := _m.Called(id, caller)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, *model.MergedCaller) error); ok {
+		r0 = rf(id, caller)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -24,20 +820,20 @@ func (_m *Store) AddTaskToExecutingSet(id *uuid.UUID) error {
 	return r0
 }
 
-// ExecutingSetSize provides a mock function with given fields:
-func (_m *Store) ExecutingSetSize() (int64, error) {
-	ret := _m.Called()
+// RecordTaskAttempt provides a mock function with given fields: info
+func (_m *Store) RecordTaskAttempt(info *model.Info) (int64, error) {
+	ret := _m.Called(info)
 
 	var r0 int64
-	if rf, ok := ret.Get(0).(func() int64); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(*model.Info) int64); ok {
+		r0 = rf(info)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(*model.Info) error); ok {
+		r1 = rf(info)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -45,17 +841,71 @@ func (_m *Store) ExecutingSetSize() (int64, error) {
 	return r0, r1
 }
 
-// GetTask provides a mock function with given fields: id
-func (_m *Store) GetTask(id *uuid.UUID) (*model.Spec, error) {
+// RecordTaskEvent provides a mock function with given fields: id, event
+func (_m *Store) RecordTaskEvent(id *uuid.UUID, event *model.Event) error {
+	ret := _m.Called(id, event)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, *model.Event) error); ok {
+		r0 = rf(id, event)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RegisterWorker provides a mock function with given fields: worker, now
+func (_m *Store) RegisterWorker(worker *model.Worker, now time.Time) error {
+	ret := _m.Called(worker, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.Worker, time.Time) error); ok {
+		r0 = rf(worker, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseIdempotencyKey provides a mock function with given fields: key
+func (_m *Store) ReleaseIdempotencyKey(key string) error {
+	ret := _m.Called(key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseResources provides a mock function with given fields: id
+func (_m *Store) ReleaseResources(id *uuid.UUID) error {
 	ret := _m.Called(id)
 
-	var r0 *model.Spec
-	if rf, ok := ret.Get(0).(func(*uuid.UUID) *model.Spec); ok {
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) error); ok {
 		r0 = rf(id)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Spec)
-		}
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveDelayedTask provides a mock function with given fields: id
+func (_m *Store) RemoveDelayedTask(id *uuid.UUID) (bool, error) {
+	ret := _m.Called(id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) bool); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(bool)
 	}
 
 	var r1 error
@@ -68,8 +918,22 @@ func (_m *Store) GetTask(id *uuid.UUID) (*model.Spec, error) {
 	return r0, r1
 }
 
-// IsTaskExecuting provides a mock function with given fields: id
-func (_m *Store) IsTaskExecuting(id *uuid.UUID) (bool, error) {
+// RemoveTaskFromExecutingSet provides a mock function with given fields: id
+func (_m *Store) RemoveTaskFromExecutingSet(id *uuid.UUID) error {
+	ret := _m.Called(id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID) error); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveTaskFromQueue provides a mock function with given fields: id
+func (_m *Store) RemoveTaskFromQueue(id *uuid.UUID) (bool, error) {
 	ret := _m.Called(id)
 
 	var r0 bool
@@ -89,38 +953,73 @@ func (_m *Store) IsTaskExecuting(id *uuid.UUID) (bool, error) {
 	return r0, r1
 }
 
-// ListenForTaskCreatedEvents provides a mock function with given fields:
-func (_m *Store) ListenForTaskCreatedEvents() <-chan *uuid.UUID {
-	ret := _m.Called()
+// RenewLease provides a mock function with given fields: id, workerID, until
+func (_m *Store) RenewLease(id *uuid.UUID, workerID string, until time.Time) (*model.Lease, error) {
+	ret := _m.Called(id, workerID, until)
 
-	var r0 <-chan *uuid.UUID
-	if rf, ok := ret.Get(0).(func() <-chan *uuid.UUID); ok {
-		r0 = rf()
+	var r0 *model.Lease
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, string, time.Time) *model.Lease); ok {
+		r0 = rf(id, workerID, until)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(<-chan *uuid.UUID)
+			r0 = ret.Get(0).(*model.Lease)
 		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID, string, time.Time) error); ok {
+		r1 = rf(id, workerID, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// PopTask provides a mock function with given fields:
-func (_m *Store) PopTask() (*uuid.UUID, error) {
-	ret := _m.Called()
+// ReserveIdempotencyKey provides a mock function with given fields: key
+func (_m *Store) ReserveIdempotencyKey(key string) (bool, *uuid.UUID, error) {
+	ret := _m.Called(key)
 
-	var r0 *uuid.UUID
-	if rf, ok := ret.Get(0).(func() *uuid.UUID); ok {
-		r0 = rf()
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(key)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*uuid.UUID)
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 *uuid.UUID
+	if rf, ok := ret.Get(1).(func(string) *uuid.UUID); ok {
+		r1 = rf(key)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*uuid.UUID)
 		}
 	}
 
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(key)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ReserveResources provides a mock function with given fields: id, requests, capacity
+func (_m *Store) ReserveResources(id *uuid.UUID, requests model.Resources, capacity model.Resources) (bool, error) {
+	ret := _m.Called(id, requests, capacity)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, model.Resources, model.Resources) bool); ok {
+		r0 = rf(id, requests, capacity)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(*uuid.UUID, model.Resources, model.Resources) error); ok {
+		r1 = rf(id, requests, capacity)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -128,25 +1027,20 @@ func (_m *Store) PopTask() (*uuid.UUID, error) {
 	return r0, r1
 }
 
-// PublishTaskCreatedEvent provides a mock function with given fields: id
-func (_m *Store) PublishTaskCreatedEvent(id *uuid.UUID) {
-	_m.Called(id)
-}
-
-// PushTask provides a mock function with given fields: id
-func (_m *Store) PushTask(id *uuid.UUID) (int64, error) {
-	ret := _m.Called(id)
+// ResolveTaskDependency provides a mock function with given fields: id, parent
+func (_m *Store) ResolveTaskDependency(id *uuid.UUID, parent *uuid.UUID) (int64, error) {
+	ret := _m.Called(id, parent)
 
 	var r0 int64
-	if rf, ok := ret.Get(0).(func(*uuid.UUID) int64); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, *uuid.UUID) int64); ok {
+		r0 = rf(id, parent)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*uuid.UUID) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(*uuid.UUID, *uuid.UUID) error); ok {
+		r1 = rf(id, parent)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -154,8 +1048,8 @@ func (_m *Store) PushTask(id *uuid.UUID) (int64, error) {
 	return r0, r1
 }
 
-// RemoveTaskFromExecutingSet provides a mock function with given fields: id
-func (_m *Store) RemoveTaskFromExecutingSet(id *uuid.UUID) error {
+// ReturnTask provides a mock function with given fields: id
+func (_m *Store) ReturnTask(id *uuid.UUID) error {
 	ret := _m.Called(id)
 
 	var r0 error
@@ -168,22 +1062,57 @@ func (_m *Store) RemoveTaskFromExecutingSet(id *uuid.UUID) error {
 	return r0
 }
 
-// StoreTask provides a mock function with given fields: _a0
-func (_m *Store) StoreTask(_a0 model.Spec) (*uuid.UUID, error) {
-	ret := _m.Called(_a0)
+// ScheduleCallback provides a mock function with given fields: id, at
+func (_m *Store) ScheduleCallback(id *uuid.UUID, at time.Time) (bool, error) {
+	ret := _m.Called(id, at)
 
-	var r0 *uuid.UUID
-	if rf, ok := ret.Get(0).(func(model.Spec) *uuid.UUID); ok {
-		r0 = rf(_a0)
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, time.Time) bool); ok {
+		r0 = rf(id, at)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*uuid.UUID, time.Time) error); ok {
+		r1 = rf(id, at)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetTaskDeadline provides a mock function with given fields: id, deadline
+func (_m *Store) SetTaskDeadline(id *uuid.UUID, deadline time.Time) error {
+	ret := _m.Called(id, deadline)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, time.Time) error); ok {
+		r0 = rf(id, deadline)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StoreTaskBatch provides a mock function with given fields: tasks, capacity, now
+func (_m *Store) StoreTaskBatch(tasks []model.Spec, capacity int64, now time.Time) ([]*uuid.UUID, error) {
+	ret := _m.Called(tasks, capacity, now)
+
+	var r0 []*uuid.UUID
+	if rf, ok := ret.Get(0).(func([]model.Spec, int64, time.Time) []*uuid.UUID); ok {
+		r0 = rf(tasks, capacity, now)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*uuid.UUID)
+			r0 = ret.Get(0).([]*uuid.UUID)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(model.Spec) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func([]model.Spec, int64, time.Time) error); ok {
+		r1 = rf(tasks, capacity, now)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -212,6 +1141,69 @@ func (_m *Store) TaskQueueSize() (int64, error) {
 	return r0, r1
 }
 
+// TaskQueueSizeForPriority provides a mock function with given fields: priority
+func (_m *Store) TaskQueueSizeForPriority(priority int) (int64, error) {
+	ret := _m.Called(priority)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(int) int64); ok {
+		r0 = rf(priority)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int) error); ok {
+		r1 = rf(priority)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TransitionTask provides a mock function with given fields: id, to
+func (_m *Store) TransitionTask(id *uuid.UUID, to model.State) error {
+	ret := _m.Called(id, to)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, model.State) error); ok {
+		r0 = rf(id, to)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TransitionTaskFrom provides a mock function with given fields: id, from, to
+func (_m *Store) TransitionTaskFrom(id *uuid.UUID, from model.State, to model.State) error {
+	ret := _m.Called(id, from, to)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*uuid.UUID, model.State, model.State) error); ok {
+		r0 = rf(id, from, to)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateCallback provides a mock function with given fields: callback
+func (_m *Store) UpdateCallback(callback *model.Callback) error {
+	ret := _m.Called(callback)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.Callback) error); ok {
+		r0 = rf(callback)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateTaskInfo provides a mock function with given fields: info
 func (_m *Store) UpdateTaskInfo(info *model.Info) error {
 	ret := _m.Called(info)
@@ -225,3 +1217,42 @@ func (_m *Store) UpdateTaskInfo(info *model.Info) error {
 
 	return r0
 }
+
+// UpdateTaskProgress provides a mock function with given fields: info, at
+func (_m *Store) UpdateTaskProgress(info *model.Info, at time.Time) error {
+	ret := _m.Called(info, at)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.Info, time.Time) error); ok {
+		r0 = rf(info, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WatchTaskStatus provides a mock function with given fields:
+func (_m *Store) WatchTaskStatus() (<-chan *model.TaskStatus, func()) {
+	ret := _m.Called()
+
+	var r0 <-chan *model.TaskStatus
+	if rf, ok := ret.Get(0).(func() <-chan *model.TaskStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan *model.TaskStatus)
+		}
+	}
+
+	var r1 func()
+	if rf, ok := ret.Get(1).(func() func()); ok {
+		r1 = rf()
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(func())
+		}
+	}
+
+	return r0, r1
+}
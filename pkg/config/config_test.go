@@ -4,6 +4,7 @@ import (
 	"github.com/execd/task-store/pkg/model"
 	. "github.com/onsi/ginkgo"
 	"github.com/stretchr/testify/assert"
+	"time"
 )
 
 var context = GinkgoT()
@@ -17,6 +18,22 @@ var _ = Describe("config", func() {
 				Manager: model.ManagerInfo{
 					ExecutionQueueSize: 10,
 					TaskQueueSize:      10,
+					TickInterval:       model.Duration{Duration: time.Second},
+					DefaultTimeout:     model.Duration{Duration: time.Hour},
+					IdempotencyWindow:  model.Duration{Duration: 24 * time.Hour},
+					WorkerTimeout:      model.Duration{Duration: 30 * time.Second},
+					LeaseDuration:      model.Duration{Duration: time.Minute},
+					Resources:          model.Resources{"cpu": 4000, "memory": 8192, "licenses": 2},
+					Callbacks: model.CallbackInfo{
+						Secret:         "s3cret",
+						MaxAttempts:    3,
+						InitialBackoff: model.Duration{Duration: 5 * time.Second},
+						MaxBackoff:     model.Duration{Duration: time.Minute},
+						Timeout:        model.Duration{Duration: 2 * time.Second},
+					},
+				},
+				Namespaces: map[string]model.NamespaceInfo{
+					"team-a": {TaskQueueSize: 5, ExecutionQueueSize: 2, Weight: 3},
 				},
 			}
 
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// CallbackDeliverer : deliver the results of tasks to the callback urls they were created with
+type CallbackDeliverer interface {
+	DeliverCallbacks(quit <-chan int)
+}
+
+// CallbackDelivererImpl : a callback deliverer impl
+type CallbackDelivererImpl struct {
+	store  task.Store
+	config *model.Config
+	client *http.Client
+}
+
+// NewCallbackDelivererImpl : create a new callback deliverer impl
+func NewCallbackDelivererImpl(store task.Store, config *model.Config) *CallbackDelivererImpl {
+	client := &http.Client{Timeout: config.Manager.Callbacks.DeliveryTimeout()}
+	return &CallbackDelivererImpl{store, config, client}
+}
+
+// DeliverCallbacks : deliver the results of every namespace's tasks as their deliveries fall due.
+// This runs alongside the task manager, so a slow callback url cannot hold up dispatching tasks
+func (d *CallbackDelivererImpl) DeliverCallbacks(quit <-chan int) {
+	ticker := time.NewTicker(tickInterval(d.config))
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, store := range namespaceStores(d.store) {
+					d.deliverDueCallbacksIn(store, time.Now())
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+func (d *CallbackDelivererImpl) deliverDueCallbacksIn(store task.Store, now time.Time) {
+	ids, err := store.PopDueCallbacks(now)
+	if err != nil {
+		fmt.Printf("Failed to retrieve due callbacks: %s\n", err.Error())
+		return
+	}
+
+	for _, taskID := range ids {
+		callback, err := store.GetCallback(taskID)
+		if err != nil {
+			fmt.Printf("Failed to retrieve callback of task %s: %s\n", taskID.String(), err.Error())
+			continue
+		}
+		if callback == nil || callback.State != model.CallbackPending {
+			continue
+		}
+		d.deliver(store, callback, now)
+	}
+}
+
+// deliver : make an attempt at delivering the given callback. The next attempt is scheduled before
+// this one is made, so the delivery is not lost if the task-store stops part way through
+func (d *CallbackDelivererImpl) deliver(store task.Store, callback *model.Callback, now time.Time) {
+	policy := d.config.Manager.Callbacks.RetryPolicy()
+	attempts := len(callback.Attempts) + 1
+	nextAttemptAt := now.Add(policy.Backoff(attempts, rand.Float64()))
+	callback.NextAttemptAt = &nextAttemptAt
+	err := store.UpdateCallback(callback)
+	if err != nil {
+		fmt.Printf("Failed to schedule the next delivery of the callback of task %s: %s\n", callback.TaskID.String(), err.Error())
+		return
+	}
+
+	var attempt model.CallbackAttempt
+	if len(callback.Payload) == 0 {
+		callback.Payload, err = buildCallbackPayload(store, callback)
+		if err != nil {
+			attempt = model.CallbackAttempt{At: now.UTC(), Error: "failed to build the result : " + err.Error()}
+		}
+	}
+	if attempt.Error == "" {
+		attempt = d.post(callback)
+	}
+	callback.Attempts = append(callback.Attempts, attempt)
+	if attempt.Succeeded() {
+		callback.State = model.CallbackDelivered
+		callback.NextAttemptAt = nil
+		fmt.Printf("Delivered the callback of task %s\n", callback.TaskID.String())
+	} else if attempts >= policy.MaxAttempts {
+		callback.State = model.CallbackDead
+		callback.NextAttemptAt = nil
+		fmt.Printf("Dead-lettering the callback of task %s after %d attempts\n", callback.TaskID.String(), attempts)
+	} else {
+		fmt.Printf("Failed to deliver the callback of task %s, retrying at %s\n",
+			callback.TaskID.String(), nextAttemptAt.Format(time.RFC3339))
+	}
+
+	err = store.UpdateCallback(callback)
+	if err != nil {
+		fmt.Printf("Failed to record delivery of the callback of task %s: %s\n", callback.TaskID.String(), err.Error())
+	}
+}
+
+// post : post the callback's payload to its url, signed with the configured secret
+func (d *CallbackDelivererImpl) post(callback *model.Callback) model.CallbackAttempt {
+	attempt := model.CallbackAttempt{At: time.Now().UTC()}
+	req, err := http.NewRequest(http.MethodPost, callback.URL, bytes.NewReader(callback.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	for name, value := range callback.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(model.CallbackSignatureHeader, model.SignCallback(d.config.Manager.Callbacks.Secret, callback.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	attempt.StatusCode = resp.StatusCode
+	return attempt
+}
+
+// buildCallbackPayload : the result of the callback's task, as it is once the task has completed
+func buildCallbackPayload(store task.Store, callback *model.Callback) ([]byte, error) {
+	state, err := store.GetTaskState(callback.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := store.GetTaskInfo(callback.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	payload := &model.CallbackPayload{TaskID: callback.TaskID, State: state, Info: info}
+	return json.Marshal(payload)
+}
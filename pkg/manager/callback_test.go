@@ -0,0 +1,163 @@
+package manager_test
+
+import (
+	"encoding/json"
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/manager"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("callback deliverer", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var config *model.Config
+	var requests chan *http.Request
+	var bodies chan []byte
+	var status int
+	var server *httptest.Server
+	var quit chan int
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		config = &model.Config{
+			Manager: model.ManagerInfo{
+				TickInterval: model.Duration{Duration: 10 * time.Millisecond},
+				Callbacks: model.CallbackInfo{
+					Secret:         "s3cret",
+					MaxAttempts:    2,
+					InitialBackoff: model.Duration{Duration: time.Millisecond},
+				},
+			},
+		}
+		requests = make(chan *http.Request, 10)
+		bodies = make(chan []byte, 10)
+		status = 200
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.WriteHeader(status)
+			requests <- r
+			bodies <- body
+		}))
+		quit = make(chan int)
+	})
+
+	AfterEach(func() {
+		close(quit)
+		server.Close()
+		directRedis.Close()
+	})
+
+	givenCompletedTask := func() *uuid.UUID {
+		created, err := taskStore.CreateTask(model.Spec{Image: "alpine", CallbackURL: server.URL + "/done",
+			CallbackHeaders: map[string]string{"Authorization": "Bearer x"}}, 10, time.Now())
+		failOnError(err)
+		id := created.ID
+		failOnError(taskStore.TransitionTask(id, model.StateScheduled))
+		failOnError(taskStore.TransitionTask(id, model.StateSucceeded))
+		failOnError(taskStore.UpdateTaskInfo(&model.Info{ID: id, Succeeded: true}))
+		_, err = taskStore.ScheduleCallback(id, time.Now())
+		failOnError(err)
+		return id
+	}
+
+	It("should post the signed result of a task to its callback url", func() {
+		// Arrange
+		id := givenCompletedTask()
+
+		done := make(chan bool)
+		store := &settlingStore{StoreImpl: taskStore, state: model.CallbackDelivered, done: done}
+
+		// Act
+		manager.NewCallbackDelivererImpl(store, config).DeliverCallbacks(quit)
+
+		// Assert
+		req, body := waitForRequest(requests, bodies)
+		assert.Equal(context, "/done", req.URL.Path)
+		assert.Equal(context, "Bearer x", req.Header.Get("Authorization"))
+		assert.Equal(context, model.SignCallback("s3cret", body), req.Header.Get(model.CallbackSignatureHeader))
+		payload := new(model.CallbackPayload)
+		failOnError(json.Unmarshal(body, payload))
+		assert.Equal(context, id, payload.TaskID)
+		assert.Equal(context, model.StateSucceeded, payload.State)
+		assert.True(context, payload.Info.Succeeded)
+		waitFor(done)
+		callback, err := taskStore.GetCallback(id)
+		assert.Nil(context, err)
+		assert.Equal(context, model.CallbackDelivered, callback.State)
+		assert.Len(context, callback.Attempts, 1)
+		assert.Equal(context, 200, callback.Attempts[0].StatusCode)
+		assert.Nil(context, callback.NextAttemptAt)
+	})
+
+	It("should retry a failed delivery and dead-letter it once it runs out of attempts", func() {
+		// Arrange
+		status = 503
+		id := givenCompletedTask()
+		done := make(chan bool)
+		store := &settlingStore{StoreImpl: taskStore, state: model.CallbackDead, done: done}
+
+		// Act
+		manager.NewCallbackDelivererImpl(store, config).DeliverCallbacks(quit)
+
+		// Assert
+		_, first := waitForRequest(requests, bodies)
+		_, second := waitForRequest(requests, bodies)
+		assert.Equal(context, first, second)
+		waitFor(done)
+		callback, err := taskStore.GetCallback(id)
+		assert.Nil(context, err)
+		assert.Equal(context, model.CallbackDead, callback.State)
+		assert.Len(context, callback.Attempts, 2)
+		assert.Equal(context, 503, callback.Attempts[1].StatusCode)
+		dead, err := taskStore.ListDeadCallbacks()
+		assert.Nil(context, err)
+		assert.Len(context, dead, 1)
+	})
+})
+
+func waitForRequest(requests <-chan *http.Request, bodies <-chan []byte) (*http.Request, []byte) {
+	select {
+	case req := <-requests:
+		return req, <-bodies
+	case <-time.After(time.Second):
+		assert.Fail(context, "Timed out waiting for the callback to be delivered")
+		return nil, nil
+	}
+}
+
+// settlingStore : a task store that closes done once a callback is recorded in the given state
+type settlingStore struct {
+	*task.StoreImpl
+	state model.CallbackState
+	done  chan bool
+}
+
+func (s *settlingStore) UpdateCallback(callback *model.Callback) error {
+	err := s.StoreImpl.UpdateCallback(callback)
+	if callback.State == s.state {
+		close(s.done)
+	}
+	return err
+}
+
+func failOnError(err error) {
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
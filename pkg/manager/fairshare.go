@@ -0,0 +1,44 @@
+package manager
+
+import "github.com/execd/task-store/pkg/task"
+
+// deficitRoundRobin : shares execution capacity between namespaces in proportion to their weights.
+// Each namespace in turn is granted its weight in credit and spends one credit per task it
+// dispatches. A namespace that runs out of queued tasks gives up its remaining credit, so it cannot
+// save up a burst while others wait. A namespace whose turn ends with tasks still queued, because it
+// reached its own limit or could not dispatch its next task, keeps its remaining credit for its next
+// turn, which tops it up to no more than its weight
+type deficitRoundRobin struct {
+	turn     string           // Namespace whose turn it is
+	deficits map[string]int64 // Credit each namespace has left in its turn
+}
+
+func newDeficitRoundRobin() *deficitRoundRobin {
+	return &deficitRoundRobin{deficits: make(map[string]int64)}
+}
+
+// start : the index of the store whose turn it is, the first if that namespace has gone
+func (d *deficitRoundRobin) start(stores []task.Store) int {
+	for i, store := range stores {
+		if store.Namespace() == d.turn {
+			return i
+		}
+	}
+	return 0
+}
+
+// beginTurn : make it the given namespace's turn, granting it the given weight in credit
+// unless it still has credit left from a turn that was cut short or ended with tasks still queued
+func (d *deficitRoundRobin) beginTurn(namespace string, weight int64) {
+	d.turn = namespace
+	if d.deficits[namespace] < 1 {
+		d.deficits[namespace] = weight
+	}
+}
+
+// endTurn : end the given namespace's turn, giving up its remaining credit if it ran out of queued tasks
+func (d *deficitRoundRobin) endTurn(namespace string, drained bool) {
+	if drained {
+		d.deficits[namespace] = 0
+	}
+}
@@ -5,8 +5,31 @@ import (
 	"github.com/execd/task-store/pkg/model"
 	"github.com/execd/task-store/pkg/task"
 	"github.com/satori/go.uuid"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const defaultTickInterval = time.Second
+
+// dispatchOutcome : what became of a task taken off the task queue to be dispatched
+type dispatchOutcome int
+
+const (
+	dispatched  dispatchOutcome = iota // The task was handed to a worker, or dropped
+	unavailable                        // The task's resources are not free, it was put back at the front of the task queue
+	failed                             // The task could not be handed to a worker and was put back on the task queue
+)
+
+const unschedulableFailureType = "task"
+const unschedulableFailureName = "resources"
+const unschedulableFailureReason = "Unschedulable"
+
+const unreadableFailureType = "task"
+const unreadableFailureName = "spec"
+const unreadableFailureReason = "Unreadable"
+
 // TaskManager : manage tasks
 type TaskManager interface {
 	ManageTasks()
@@ -17,18 +40,23 @@ type TaskManagerImpl struct {
 	store        task.Store
 	eventManager task.EventManager
 	config       *model.Config
+	fairShare    *deficitRoundRobin
 }
 
 // NewTaskManagerImpl : create a new task manager impl
 func NewTaskManagerImpl(store task.Store, eventManager task.EventManager, config *model.Config) *TaskManagerImpl {
-	return &TaskManagerImpl{store, eventManager, config}
+	return &TaskManagerImpl{store, eventManager, config, newDeficitRoundRobin()}
 }
 
 // ManageTasks : manage task creation and progress
 func (t *TaskManagerImpl) ManageTasks(quit <-chan int) {
 	progressChQuit := make(chan int, 1)
+	promoterQuit := make(chan int)
 	infoCh, errCh := t.eventManager.ListenForProgress(progressChQuit)
+	go t.promoteDelayedTasks(promoterQuit)
+	ticker := time.NewTicker(t.tickInterval())
 	go func() {
+		defer ticker.Stop()
 		for {
 			select {
 			case taskID, ok := <-t.store.ListenForTaskCreatedEvents():
@@ -36,7 +64,8 @@ func (t *TaskManagerImpl) ManageTasks(quit <-chan int) {
 					fmt.Println("Task create channel not ok!")
 					continue
 				}
-				t.scheduleForExecution(taskID)
+				fmt.Printf("Task %s created\n", taskID.String())
+				t.dispatchQueuedTasks()
 			case info, ok := <-infoCh:
 				if !ok {
 					fmt.Println("Task info channel not ok!")
@@ -49,57 +78,505 @@ func (t *TaskManagerImpl) ManageTasks(quit <-chan int) {
 					continue
 				}
 				fmt.Printf("Received error from task progress watcher: %s\n", err.Error())
+			case <-ticker.C:
+				t.reapLapsedWorkers()
+				t.reapExpiredTasks()
+				t.dispatchQueuedTasks()
 			case <-quit:
 				progressChQuit <- 1
+				close(promoterQuit)
 				return
 			}
 		}
 	}()
 }
 
-func (t *TaskManagerImpl) scheduleForExecution(taskID *uuid.UUID) {
-	size, err := t.store.ExecutingSetSize()
+// stores : the store of the default namespace followed by the stores of the other namespaces
+func (t *TaskManagerImpl) stores() []task.Store {
+	return namespaceStores(t.store)
+}
+
+// namespaceStores : the given store of the default namespace followed by a store for every other namespace
+func namespaceStores(store task.Store) []task.Store {
+	stores := []task.Store{store}
+	namespaces, err := store.ListNamespaces()
 	if err != nil {
-		fmt.Printf("Received error retrieving executing set size : %s", err.Error())
-		return
+		fmt.Printf("Managing the default namespace only: %s\n", err.Error())
+		return stores
 	}
+	for _, namespace := range namespaces {
+		stores = append(stores, store.InNamespace(namespace))
+	}
+	return stores
+}
 
-	if size >= t.config.Manager.ExecutionQueueSize {
-		fmt.Println("Not scheduling taskSpec taskID for execution, executing set has reached capacity.")
-		return
+// storeFor : the store of the namespace the given task belongs to
+func (t *TaskManagerImpl) storeFor(taskID *uuid.UUID) (task.Store, error) {
+	namespace, err := t.store.GetTaskNamespace(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		return t.store, nil
+	}
+	return t.store.InNamespace(namespace), nil
+}
+
+// dispatchQueuedTasks : hand queued tasks to workers for as long as there is execution capacity,
+// sharing it between the namespaces by deficit round robin within each namespace's own limit
+func (t *TaskManagerImpl) dispatchQueuedTasks() {
+	stores := t.stores()
+	executing := make([]int64, len(stores))
+	var total int64
+	for i, store := range stores {
+		size, err := store.ExecutingSetSize()
+		if err != nil {
+			fmt.Printf("Received error retrieving executing set size : %s", err.Error())
+			return
+		}
+		executing[i] = size
+		total += size
+	}
+
+	drr := t.fairShare
+	idle := 0
+	for i := drr.start(stores); idle < len(stores); i = (i + 1) % len(stores) {
+		store := stores[i]
+		namespace := store.Namespace()
+		limit := t.config.ExecutionQueueSizeFor(namespace)
+		drr.beginTurn(namespace, t.config.WeightFor(namespace))
+
+		dispatched := false
+		drained := false
+		for drr.deficits[namespace] > 0 {
+			if total >= t.config.Manager.ExecutionQueueSize {
+				return
+			}
+			if executing[i] >= limit {
+				break
+			}
+
+			taskID, err := store.PopTask()
+			if err != nil {
+				fmt.Printf("Failed to retrieve next task for execution: %s\n", err.Error())
+				break
+			}
+			if taskID == nil {
+				drained = true
+				break
+			}
+
+			outcome := t.scheduleForExecution(store, taskID)
+			if outcome == failed {
+				return
+			}
+			if outcome == unavailable {
+				break
+			}
+			executing[i]++
+			total++
+			drr.deficits[namespace]--
+			dispatched = true
+		}
+		drr.endTurn(namespace, drained)
+
+		if dispatched {
+			idle = 0
+		} else {
+			idle++
+		}
 	}
+}
 
-	taskSpec, err := t.store.GetTask(taskID)
+// scheduleForExecution : hand the given task, already taken off the task queue, to a worker
+// once the resources it requests have been reserved for it. The task's lease and deadline are
+// recorded before the task is handed over, and removed again if it cannot be
+func (t *TaskManagerImpl) scheduleForExecution(store task.Store, taskID *uuid.UUID) dispatchOutcome {
+	err := store.TransitionTask(taskID, model.StateScheduled)
+	if _, invalid := err.(*task.InvalidTransitionError); invalid {
+		fmt.Printf("Dropping task %s, it is no longer queued: %s\n", taskID.String(), err.Error())
+		return dispatched
+	}
 	if err != nil {
 		fmt.Printf("Failed scheduling taskSpec taskID for execution: %s\n", err.Error())
-		return
+		t.requeue(store, taskID, false, err)
+		return failed
 	}
 
-	err = t.eventManager.PublishWork(taskSpec)
+	taskSpec, err := store.GetTask(taskID)
+	switch err.(type) {
+	case nil:
+	case *task.TaskNotFoundError, *task.CorruptTaskError:
+		fmt.Printf("Task %s can never be scheduled: %s\n", taskID.String(), err.Error())
+		t.finishTask(store, model.SourceManager, &model.Info{
+			ID: taskID,
+			FailureStats: &model.FailureStatus{
+				Type:    unreadableFailureType,
+				Name:    unreadableFailureName,
+				Reason:  unreadableFailureReason,
+				Message: err.Error(),
+			},
+		})
+		return dispatched
+	default:
+		fmt.Printf("Failed scheduling taskSpec taskID for execution: %s\n", err.Error())
+		t.requeue(store, taskID, true, err)
+		return failed
+	}
+
+	if len(taskSpec.Resources) > 0 {
+		outcome, admitted := t.admit(store, taskSpec)
+		if !admitted {
+			return outcome
+		}
+	}
+
+	err = store.AddTaskToExecutingSet(taskID, t.leaseExpiry(time.Now()))
 	if err != nil {
 		fmt.Printf("Failed scheduling taskSpec taskID for execution: %s\n", err.Error())
-		return
+		if len(taskSpec.Resources) > 0 {
+			if err := store.ReleaseResources(taskID); err != nil {
+				fmt.Printf("Failed to release resources of task %s: %s\n", taskID.String(), err.Error())
+			}
+		}
+		t.requeue(store, taskID, true, err)
+		return failed
 	}
 
-	err = t.store.AddTaskToExecutingSet(taskID)
+	if timeout := t.timeoutFor(taskSpec); timeout > 0 {
+		err = store.SetTaskDeadline(taskID, time.Now().Add(timeout))
+		if err != nil {
+			fmt.Printf("Task %s is executing without a deadline: %s\n", taskID.String(), err.Error())
+		}
+	}
+
+	err = t.eventManager.PublishWork(taskSpec)
 	if err != nil {
-		fmt.Printf("Task spec scheduled for execution, but failed to add to executing set: %s\n", err.Error())
-		return
+		fmt.Printf("Failed scheduling taskSpec taskID for execution: %s\n", err.Error())
+		if err := store.RemoveTaskFromExecutingSet(taskID); err != nil {
+			fmt.Printf("Error removing task from executing set: %s\n", err.Error())
+		}
+		t.requeue(store, taskID, true, err)
+		return failed
 	}
+	task.RecordEvent(store, taskID, &model.Event{Type: model.EventDispatched, Source: model.SourceManager, State: model.StateScheduled})
 
 	fmt.Printf("Task %s successfully added to executing set\n", taskID.String())
+	return dispatched
+}
+
+// admit : reserve the resources the given scheduled task requests. A task whose resources are not
+// free is put back at the front of the task queue to wait for them, so smaller tasks behind it cannot
+// starve it. A task that requests more than the pool has can never run and is failed
+func (t *TaskManagerImpl) admit(store task.Store, taskSpec *model.Spec) (dispatchOutcome, bool) {
+	pool := t.config.Manager.Resources
+	if err := taskSpec.Resources.FitsWithin(pool); err != nil {
+		fmt.Printf("Task %s can never be scheduled: %s\n", taskSpec.ID.String(), err.Error())
+		t.finishTask(store, model.SourceManager, &model.Info{
+			ID: taskSpec.ID,
+			FailureStats: &model.FailureStatus{
+				Type:    unschedulableFailureType,
+				Name:    unschedulableFailureName,
+				Reason:  unschedulableFailureReason,
+				Message: err.Error(),
+			},
+		})
+		return dispatched, false
+	}
+
+	reserved, err := store.ReserveResources(taskSpec.ID, taskSpec.Resources, pool)
+	if err == nil && reserved {
+		return dispatched, true
+	}
+	if err != nil {
+		fmt.Printf("Failed to reserve resources for task %s: %s\n", taskSpec.ID.String(), err.Error())
+	}
+
+	err = store.TransitionTask(taskSpec.ID, model.StateQueued)
+	if err != nil {
+		fmt.Printf("Failed to move task %s back to queued: %s\n", taskSpec.ID.String(), err.Error())
+		return unavailable, false
+	}
+	err = store.ReturnTask(taskSpec.ID)
+	if err != nil {
+		fmt.Printf("Failed to put task %s back on the task queue: %s\n", taskSpec.ID.String(), err.Error())
+	}
+	return unavailable, false
+}
+
+// requeue : put a task taken off the task queue that could not be dispatched back on it, moving it
+// back to queued if it was already scheduled
+func (t *TaskManagerImpl) requeue(store task.Store, taskID *uuid.UUID, scheduled bool, cause error) {
+	if scheduled {
+		err := store.TransitionTask(taskID, model.StateQueued)
+		if err != nil {
+			fmt.Printf("Failed to move task %s back to queued: %s\n", taskID.String(), err.Error())
+			return
+		}
+	}
+	_, err := store.PushTask(taskID)
+	if err != nil {
+		fmt.Printf("Failed to put task %s back on the task queue: %s\n", taskID.String(), err.Error())
+		return
+	}
+	task.RecordEvent(store, taskID, &model.Event{Type: model.EventQueued, Source: model.SourceManager,
+		State: model.StateQueued, Message: "failed to dispatch: " + cause.Error()})
 }
 
 func (t *TaskManagerImpl) handleTaskProgressInfo(info *model.Info) {
+	store, err := t.storeFor(info.ID)
+	if err != nil {
+		fmt.Printf("Failed to find the namespace of task %s: %s\n", info.ID.String(), err.Error())
+		return
+	}
+	if !holdsLease(store, info) {
+		return
+	}
+	if !info.IsTerminal() {
+		recordProgress(store, info)
+		return
+	}
+
 	fmt.Printf("Received completion status for task %s\n", info.ID.String())
-	err := t.store.UpdateTaskInfo(info)
+	defer t.dispatchQueuedTasks()
+	t.completeTask(store, model.SourceWorker, info)
+}
+
+// holdsLease : whether the worker reporting on the given task holds the task's live lease, which it
+// claims if no worker has yet. A report from a worker whose lease has expired, or that never held it,
+// is dropped, as the task may have been failed or handed to another worker since. A report that does not
+// name its worker is accepted unless another worker holds the task's live lease
+func holdsLease(store task.Store, info *model.Info) bool {
+	if info.Worker == "" {
+		return noOtherWorkerHoldsLease(store, info)
+	}
+
+	_, err := store.RenewLease(info.ID, info.Worker, time.Time{})
+	switch err.(type) {
+	case nil:
+		return true
+	case *task.LeaseLostError:
+		fmt.Printf("Ignoring report on task %s from worker %s, the task holds no live lease\n", info.ID.String(), info.Worker)
+	case *task.LeaseHeldError:
+		fmt.Printf("Ignoring report on task %s from worker %s, another worker holds its lease\n", info.ID.String(), info.Worker)
+	default:
+		fmt.Printf("Ignoring report on task %s from worker %s: %s\n", info.ID.String(), info.Worker, err.Error())
+	}
+	return false
+}
+
+// noOtherWorkerHoldsLease : whether a report on the given task that does not name its worker may be handled,
+// as no worker has claimed the task's lease or the lease of the worker that did has expired
+func noOtherWorkerHoldsLease(store task.Store, info *model.Info) bool {
+	lease, err := store.GetLease(info.ID)
+	if err != nil {
+		fmt.Printf("Ignoring report on task %s: %s\n", info.ID.String(), err.Error())
+		return false
+	}
+	if lease == nil || lease.Worker == "" || (lease.ExpiresAt != nil && !lease.ExpiresAt.After(time.Now())) {
+		return true
+	}
+	fmt.Printf("Ignoring report on task %s, worker %s holds its lease\n", info.ID.String(), lease.Worker)
+	return false
+}
+
+// recordProgress : record an update about how an executing task is getting on, the first
+// update moves the task to running. The task keeps its slot until it completes
+func recordProgress(store task.Store, info *model.Info) {
+	err := store.TransitionTaskFrom(info.ID, model.StateScheduled, model.StateRunning)
+	if transitionErr, ok := err.(*task.InvalidTransitionError); ok && transitionErr.From != model.StateRunning {
+		fmt.Printf("Ignoring progress of task %s, it is %s\n", info.ID.String(), transitionErr.From)
+		return
+	} else if err != nil && !ok {
+		fmt.Printf("Failed to move task %s to running: %s\n", info.ID.String(), err.Error())
+	}
+
+	err = store.UpdateTaskProgress(info, time.Now())
+	if err != nil {
+		fmt.Printf("Failed to record progress of task %s: %s\n", info.ID.String(), err.Error())
+		return
+	}
+	task.RecordEvent(store, info.ID, &model.Event{Type: model.EventProgress, Source: model.SourceWorker,
+		State: model.StateRunning, Message: describeProgress(info)})
+}
+
+// describeProgress : a one line summary of a progress update, e.g. "40% compiling: 12 of 30 files"
+func describeProgress(info *model.Info) string {
+	parts := make([]string, 0, 3)
+	if info.Percent != nil {
+		parts = append(parts, strconv.FormatFloat(*info.Percent, 'f', -1, 64)+"%")
+	}
+	if info.Phase != "" {
+		parts = append(parts, info.Phase)
+	}
+	summary := strings.Join(parts, " ")
+	if info.Message != "" {
+		if summary != "" {
+			summary += ": "
+		}
+		summary += info.Message
+	}
+	if summary == "" {
+		summary = string(info.Status)
+	}
+	return summary
+}
+
+// completeTask : record the outcome of the given task as reported by the given source,
+// retrying it if it failed and may be
+func (t *TaskManagerImpl) completeTask(store task.Store, source string, info *model.Info) {
+	if !isExecuting(store, info.ID) {
+		return
+	}
+	if !info.Succeeded && !info.Cancelled && t.retryTask(store, source, info) {
+		return
+	}
+	t.finishTask(store, source, info)
+}
+
+// expireTask : record the outcome of the given task that was given up on by the manager, rather than
+// reported by its worker. Unless it is retried it ends expired instead of failed
+func (t *TaskManagerImpl) expireTask(store task.Store, info *model.Info) {
+	if !isExecuting(store, info.ID) {
+		return
+	}
+	if t.retryTask(store, model.SourceManager, info) {
+		return
+	}
+	t.endTask(store, model.SourceManager, info, model.StateExpired)
+}
+
+// isExecuting : whether the given task is scheduled or running. The outcome of a task in any other
+// state has already been handled, most likely it is a duplicate report, and is ignored
+func isExecuting(store task.Store, id *uuid.UUID) bool {
+	state, err := store.GetTaskState(id)
+	if err != nil {
+		fmt.Printf("Ignoring outcome of task %s, failed to retrieve its state: %s\n", id.String(), err.Error())
+		return false
+	}
+	if state != model.StateScheduled && state != model.StateRunning {
+		fmt.Printf("Ignoring outcome of task %s, it is %s\n", id.String(), state)
+		return false
+	}
+	return true
+}
+
+// finishTask : move the given task to the terminal state its outcome calls for, see endTask
+func (t *TaskManagerImpl) finishTask(store task.Store, source string, info *model.Info) {
+	to := model.StateFailed
+	if info.Cancelled {
+		to = model.StateCancelled
+	} else if info.Succeeded {
+		to = model.StateSucceeded
+	}
+	t.endTask(store, source, info, to)
+}
+
+// endTask : move the given task to the given terminal state, free its slot, resolve the tasks depending on it
+// and schedule delivering its result to its callback url
+func (t *TaskManagerImpl) endTask(store task.Store, source string, info *model.Info, to model.State) {
+	err := store.UpdateTaskInfo(info)
 	if err != nil {
 		fmt.Printf("Received error trying to update task info: %s\n", err.Error())
 		return
 	}
-	err = t.store.RemoveTaskFromExecutingSet(info.ID)
+	if t.transition(store, info.ID, to) {
+		task.RecordEvent(store, info.ID, &model.Event{Type: model.EventCompleted, Source: source,
+			State: to, Message: describeFailure(info.FailureStats)})
+		task.ResolveDependents(store, info.ID, to == model.StateSucceeded)
+		if _, err := store.ScheduleCallback(info.ID, time.Now()); err != nil {
+			fmt.Printf("Failed to schedule the callback of task %s: %s\n", info.ID.String(), err.Error())
+		}
+	}
+	err = store.RemoveTaskFromExecutingSet(info.ID)
 	if err != nil {
 		fmt.Printf("Error removing task from executing set: %s\n", err.Error())
 		return
 	}
 }
+
+// retryTask : record the failed attempt and, if the task's retry policy allows
+// another one, hold the task back for its backoff and free its slot.
+// Returns true if the task will be retried
+func (t *TaskManagerImpl) retryTask(store task.Store, source string, info *model.Info) bool {
+	attempts, err := store.RecordTaskAttempt(info)
+	if err != nil {
+		fmt.Printf("Failed to record attempt, task %s will not be retried: %s\n", info.ID.String(), err.Error())
+		return false
+	}
+
+	taskSpec, err := store.GetTask(info.ID)
+	if err != nil {
+		fmt.Printf("Failed to retrieve task, task %s will not be retried: %s\n", info.ID.String(), err.Error())
+		return false
+	}
+
+	policy := taskSpec.Retry
+	if policy == nil || attempts >= int64(policy.MaxAttempts) {
+		return false
+	}
+
+	retryAt := time.Now().Add(policy.Backoff(int(attempts), rand.Float64()))
+	err = store.DelayTask(info.ID, retryAt)
+	if err != nil {
+		fmt.Printf("Failed to delay task, task %s will not be retried: %s\n", info.ID.String(), err.Error())
+		return false
+	}
+
+	err = store.TransitionTask(info.ID, model.StateDelayed)
+	if err != nil {
+		fmt.Printf("Task %s will not be retried: %s\n", info.ID.String(), err.Error())
+		if _, err := store.RemoveDelayedTask(info.ID); err != nil {
+			fmt.Printf("Error removing task from delayed tasks: %s\n", err.Error())
+		}
+		return false
+	}
+
+	err = store.RemoveTaskFromExecutingSet(info.ID)
+	if err != nil {
+		fmt.Printf("Error removing task from executing set: %s\n", err.Error())
+	}
+
+	fmt.Printf("Task %s failed attempt %d, retrying at %s\n", info.ID.String(), attempts, retryAt.Format(time.RFC3339))
+	message := fmt.Sprintf("attempt %d failed, retrying at %s", attempts, retryAt.Format(time.RFC3339))
+	if reason := describeFailure(info.FailureStats); reason != "" {
+		message = fmt.Sprintf("attempt %d failed (%s), retrying at %s", attempts, reason, retryAt.Format(time.RFC3339))
+	}
+	task.RecordEvent(store, info.ID, &model.Event{Type: model.EventRetried, Source: source,
+		State: model.StateDelayed, Message: message})
+	return true
+}
+
+// describeFailure : a one line summary of why a task failed, empty if it did not
+func describeFailure(failure *model.FailureStatus) string {
+	if failure == nil {
+		return ""
+	}
+	if failure.Message == "" {
+		return failure.Reason
+	}
+	if failure.Reason == "" {
+		return failure.Message
+	}
+	return failure.Reason + ": " + failure.Message
+}
+
+func (t *TaskManagerImpl) tickInterval() time.Duration {
+	return tickInterval(t.config)
+}
+
+func tickInterval(config *model.Config) time.Duration {
+	if config.Manager.TickInterval.Duration > 0 {
+		return config.Manager.TickInterval.Duration
+	}
+	return defaultTickInterval
+}
+
+func (t *TaskManagerImpl) transition(store task.Store, taskID *uuid.UUID, to model.State) bool {
+	err := store.TransitionTask(taskID, to)
+	if err != nil {
+		fmt.Printf("Failed to move task %s to %s: %s\n", taskID.String(), to, err.Error())
+		return false
+	}
+	return true
+}
@@ -4,10 +4,13 @@ import (
 	"github.com/execd/task-store/mocks"
 	"github.com/execd/task-store/pkg/manager"
 	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
 	. "github.com/onsi/ginkgo"
 	"github.com/pkg/errors"
 	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 var context = GinkgoT()
@@ -28,6 +31,11 @@ var _ = Describe("manage tasks", func() {
 			},
 		}
 		eventManagerMock.On("ListenForProgress", mock.Anything).Return(nil, nil)
+		taskStoreMock.On("ListNamespaces").Return([]string{}, nil)
+		taskStoreMock.On("Namespace").Return("")
+		taskStoreMock.On("RecordTaskEvent", mock.Anything, mock.Anything).Return(nil)
+		taskStoreMock.On("ScheduleCallback", mock.Anything, mock.Anything).Return(false, nil)
+		taskStoreMock.On("GetTaskNamespace", mock.Anything).Return("", nil)
 		taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
 		quit = make(chan int)
 	})
@@ -59,23 +67,69 @@ var _ = Describe("manage tasks", func() {
 			taskManager.ManageTasks(quit)
 
 			// Assert
-			taskStoreMock.AssertNotCalled(context, "AddTaskToExecutingSet")
+			taskStoreMock.AssertNotCalled(context, "PopTask")
+			taskStoreMock.AssertNotCalled(context, "AddTaskToExecutingSet", mock.Anything, mock.Anything)
 			quit <- 1
 		})
 
-		It("should not continue if get task fails", func() {
+		It("should put the task back on the task queue and not continue if get task fails", func() {
 			// Arrange
 			defer close(quit)
+			done := make(chan bool)
 			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
 			taskStoreMock.On("ExecutingSetSize").Return(int64(1), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
 			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(nil, errors.New("error"))
+			taskStoreMock.On("PushTask", mock.AnythingOfType("*uuid.UUID")).Return(int64(1), nil).
+				Run(func(args mock.Arguments) { close(done) })
 
 			// Act
 			taskManager.ManageTasks(quit)
 
 			// Assert
+			waitFor(done)
+			quit <- 1
 			eventManagerMock.AssertNotCalled(context, "PublishWork", mock.Anything)
+			taskStoreMock.AssertCalled(context, "TransitionTask", mock.Anything, model.StateQueued)
+			taskStoreMock.AssertNumberOfCalls(context, "PopTask", 1)
+		})
+
+		It("should fail a task whose spec is missing and carry on dispatching", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			next := uuid.Must(uuid.NewV4())
+			spec := &model.Spec{ID: &next, Image: "alpine"}
+			var info *model.Info
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("PopTask").Return(&id, nil).Once()
+			taskStoreMock.On("PopTask").Return(&next, nil).Once()
+			taskStoreMock.On("PopTask").Return(nil, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
+			taskStoreMock.On("GetTask", &id).Return(nil, &task.TaskNotFoundError{ID: &id})
+			taskStoreMock.On("GetTask", &next).Return(spec, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { info = args.Get(0).(*model.Info) })
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", &next, mock.Anything).Return(nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
 			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateFailed)
+			taskStoreMock.AssertNotCalled(context, "TransitionTask", &id, model.StateQueued)
+			taskStoreMock.AssertNotCalled(context, "PushTask", mock.Anything)
+			assert.Equal(context, &id, info.ID)
+			assert.NotNil(context, info.FailureStats)
 		})
 
 		It("should not continue if publish work fails", func() {
@@ -83,14 +137,17 @@ var _ = Describe("manage tasks", func() {
 			defer close(quit)
 			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
 			taskStoreMock.On("ExecutingSetSize").Return(int64(1), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
 			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(nil, errors.New("error"))
+			taskStoreMock.On("PushTask", mock.AnythingOfType("*uuid.UUID")).Return(int64(1), nil)
 			eventManagerMock.On("PublishWork", mock.Anything).Return(nil, errors.New("error"))
 
 			// Act
 			taskManager.ManageTasks(quit)
 
 			// Assert
-			taskStoreMock.AssertNotCalled(context, "AddTaskToExecutingSet", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "AddTaskToExecutingSet", mock.Anything, mock.Anything)
 			quit <- 1
 		})
 
@@ -99,18 +156,1077 @@ var _ = Describe("manage tasks", func() {
 			defer close(quit)
 			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
 			taskStoreMock.On("ExecutingSetSize").Return(int64(1), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
 			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(nil, errors.New("error"))
+			taskStoreMock.On("PushTask", mock.AnythingOfType("*uuid.UUID")).Return(int64(1), nil)
 			eventManagerMock.On("PublishWork", mock.Anything).Return(nil, errors.New("error"))
 			taskStoreMock.On("AddTaskToExecutingSet",
-				mock.AnythingOfType("*uuid.UUID")).Return(nil, errors.New("error"))
+				mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil, errors.New("error"))
+
+			// Act
+			taskManager.ManageTasks(quit)
+			quit <- 1
+		})
+
+		It("should move the task to scheduled and grant its lease before publishing work", func() {
+			// Arrange
+			defer close(quit)
+			createdTasks := buildCreatedTasksCh()
+			done := make(chan bool)
+			spec := &model.Spec{Image: "alpine"}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(createdTasks)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil).Run(func(args mock.Arguments) {
+				taskStoreMock.AssertCalled(context, "TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled)
+				taskStoreMock.AssertCalled(context, "AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything)
+				close(done)
+			})
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "RecordTaskEvent", mock.AnythingOfType("*uuid.UUID"), mock.MatchedBy(func(event *model.Event) bool {
+				return event.Type == model.EventDispatched && event.State == model.StateScheduled
+			}))
+		})
+
+		It("should not publish work if the task cannot be granted a lease", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(&model.Spec{}, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(errors.New("error"))
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateQueued).Return(nil)
+			taskStoreMock.On("PushTask", mock.AnythingOfType("*uuid.UUID")).Return(int64(1), nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			eventManagerMock.AssertNotCalled(context, "PublishWork", mock.Anything)
+			taskStoreMock.AssertCalled(context, "TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateQueued)
+		})
+
+		It("should give the task a deadline if it has a timeout", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			spec := &model.Spec{Image: "alpine", Timeout: &model.Duration{Duration: time.Minute}}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
+			var deadline time.Time
+			taskStoreMock.On("SetTaskDeadline", mock.AnythingOfType("*uuid.UUID"), mock.AnythingOfType("time.Time")).
+				Return(nil).Run(func(args mock.Arguments) {
+				deadline = args.Get(1).(time.Time)
+				close(done)
+			})
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			assert.WithinDuration(context, time.Now().Add(time.Minute), deadline, 10*time.Second)
+		})
+
+		It("should grant the task a lease that expires unless it is renewed", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			config := &model.Config{
+				Manager: model.ManagerInfo{ExecutionQueueSize: 2, LeaseDuration: model.Duration{Duration: time.Minute}},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			spec := &model.Spec{Image: "alpine"}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+			var leaseUntil time.Time
+			taskStoreMock.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.AnythingOfType("time.Time")).
+				Return(nil).Run(func(args mock.Arguments) {
+				leaseUntil = args.Get(1).(time.Time)
+				close(done)
+			})
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			assert.WithinDuration(context, time.Now().Add(time.Minute), leaseUntil, 10*time.Second)
+		})
+
+		It("should not publish work, and put the task back on the task queue, if the task cannot be scheduled", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(&model.Spec{}, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(errors.New("error"))
+			taskStoreMock.On("PushTask", mock.AnythingOfType("*uuid.UUID")).Return(int64(1), nil).
+				Run(func(args mock.Arguments) { close(done) })
 
 			// Act
 			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
 			quit <- 1
+			eventManagerMock.AssertNotCalled(context, "PublishWork", mock.Anything)
+			taskStoreMock.AssertNumberOfCalls(context, "PopTask", 1)
+		})
+
+		It("should drop a task that is no longer queued", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("PopTask").Return(&id, nil).Once()
+			taskStoreMock.On("PopTask").Return(nil, nil).Run(func(args mock.Arguments) { close(done) }).Once()
+			taskStoreMock.On("PopTask").Return(nil, nil)
+			taskStoreMock.On("GetTask", &id).Return(&model.Spec{ID: &id}, nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateScheduled).
+				Return(&task.InvalidTransitionError{ID: &id, From: model.StateCancelled, To: model.StateScheduled})
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			eventManagerMock.AssertNotCalled(context, "PublishWork", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "PushTask", mock.Anything)
+		})
+
+		It("should schedule every queued task while there is capacity", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			first := uuid.Must(uuid.NewV4())
+			second := uuid.Must(uuid.NewV4())
+			spec := &model.Spec{Image: "alpine"}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("PopTask").Return(&first, nil).Once()
+			taskStoreMock.On("PopTask").Return(&second, nil).Once()
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", &first, mock.Anything).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", &second, mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "AddTaskToExecutingSet", &first, mock.Anything)
+			taskStoreMock.AssertCalled(context, "AddTaskToExecutingSet", &second, mock.Anything)
+			taskStoreMock.AssertNumberOfCalls(context, "PopTask", 2)
+		})
+
+		It("should take back the lease and move the task back to queued if publishing work fails", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			givenQueuedTask(taskStoreMock)
+			taskStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(&model.Spec{}, nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil)
+			eventManagerMock.On("PublishWork", mock.Anything).Return(errors.New("error"))
+			taskStoreMock.On("RemoveTaskFromExecutingSet", mock.AnythingOfType("*uuid.UUID")).Return(nil)
+			taskStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateQueued).Return(nil)
+			taskStoreMock.On("PushTask", mock.AnythingOfType("*uuid.UUID")).Return(int64(1), nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "RemoveTaskFromExecutingSet", mock.AnythingOfType("*uuid.UUID"))
+			taskStoreMock.AssertNumberOfCalls(context, "PopTask", 1)
+		})
+	})
+
+	Describe("admitting tasks by their resources", func() {
+		BeforeEach(func() {
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TaskQueueSize:      1,
+					Resources:          model.Resources{model.ResourceCPU: 4000},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+		})
+
+		It("should reserve a task's resources before publishing work", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			spec := &model.Spec{ID: &id, Resources: model.Resources{model.ResourceCPU: 1000}}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("PopTask").Return(&id, nil).Once()
+			taskStoreMock.On("PopTask").Return(nil, nil)
+			taskStoreMock.On("GetTask", &id).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateScheduled).Return(nil)
+			taskStoreMock.On("ReserveResources", &id, spec.Resources, model.Resources{model.ResourceCPU: 4000}).
+				Return(true, nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+			taskStoreMock.On("AddTaskToExecutingSet", &id, mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "ReserveResources", &id, spec.Resources, mock.Anything)
+		})
+
+		It("should put a task whose resources are not free back at the front of the queue", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			spec := &model.Spec{ID: &id, Resources: model.Resources{model.ResourceCPU: 3000}}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("PopTask").Return(&id, nil).Once()
+			taskStoreMock.On("PopTask").Return(nil, nil)
+			taskStoreMock.On("GetTask", &id).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateScheduled).Return(nil)
+			taskStoreMock.On("ReserveResources", &id, spec.Resources, mock.Anything).Return(false, nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateQueued).Return(nil)
+			taskStoreMock.On("ReturnTask", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			eventManagerMock.AssertNotCalled(context, "PublishWork", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "PushTask", mock.Anything)
+		})
+
+		It("should fail a task that requests more than the pool has", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			spec := &model.Spec{ID: &id, Resources: model.Resources{model.ResourceMemory: 512}}
+			var info *model.Info
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("PopTask").Return(&id, nil).Once()
+			taskStoreMock.On("PopTask").Return(nil, nil)
+			taskStoreMock.On("GetTask", &id).Return(spec, nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateScheduled).Return(nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { info = args.Get(0).(*model.Info) })
+			taskStoreMock.On("TransitionTask", &id, model.StateFailed).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "ReserveResources", mock.Anything, mock.Anything, mock.Anything)
+			eventManagerMock.AssertNotCalled(context, "PublishWork", mock.Anything)
+			assert.False(context, info.Succeeded)
+			assert.NotNil(context, info.FailureStats)
+		})
+	})
+
+	Describe("manage task progress", func() {
+		var infoCh chan model.Info
+
+		BeforeEach(func() {
+			infoCh = make(chan model.Info, 1)
+			eventManagerMock = &mocks.EventManager{}
+			eventManagerMock.On("ListenForProgress", mock.Anything).Return((<-chan model.Info)(infoCh), nil)
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, &model.Config{})
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(0), nil)
+			taskStoreMock.On("RenewLease", mock.Anything, "worker-1", time.Time{}).Return(&model.Lease{Worker: "worker-1"}, nil)
+		})
+
+		It("should record progress and move the task to running without freeing its slot", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			percent := 40.0
+			taskStoreMock.On("TransitionTaskFrom", &id, model.StateScheduled, model.StateRunning).Return(nil)
+			taskStoreMock.On("UpdateTaskProgress", mock.Anything, mock.AnythingOfType("time.Time")).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Status: model.InfoProgress, Percent: &percent, Phase: "compiling"}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTaskFrom", &id, model.StateScheduled, model.StateRunning)
+			taskStoreMock.AssertNotCalled(context, "RemoveTaskFromExecutingSet", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskInfo", mock.Anything)
+		})
+
+		It("should ignore progress of a task that has completed", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("TransitionTaskFrom", &id, model.StateScheduled, model.StateRunning).
+				Return(&task.InvalidTransitionError{ID: &id, From: model.StateSucceeded, To: model.StateRunning}).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Status: model.InfoStarted}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskProgress", mock.Anything, mock.Anything)
+		})
+
+		It("should move a successful task to succeeded and free its slot", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateSucceeded).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateSucceeded)
+			taskStoreMock.AssertCalled(context, "RecordTaskEvent", &id, mock.MatchedBy(func(event *model.Event) bool {
+				return event.Type == model.EventCompleted && event.State == model.StateSucceeded && event.Source == model.SourceWorker
+			}))
+			taskStoreMock.AssertCalled(context, "ScheduleCallback", &id, mock.AnythingOfType("time.Time"))
+		})
+
+		It("should queue the children of a successful task once their parents have all succeeded", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			childID := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateSucceeded).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{&childID}, nil)
+			taskStoreMock.On("ResolveTaskDependency", &childID, &id).Return(int64(0), nil)
+			taskStoreMock.On("GetTask", &childID).Return(&model.Spec{}, nil)
+			taskStoreMock.On("TransitionTaskFrom", &childID, model.StateBlocked, model.StateQueued).Return(nil)
+			taskStoreMock.On("PushTask", &childID).Return(int64(1), nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "PushTask", &childID)
+		})
+
+		It("should skip the children of a task the worker stopped", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			childID := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateCancelled).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{&childID}, nil)
+			taskStoreMock.On("TransitionTaskFrom", &childID, model.StateBlocked, model.StateSkipped).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &childID).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Cancelled: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTaskFrom", &childID, model.StateBlocked, model.StateSkipped)
+			taskStoreMock.AssertNotCalled(context, "ResolveTaskDependency", mock.Anything, mock.Anything)
+		})
+
+		It("should move a task the worker stopped to cancelled", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateCancelled).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Cancelled: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateCancelled)
+		})
+
+		It("should move a failed task to failed and free its slot even if the transition is rejected", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(1), nil)
+			taskStoreMock.On("GetTask", &id).Return(&model.Spec{}, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateFailed).Return(errors.New("error"))
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: false}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateFailed)
+		})
+
+		It("should delay a failed task for a retry if it has attempts left", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			spec := &model.Spec{Retry: &model.RetryPolicy{MaxAttempts: 2, InitialBackoff: model.Duration{Duration: time.Minute}}}
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(1), nil)
+			taskStoreMock.On("GetTask", &id).Return(spec, nil)
+			var retryAt time.Time
+			taskStoreMock.On("DelayTask", &id, mock.AnythingOfType("time.Time")).Return(nil).
+				Run(func(args mock.Arguments) { retryAt = args.Get(1).(time.Time) })
+			taskStoreMock.On("TransitionTask", &id, model.StateDelayed).Return(nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: false}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskInfo", mock.Anything)
+			assert.WithinDuration(context, time.Now().Add(time.Minute), retryAt, 10*time.Second)
+		})
+
+		It("should drop the result sent by a worker that no longer holds the task's lease", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("RenewLease", &id, "worker-2", time.Time{}).Return(nil, &task.LeaseLostError{ID: &id}).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-2", Succeeded: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskInfo", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "TransitionTask", mock.Anything, mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "RemoveTaskFromExecutingSet", mock.Anything)
+		})
+
+		It("should drop the progress sent by a worker other than the one holding the task's lease", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("RenewLease", &id, "worker-2", time.Time{}).Return(nil, &task.LeaseHeldError{ID: &id, Worker: "worker-2"}).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-2", Status: model.InfoStarted}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "TransitionTaskFrom", mock.Anything, mock.Anything, mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskProgress", mock.Anything, mock.Anything)
+		})
+
+		It("should complete a task whose result does not name the worker that sent it", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetLease", &id).Return(&model.Lease{TaskID: &id}, nil)
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateScheduled, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateSucceeded).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Succeeded: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateSucceeded)
+			taskStoreMock.AssertNotCalled(context, "RenewLease", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		It("should drop a result that does not name its worker while another worker holds the task's lease", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			expiresAt := time.Now().Add(time.Minute)
+			taskStoreMock.On("GetLease", &id).Return(&model.Lease{TaskID: &id, Worker: "worker-2", ExpiresAt: &expiresAt}, nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Succeeded: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskInfo", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "TransitionTask", mock.Anything, mock.Anything)
+		})
+
+		It("should ignore a failure reported for a task that is no longer executing", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateDelayed, nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: false}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "RecordTaskAttempt", mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "DelayTask", mock.Anything, mock.Anything)
+			taskStoreMock.AssertNotCalled(context, "UpdateTaskInfo", mock.Anything)
+		})
+
+		It("should fail a task that has used up its attempts", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			spec := &model.Spec{Retry: &model.RetryPolicy{MaxAttempts: 2}}
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(2), nil)
+			taskStoreMock.On("GetTask", &id).Return(spec, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateFailed).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: false}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "DelayTask", &id, mock.Anything)
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateFailed)
+		})
+	})
+
+	Describe("reaping tasks", func() {
+		It("should expire tasks that have run past their deadline and free their slot", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{&id}, nil).Once()
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{}, nil)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(1), nil)
+			taskStoreMock.On("GetTask", &id).Return(&model.Spec{}, nil)
+			var info *model.Info
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { info = args.Get(0).(*model.Info) })
+			taskStoreMock.On("TransitionTask", &id, model.StateExpired).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			assert.False(context, info.Succeeded)
+			assert.Equal(context, "timeout", info.FailureStats.Name)
+			assert.Equal(context, "DeadlineExceeded", info.FailureStats.Reason)
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateExpired)
+		})
+
+		It("should return a task whose lease has expired to the task queue if it may be retried", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			spec := &model.Spec{Retry: &model.RetryPolicy{MaxAttempts: 2}}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{&id}, nil).Once()
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{}, nil)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+			var attempt *model.Info
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(1), nil).
+				Run(func(args mock.Arguments) { attempt = args.Get(0).(*model.Info) })
+			taskStoreMock.On("GetTask", &id).Return(spec, nil)
+			taskStoreMock.On("DelayTask", &id, mock.AnythingOfType("time.Time")).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateDelayed).Return(nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			assert.Equal(context, "LeaseExpired", attempt.FailureStats.Reason)
+			taskStoreMock.AssertNotCalled(context, "TransitionTask", &id, model.StateFailed)
+		})
+
+		It("should expire a task whose lease has expired if it may not be retried", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{&id}, nil).Once()
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{}, nil)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(1), nil)
+			taskStoreMock.On("GetTask", &id).Return(&model.Spec{}, nil)
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			taskStoreMock.On("TransitionTask", &id, model.StateExpired).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "TransitionTask", &id, model.StateExpired)
+			taskStoreMock.AssertNotCalled(context, "TransitionTask", &id, model.StateFailed)
+		})
+
+		It("should fail the executing tasks of a worker whose heartbeat has lapsed", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			taskStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			finished := uuid.Must(uuid.NewV4())
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+					WorkerTimeout:      model.Duration{Duration: time.Minute},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			worker := &model.Worker{ID: "worker-1", Tasks: []*uuid.UUID{&finished, &id}}
+			var since time.Time
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{worker}, nil).
+				Run(func(args mock.Arguments) { since = args.Get(0).(time.Time) }).Once()
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{}, nil)
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+			taskStoreMock.On("IsTaskExecuting", &finished).Return(false, nil)
+			taskStoreMock.On("IsTaskExecuting", &id).Return(true, nil)
+			taskStoreMock.On("RecordTaskAttempt", mock.Anything).Return(int64(1), nil)
+			taskStoreMock.On("GetTask", &id).Return(&model.Spec{}, nil)
+			var info *model.Info
+			taskStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { info = args.Get(0).(*model.Info) })
+			taskStoreMock.On("TransitionTask", &id, model.StateFailed).Return(nil)
+			taskStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			assert.WithinDuration(context, time.Now().Add(-time.Minute), since, 10*time.Second)
+			assert.Equal(context, "WorkerLost", info.FailureStats.Reason)
+			taskStoreMock.AssertNotCalled(context, "RemoveTaskFromExecutingSet", &finished)
+		})
+	})
+
+	Describe("manage delayed tasks", func() {
+		It("should queue delayed tasks once they are due and announce them as created", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{&id}, nil).Once()
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{}, nil)
+			taskStoreMock.On("TransitionTaskFrom", &id, model.StateDelayed, model.StateQueued).Return(nil)
+			taskStoreMock.On("PushTask", &id).Return(int64(1), nil)
+			taskStoreMock.On("PublishTaskCreatedEvent", &id).Return().
+				Run(func(args mock.Arguments) { close(done) })
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertCalled(context, "PushTask", &id)
+		})
+
+		It("should not queue a due task that is no longer delayed", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			config := &model.Config{
+				Manager: model.ManagerInfo{
+					ExecutionQueueSize: 2,
+					TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("PopExpiredTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopExpiredLeases", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{&id}, nil).Once()
+			taskStoreMock.On("PopDueTasks", mock.AnythingOfType("time.Time")).Return([]*uuid.UUID{}, nil)
+			taskStoreMock.On("PopLapsedWorkers", mock.AnythingOfType("time.Time")).Return([]*model.Worker{}, nil)
+			taskStoreMock.On("TransitionTaskFrom", &id, model.StateDelayed, model.StateQueued).
+				Return(errors.New("error")).Run(func(args mock.Arguments) { close(done) })
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "PushTask", &id)
+		})
+	})
+
+	Describe("managing namespaces", func() {
+		var namespaceStoreMock *mocks.Store
+		var infoCh chan model.Info
+
+		BeforeEach(func() {
+			taskStoreMock = &mocks.Store{}
+			namespaceStoreMock = &mocks.Store{}
+			infoCh = make(chan model.Info, 1)
+			eventManagerMock = &mocks.EventManager{}
+			eventManagerMock.On("ListenForProgress", mock.Anything).Return((<-chan model.Info)(infoCh), nil)
+			config := &model.Config{
+				Manager: model.ManagerInfo{ExecutionQueueSize: 4},
+				Namespaces: map[string]model.NamespaceInfo{
+					"default": {ExecutionQueueSize: 2},
+					"team-a":  {ExecutionQueueSize: 1},
+				},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			taskStoreMock.On("ListNamespaces").Return([]string{"team-a"}, nil)
+			taskStoreMock.On("Namespace").Return("")
+			taskStoreMock.On("InNamespace", "team-a").Return(namespaceStoreMock)
+			for _, store := range []*mocks.Store{taskStoreMock, namespaceStoreMock} {
+				store.On("RecordTaskEvent", mock.Anything, mock.Anything).Return(nil)
+				store.On("ScheduleCallback", mock.Anything, mock.Anything).Return(false, nil)
+			}
+			namespaceStoreMock.On("Namespace").Return("team-a")
+		})
+
+		It("should dispatch the tasks of each namespace within the namespace's limit", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			spec := &model.Spec{Image: "alpine"}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+			namespaceStoreMock.On("ExecutingSetSize").Return(int64(0), nil).Once()
+			namespaceStoreMock.On("ExecutingSetSize").Return(int64(1), nil)
+			givenQueuedTask(namespaceStoreMock)
+			namespaceStoreMock.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+			namespaceStoreMock.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+			namespaceStoreMock.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "PopTask")
+			namespaceStoreMock.AssertNumberOfCalls(context, "PopTask", 1)
+		})
+
+		It("should share execution capacity between namespaces by their weights", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			config := &model.Config{
+				Manager:    model.ManagerInfo{ExecutionQueueSize: 4},
+				Namespaces: map[string]model.NamespaceInfo{"team-a": {Weight: 3}},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			spec := &model.Spec{Image: "alpine"}
+			dispatched := 0
+			countDispatch := func(args mock.Arguments) {
+				dispatched++
+				if dispatched == 4 {
+					close(done)
+				}
+			}
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			for _, store := range []*mocks.Store{taskStoreMock, namespaceStoreMock} {
+				store.On("ExecutingSetSize").Return(int64(0), nil)
+				store.On("PopTask").Return(func() *uuid.UUID { id := uuid.Must(uuid.NewV4()); return &id }, nil)
+				store.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+				store.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+				store.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil).Run(countDispatch)
+			}
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNumberOfCalls(context, "PopTask", 1)
+			namespaceStoreMock.AssertNumberOfCalls(context, "PopTask", 3)
+		})
+
+		It("should keep the credit a namespace has left when its turn ends with tasks still queued", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			config := &model.Config{
+				Manager:    model.ManagerInfo{ExecutionQueueSize: 6},
+				Namespaces: map[string]model.NamespaceInfo{"team-a": {Weight: 3}},
+			}
+			taskManager = manager.NewTaskManagerImpl(taskStoreMock, eventManagerMock, config)
+			spec := &model.Spec{Image: "alpine"}
+			dispatched := 0
+			countDispatch := func(args mock.Arguments) {
+				dispatched++
+				if dispatched == 6 {
+					close(done)
+				}
+			}
+			newID := func() *uuid.UUID { id := uuid.Must(uuid.NewV4()); return &id }
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(buildCreatedTasksCh())
+			namespaceStoreMock.On("PopTask").Return(newID, nil).Once()
+			namespaceStoreMock.On("PopTask").Return(nil, errors.New("error")).Once()
+			for _, store := range []*mocks.Store{taskStoreMock, namespaceStoreMock} {
+				store.On("ExecutingSetSize").Return(int64(0), nil)
+				store.On("PopTask").Return(newID, nil)
+				store.On("GetTask", mock.AnythingOfType("*uuid.UUID")).Return(spec, nil)
+				store.On("TransitionTask", mock.AnythingOfType("*uuid.UUID"), model.StateScheduled).Return(nil)
+				store.On("AddTaskToExecutingSet", mock.AnythingOfType("*uuid.UUID"), mock.Anything).Return(nil).Run(countDispatch)
+			}
+			eventManagerMock.On("PublishWork", spec).Return(nil)
+
+			// Act
+			taskManager.ManageTasks(quit)
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNumberOfCalls(context, "AddTaskToExecutingSet", 3)
+			namespaceStoreMock.AssertNumberOfCalls(context, "AddTaskToExecutingSet", 3)
+		})
+
+		It("should complete a task in the namespace it was created in", func() {
+			// Arrange
+			defer close(quit)
+			done := make(chan bool)
+			id := uuid.Must(uuid.NewV4())
+			namespaceStoreMock.On("GetTaskState", &id).Return(model.StateRunning, nil)
+			namespaceStoreMock.On("RenewLease", &id, "worker-1", time.Time{}).Return(&model.Lease{Worker: "worker-1"}, nil)
+			taskStoreMock.On("ListenForTaskCreatedEvents").Return(nil)
+			taskStoreMock.On("ExecutingSetSize").Return(int64(2), nil)
+			taskStoreMock.On("GetTaskNamespace", &id).Return("team-a", nil)
+			namespaceStoreMock.On("ExecutingSetSize").Return(int64(1), nil)
+			namespaceStoreMock.On("UpdateTaskInfo", mock.Anything).Return(nil)
+			namespaceStoreMock.On("TransitionTask", &id, model.StateSucceeded).Return(nil)
+			namespaceStoreMock.On("GetTaskChildren", &id).Return([]*uuid.UUID{}, nil)
+			namespaceStoreMock.On("RemoveTaskFromExecutingSet", &id).Return(nil).
+				Run(func(args mock.Arguments) { close(done) })
+
+			// Act
+			taskManager.ManageTasks(quit)
+			infoCh <- model.Info{ID: &id, Worker: "worker-1", Succeeded: true}
+
+			// Assert
+			waitFor(done)
+			quit <- 1
+			taskStoreMock.AssertNotCalled(context, "TransitionTask", mock.Anything, mock.Anything)
 		})
 	})
 })
 
+func waitFor(done <-chan bool) {
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(context, "Timed out waiting for the manager to act")
+	}
+}
+
+func givenQueuedTask(taskStoreMock *mocks.Store) {
+	givenID := uuid.Must(uuid.NewV4())
+	taskStoreMock.On("PopTask").Return(&givenID, nil).Once()
+	taskStoreMock.On("PopTask").Return(nil, nil)
+}
+
 func buildCreatedTasksCh() <-chan *uuid.UUID {
 	givenID := uuid.Must(uuid.NewV4())
 	createdTasks := make(chan *uuid.UUID, 1)
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	"time"
+)
+
+// promoteDelayedTasks : periodically move delayed tasks that are due onto the task queue.
+// This runs apart from the main manager loop so that announcing the promoted tasks
+// as created cannot block the loop that consumes those announcements
+func (t *TaskManagerImpl) promoteDelayedTasks(quit <-chan int) {
+	ticker := time.NewTicker(t.tickInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.promoteDueTasks()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// promoteDueTasks : put delayed tasks that are due on the task queue of every namespace
+func (t *TaskManagerImpl) promoteDueTasks() {
+	for _, store := range t.stores() {
+		promoteDueTasksIn(store)
+	}
+}
+
+func promoteDueTasksIn(store task.Store) {
+	ids, err := store.PopDueTasks(time.Now())
+	if err != nil {
+		fmt.Printf("Failed to retrieve due tasks: %s\n", err.Error())
+		return
+	}
+
+	for _, taskID := range ids {
+		err = store.TransitionTaskFrom(taskID, model.StateDelayed, model.StateQueued)
+		if err != nil {
+			fmt.Printf("Not queueing due task %s: %s\n", taskID.String(), err.Error())
+			continue
+		}
+
+		_, err = store.PushTask(taskID)
+		if err != nil {
+			fmt.Printf("Failed to queue due task %s: %s\n", taskID.String(), err.Error())
+			continue
+		}
+
+		task.RecordEvent(store, taskID, &model.Event{Type: model.EventQueued, Source: model.SourceManager,
+			State: model.StateQueued, Message: "due"})
+		store.PublishTaskCreatedEvent(taskID)
+	}
+}
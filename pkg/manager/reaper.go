@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	"time"
+)
+
+const timeoutFailureType = "task"
+const timeoutFailureName = "timeout"
+const timeoutFailureReason = "DeadlineExceeded"
+const leaseFailureName = "lease"
+const leaseFailureReason = "LeaseExpired"
+const workerLostFailureType = "worker"
+const workerLostFailureName = "heartbeat"
+const workerLostFailureReason = "WorkerLost"
+const defaultWorkerTimeout = 30 * time.Second
+
+// reapExpiredTasks : expire executing tasks whose lease has expired or that have run past their deadline,
+// most likely because their worker died, so that their slot is released
+func (t *TaskManagerImpl) reapExpiredTasks() {
+	for _, store := range t.stores() {
+		t.reapExpiredTasksIn(store)
+	}
+}
+
+func (t *TaskManagerImpl) reapExpiredTasksIn(store task.Store) {
+	t.reapExpiredLeasesIn(store)
+
+	ids, err := store.PopExpiredTasks(time.Now())
+	if err != nil {
+		fmt.Printf("Failed to retrieve expired tasks: %s\n", err.Error())
+		return
+	}
+
+	for _, taskID := range ids {
+		fmt.Printf("Task %s has run past its deadline, reaping it\n", taskID.String())
+		info := &model.Info{
+			ID:        taskID,
+			Succeeded: false,
+			FailureStats: &model.FailureStatus{
+				Type:    timeoutFailureType,
+				Name:    timeoutFailureName,
+				Reason:  timeoutFailureReason,
+				Message: "task did not complete before its deadline",
+			},
+		}
+		t.expireTask(store, info)
+	}
+}
+
+// reapExpiredLeasesIn : expire executing tasks whose worker has stopped renewing their lease,
+// which returns them to the task queue if their retry policy allows
+func (t *TaskManagerImpl) reapExpiredLeasesIn(store task.Store) {
+	ids, err := store.PopExpiredLeases(time.Now())
+	if err != nil {
+		fmt.Printf("Failed to retrieve expired leases: %s\n", err.Error())
+		return
+	}
+
+	for _, taskID := range ids {
+		fmt.Printf("The lease of task %s has expired, reaping it\n", taskID.String())
+		info := &model.Info{
+			ID:        taskID,
+			Succeeded: false,
+			FailureStats: &model.FailureStatus{
+				Type:    workerLostFailureType,
+				Name:    leaseFailureName,
+				Reason:  leaseFailureReason,
+				Message: "task lease was not renewed before it expired",
+			},
+		}
+		t.expireTask(store, info)
+	}
+}
+
+// reapLapsedWorkers : forget the workers that have stopped sending heartbeats and fail the
+// tasks they were executing, which are retried if their retry policy allows
+func (t *TaskManagerImpl) reapLapsedWorkers() {
+	workers, err := t.store.PopLapsedWorkers(time.Now().Add(-t.workerTimeout()))
+	if err != nil {
+		fmt.Printf("Failed to retrieve lapsed workers: %s\n", err.Error())
+		return
+	}
+
+	for _, worker := range workers {
+		fmt.Printf("Worker %s has not sent a heartbeat since %s, reaping its tasks\n", worker.ID, worker.LastHeartbeat)
+		for _, taskID := range worker.Tasks {
+			store, err := t.storeFor(taskID)
+			if err != nil {
+				fmt.Printf("Failed to find the namespace of task %s: %s\n", taskID.String(), err.Error())
+				continue
+			}
+			executing, err := store.IsTaskExecuting(taskID)
+			if err != nil {
+				fmt.Printf("Failed to check whether task %s is executing: %s\n", taskID.String(), err.Error())
+				continue
+			}
+			if !executing {
+				continue
+			}
+
+			info := &model.Info{
+				ID:        taskID,
+				Succeeded: false,
+				FailureStats: &model.FailureStatus{
+					Type:    workerLostFailureType,
+					Name:    workerLostFailureName,
+					Reason:  workerLostFailureReason,
+					Message: fmt.Sprintf("worker %s stopped sending heartbeats", worker.ID),
+				},
+			}
+			t.completeTask(store, model.SourceManager, info)
+		}
+	}
+}
+
+// workerTimeout : how long a worker may go without a heartbeat before it is considered lost
+func (t *TaskManagerImpl) workerTimeout() time.Duration {
+	if timeout := t.config.Manager.WorkerTimeout.Duration; timeout > 0 {
+		return timeout
+	}
+	return defaultWorkerTimeout
+}
+
+// leaseExpiry : when the lease of a task dispatched at the given time expires, zero if it never does
+func (t *TaskManagerImpl) leaseExpiry(now time.Time) time.Time {
+	if duration := t.config.Manager.LeaseDuration.Duration; duration > 0 {
+		return now.Add(duration)
+	}
+	return time.Time{}
+}
+
+// timeoutFor : the time the given task may execute for, zero if it may execute forever
+func (t *TaskManagerImpl) timeoutFor(taskSpec *model.Spec) time.Duration {
+	if taskSpec.Timeout != nil {
+		return taskSpec.Timeout.Duration
+	}
+	return t.config.Manager.DefaultTimeout.Duration
+}
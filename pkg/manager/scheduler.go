@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/schedule"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// scheduleMetadataKey : the metadata key a scheduled task's schedule id is recorded under
+const scheduleMetadataKey = "schedule"
+
+// maxPendingRuns : the most runs a schedule queues behind a run that is still in progress
+const maxPendingRuns = 100
+
+// Scheduler : start tasks from recurring schedules
+type Scheduler interface {
+	ScheduleTasks(quit <-chan int)
+}
+
+// SchedulerImpl : a scheduler impl
+type SchedulerImpl struct {
+	scheduleStore schedule.Store
+	store         task.Store
+	config        *model.Config
+}
+
+// NewSchedulerImpl : create a new scheduler impl
+func NewSchedulerImpl(scheduleStore schedule.Store, store task.Store, config *model.Config) *SchedulerImpl {
+	return &SchedulerImpl{scheduleStore, store, config}
+}
+
+// ScheduleTasks : start the runs of every schedule as they fall due.
+// This runs alongside the task manager, which picks the runs up as ordinary created tasks
+func (s *SchedulerImpl) ScheduleTasks(quit <-chan int) {
+	ticker := time.NewTicker(tickInterval(s.config))
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.runDueSchedules(time.Now())
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// runDueSchedules : start the runs of every schedule that are due at the given time
+func (s *SchedulerImpl) runDueSchedules(now time.Time) {
+	schedules, err := s.scheduleStore.ListSchedules()
+	if err != nil {
+		fmt.Printf("Failed to retrieve schedules: %s\n", err.Error())
+		return
+	}
+
+	for _, sched := range schedules {
+		s.runSchedule(sched, now)
+	}
+}
+
+// runSchedule : start the given schedule's due and pending runs, following its overlap policy
+func (s *SchedulerImpl) runSchedule(sched *model.Schedule, now time.Time) {
+	due, next, err := schedule.DueRuns(sched, now)
+	if err != nil {
+		fmt.Printf("Failed to evaluate schedule %s: %s\n", sched.ID.String(), err.Error())
+		return
+	}
+	if len(due) == 0 && sched.Pending == 0 && sched.NextRun != nil && next.Equal(*sched.NextRun) {
+		return
+	}
+
+	runs := len(due) + sched.Pending
+	sched.Pending = 0
+	for i := 0; i < runs; i++ {
+		if sched.Overlap != model.OverlapAllow && s.inProgress(sched) {
+			if sched.Overlap == model.OverlapQueue {
+				sched.Pending = runs - i
+				if sched.Pending > maxPendingRuns {
+					sched.Pending = maxPendingRuns
+				}
+			} else {
+				fmt.Printf("Skipping run of schedule %s, task %s is still in progress\n", sched.ID.String(), sched.LastTaskID.String())
+			}
+			break
+		}
+
+		taskID, err := s.startRun(sched)
+		if err != nil {
+			fmt.Printf("Failed to start run of schedule %s: %s\n", sched.ID.String(), err.Error())
+			break
+		}
+		sched.LastTaskID = taskID
+	}
+
+	sched.NextRun = &next
+	err = s.scheduleStore.UpdateSchedule(sched)
+	if err != nil {
+		fmt.Printf("Failed to update schedule %s: %s\n", sched.ID.String(), err.Error())
+	}
+}
+
+// inProgress : true if the schedule's previous run has not completed
+func (s *SchedulerImpl) inProgress(sched *model.Schedule) bool {
+	if sched.LastTaskID == nil {
+		return false
+	}
+	state, err := s.store.GetTaskState(sched.LastTaskID)
+	if err != nil {
+		fmt.Printf("Failed to retrieve state of task %s: %s\n", sched.LastTaskID.String(), err.Error())
+		return false
+	}
+	return state != "" && !state.IsTerminal()
+}
+
+// startRun : create and queue a task from the schedule's template
+func (s *SchedulerImpl) startRun(sched *model.Schedule) (*uuid.UUID, error) {
+	taskSpec := sched.Template
+	taskSpec.ID = nil
+	taskSpec.Metadata = make(map[string]string, len(sched.Template.Metadata)+1)
+	for key, value := range sched.Template.Metadata {
+		taskSpec.Metadata[key] = value
+	}
+	taskSpec.Metadata[scheduleMetadataKey] = sched.ID.String()
+
+	created, err := s.store.CreateTask(taskSpec, s.config.TaskQueueSizeFor(s.store.Namespace()), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	taskID := created.ID
+	fmt.Printf("Task %s created from schedule %s\n", taskID.String(), sched.ID.String())
+	task.RecordEvent(s.store, taskID, &model.Event{Type: model.EventCreated, Source: model.SourceScheduler,
+		State: created.State, Message: "run of schedule " + sched.ID.String()})
+	if created.State == model.StateQueued {
+		s.store.PublishTaskCreatedEvent(taskID)
+	}
+	return taskID, nil
+}
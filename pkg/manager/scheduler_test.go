@@ -0,0 +1,182 @@
+package manager_test
+
+import (
+	"github.com/execd/task-store/mocks"
+	"github.com/execd/task-store/pkg/manager"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+var _ = Describe("schedule tasks", func() {
+	var scheduleStoreMock *mocks.ScheduleStore
+	var taskStoreMock *mocks.Store
+	var scheduler *manager.SchedulerImpl
+	var givenSchedule *model.Schedule
+	var updated chan model.Schedule
+	var quit chan int
+
+	BeforeEach(func() {
+		scheduleStoreMock = &mocks.ScheduleStore{}
+		taskStoreMock = &mocks.Store{}
+		config := &model.Config{
+			Manager: model.ManagerInfo{
+				ExecutionQueueSize: 2,
+				TaskQueueSize:      1,
+				TickInterval:       model.Duration{Duration: 10 * time.Millisecond},
+			},
+		}
+		scheduler = manager.NewSchedulerImpl(scheduleStoreMock, taskStoreMock, config)
+		taskStoreMock.On("RecordTaskEvent", mock.Anything, mock.Anything).Return(nil)
+		taskStoreMock.On("Namespace").Return("")
+
+		givenID := uuid.Must(uuid.NewV4())
+		nextRun := time.Now().Truncate(time.Minute)
+		givenSchedule = &model.Schedule{
+			ID:       &givenID,
+			Cron:     "* * * * *",
+			Template: model.Spec{Image: "alpine", Metadata: map[string]string{"team": "build"}},
+			Overlap:  model.OverlapSkip,
+			CatchUp:  model.CatchUpSkip,
+			NextRun:  &nextRun,
+		}
+		scheduleStoreMock.On("ListSchedules").Return([]*model.Schedule{givenSchedule}, nil)
+
+		// the scheduler of a previous test may still be finishing a tick, so it must not see this channel
+		updates := make(chan model.Schedule, 1)
+		updated = updates
+		scheduleStoreMock.On("UpdateSchedule", mock.AnythingOfType("*model.Schedule")).Return(nil).Run(func(args mock.Arguments) {
+			select {
+			case updates <- *args.Get(0).(*model.Schedule):
+			default:
+			}
+		})
+		quit = make(chan int)
+	})
+
+	AfterEach(func() {
+		close(quit)
+	})
+
+	It("should start a task from the template of a due schedule", func() {
+		// Arrange
+		givenTaskID := uuid.Must(uuid.NewV4())
+		var stored model.Spec
+		taskStoreMock.On("CreateTask", mock.AnythingOfType("model.Spec"), int64(1), mock.AnythingOfType("time.Time")).Return(&task.CreatedTask{ID: &givenTaskID, State: model.StateQueued, QueueSize: 1}, nil).Run(func(args mock.Arguments) {
+			stored = args.Get(0).(model.Spec)
+		})
+		taskStoreMock.On("PublishTaskCreatedEvent", &givenTaskID)
+		previousRun := *givenSchedule.NextRun
+
+		// Act
+		scheduler.ScheduleTasks(quit)
+		update := waitForUpdate(updated)
+
+		// Assert
+		assert.Equal(context, "alpine", stored.Image)
+		assert.Equal(context, "build", stored.Metadata["team"])
+		assert.Equal(context, givenSchedule.ID.String(), stored.Metadata["schedule"])
+		assert.Equal(context, givenTaskID, *update.LastTaskID)
+		assert.Equal(context, previousRun.Add(time.Minute).UTC(), update.NextRun.UTC())
+		taskStoreMock.AssertCalled(context, "PublishTaskCreatedEvent", &givenTaskID)
+	})
+
+	It("should skip a run while the previous run is in progress", func() {
+		// Arrange
+		givenTaskID := uuid.Must(uuid.NewV4())
+		givenSchedule.LastTaskID = &givenTaskID
+		taskStoreMock.On("GetTaskState", &givenTaskID).Return(model.StateRunning, nil)
+
+		// Act
+		scheduler.ScheduleTasks(quit)
+		update := waitForUpdate(updated)
+
+		// Assert
+		assert.Equal(context, 0, update.Pending)
+		taskStoreMock.AssertNotCalled(context, "CreateTask", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	It("should hold a run back while the previous run is in progress when overlap is queue", func() {
+		// Arrange
+		givenTaskID := uuid.Must(uuid.NewV4())
+		givenSchedule.LastTaskID = &givenTaskID
+		givenSchedule.Overlap = model.OverlapQueue
+		taskStoreMock.On("GetTaskState", &givenTaskID).Return(model.StateQueued, nil)
+
+		// Act
+		scheduler.ScheduleTasks(quit)
+		update := waitForUpdate(updated)
+
+		// Assert
+		assert.Equal(context, 1, update.Pending)
+		taskStoreMock.AssertNotCalled(context, "CreateTask", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	It("should start a held back run once the previous run has completed", func() {
+		// Arrange
+		previousTaskID := uuid.Must(uuid.NewV4())
+		givenTaskID := uuid.Must(uuid.NewV4())
+		nextRun := time.Now().Add(time.Hour).Truncate(time.Minute)
+		givenSchedule.LastTaskID = &previousTaskID
+		givenSchedule.Overlap = model.OverlapQueue
+		givenSchedule.Pending = 1
+		givenSchedule.NextRun = &nextRun
+		taskStoreMock.On("GetTaskState", &previousTaskID).Return(model.StateSucceeded, nil)
+		taskStoreMock.On("CreateTask", mock.AnythingOfType("model.Spec"), int64(1), mock.AnythingOfType("time.Time")).Return(&task.CreatedTask{ID: &givenTaskID, State: model.StateQueued, QueueSize: 1}, nil)
+		taskStoreMock.On("PublishTaskCreatedEvent", &givenTaskID)
+
+		// Act
+		scheduler.ScheduleTasks(quit)
+		update := waitForUpdate(updated)
+
+		// Assert
+		assert.Equal(context, 0, update.Pending)
+		assert.Equal(context, givenTaskID, *update.LastTaskID)
+		assert.Equal(context, nextRun.UTC(), update.NextRun.UTC())
+	})
+
+	It("should start a run alongside the previous run when overlap is allow", func() {
+		// Arrange
+		previousTaskID := uuid.Must(uuid.NewV4())
+		givenTaskID := uuid.Must(uuid.NewV4())
+		givenSchedule.LastTaskID = &previousTaskID
+		givenSchedule.Overlap = model.OverlapAllow
+		taskStoreMock.On("CreateTask", mock.AnythingOfType("model.Spec"), int64(1), mock.AnythingOfType("time.Time")).Return(&task.CreatedTask{ID: &givenTaskID, State: model.StateQueued, QueueSize: 1}, nil)
+		taskStoreMock.On("PublishTaskCreatedEvent", &givenTaskID)
+
+		// Act
+		scheduler.ScheduleTasks(quit)
+		update := waitForUpdate(updated)
+
+		// Assert
+		assert.Equal(context, givenTaskID, *update.LastTaskID)
+		taskStoreMock.AssertNotCalled(context, "GetTaskState", mock.Anything)
+	})
+
+	It("should not start a run if the task queue is full", func() {
+		// Arrange
+		taskStoreMock.On("CreateTask", mock.AnythingOfType("model.Spec"), int64(1), mock.AnythingOfType("time.Time")).Return(nil, &task.TaskQueueFullError{Capacity: 1})
+
+		// Act
+		scheduler.ScheduleTasks(quit)
+		update := waitForUpdate(updated)
+
+		// Assert
+		assert.Nil(context, update.LastTaskID)
+		taskStoreMock.AssertNotCalled(context, "PublishTaskCreatedEvent", mock.Anything)
+	})
+})
+
+func waitForUpdate(updated <-chan model.Schedule) model.Schedule {
+	select {
+	case update := <-updated:
+		return update
+	case <-time.After(time.Second):
+		assert.Fail(context, "Timed out waiting for the scheduler to update the schedule")
+		return model.Schedule{}
+	}
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// CallbackSignatureHeader : the header a callback's signature is sent in
+const CallbackSignatureHeader = "X-Task-Store-Signature"
+
+// CallbackState : how far the delivery of a task's result to its callback url has got
+type CallbackState string
+
+const (
+	// CallbackPending : the result has yet to be delivered, a delivery is due at the next attempt
+	CallbackPending CallbackState = "pending"
+	// CallbackDelivered : the callback url accepted the result
+	CallbackDelivered CallbackState = "delivered"
+	// CallbackDead : every attempt at delivering the result failed, it will not be tried again
+	CallbackDead CallbackState = "dead"
+)
+
+// CallbackAttempt : the outcome of one attempt at delivering a task's result
+type CallbackAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"` // Status the callback url responded with, if it responded
+	Error      string    `json:"error,omitempty"`
+}
+
+// Succeeded : true if the callback url accepted the result
+func (a *CallbackAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// Callback : the delivery of a task's result to the callback url it was created with
+type Callback struct {
+	TaskID        *uuid.UUID        `json:"taskId"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"` // Body every attempt sends, fixed at the first attempt
+	State         CallbackState     `json:"state"`
+	Attempts      []CallbackAttempt `json:"attempts,omitempty"`
+	NextAttemptAt *time.Time        `json:"nextAttemptAt,omitempty"`
+}
+
+// MarshalBinary : marshals a Callback
+func (c *Callback) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// UnmarshalBinary : unmarshals a Callback
+func (c *Callback) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, c)
+}
+
+// CallbackPayload : the result posted to a task's callback url
+type CallbackPayload struct {
+	TaskID *uuid.UUID `json:"taskId"`
+	State  State      `json:"state"`
+	Info   *Info      `json:"info,omitempty"`
+}
+
+// SignCallback : the signature of the given payload under the given secret, sent in the
+// CallbackSignatureHeader so receivers can check the payload came from the task-store
+func SignCallback(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package model_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("callback", func() {
+	Describe("validating a spec with a callback", func() {
+		It("should accept an absolute http url with headers", func() {
+			spec := &model.Spec{CallbackURL: "https://example.com/done", CallbackHeaders: map[string]string{"Authorization": "Bearer x"}}
+
+			assert.Nil(context, spec.Validate())
+		})
+
+		It("should reject a url that is not absolute", func() {
+			spec := &model.Spec{CallbackURL: "/done"}
+
+			assert.NotNil(context, spec.Validate())
+		})
+
+		It("should reject a url that is not http", func() {
+			spec := &model.Spec{CallbackURL: "ftp://example.com/done"}
+
+			assert.NotNil(context, spec.Validate())
+		})
+
+		It("should reject headers without a url", func() {
+			spec := &model.Spec{CallbackHeaders: map[string]string{"Authorization": "Bearer x"}}
+
+			assert.NotNil(context, spec.Validate())
+		})
+
+		It("should reject a header that would replace the signature", func() {
+			spec := &model.Spec{CallbackURL: "https://example.com/done", CallbackHeaders: map[string]string{"x-task-store-signature": "forged"}}
+
+			assert.NotNil(context, spec.Validate())
+		})
+	})
+
+	It("should sign a payload with hmac sha256 of the secret", func() {
+		payload := []byte(`{"taskId":"x"}`)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(payload)
+
+		assert.Equal(context, "sha256="+hex.EncodeToString(mac.Sum(nil)), model.SignCallback("secret", payload))
+		assert.NotEqual(context, model.SignCallback("secret", payload), model.SignCallback("other", payload))
+	})
+
+	It("should only treat a 2xx response as a delivery", func() {
+		assert.True(context, (&model.CallbackAttempt{StatusCode: 204}).Succeeded())
+		assert.False(context, (&model.CallbackAttempt{StatusCode: 500}).Succeeded())
+		assert.False(context, (&model.CallbackAttempt{Error: "connection refused"}).Succeeded())
+	})
+
+	It("should fall back to defaults for delivery settings that are not configured", func() {
+		info := model.CallbackInfo{MaxAttempts: 3}
+
+		policy := info.RetryPolicy()
+
+		assert.Equal(context, 3, policy.MaxAttempts)
+		assert.Equal(context, 10*time.Second, policy.InitialBackoff.Duration)
+		assert.Equal(context, 10*time.Minute, policy.MaxBackoff.Duration)
+		assert.Equal(context, 10*time.Second, info.DeliveryTimeout())
+	})
+})
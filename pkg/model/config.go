@@ -1,12 +1,99 @@
 package model
 
+import "time"
+
 // Config : represents application configuration
 type Config struct {
-	Manager ManagerInfo
+	Manager    ManagerInfo
+	Namespaces map[string]NamespaceInfo
 }
 
 // ManagerInfo : config fo the manager section
 type ManagerInfo struct {
+	ExecutionQueueSize int64        `toml:"execution_queue_size"`
+	TaskQueueSize      int64        `toml:"task_queue_size"`
+	TickInterval       Duration     `toml:"tick_interval"`
+	DefaultTimeout     Duration     `toml:"default_timeout"`
+	IdempotencyWindow  Duration     `toml:"idempotency_window"`
+	WorkerTimeout      Duration     `toml:"worker_timeout"` // How long a worker may go without a heartbeat before its tasks are failed
+	LeaseDuration      Duration     `toml:"lease_duration"` // How long an executing task's lease lasts unless renewed, forever if zero
+	Resources          Resources    `toml:"resources"`      // Pool shared by executing tasks, tasks requesting no resources only need a slot
+	Callbacks          CallbackInfo `toml:"callbacks"`
+}
+
+// CallbackInfo : config for delivering the results of tasks to their callback urls
+type CallbackInfo struct {
+	Secret         string   `toml:"secret"`          // Key the results are signed with, tasks cannot ask for callbacks without one
+	MaxAttempts    int      `toml:"max_attempts"`    // Attempts at a delivery before it is dead-lettered, 5 if zero
+	InitialBackoff Duration `toml:"initial_backoff"` // Wait before the first redelivery, 10s if zero
+	MaxBackoff     Duration `toml:"max_backoff"`     // Upper bound for the wait between deliveries, 10m if zero
+	Timeout        Duration `toml:"timeout"`         // How long a delivery may take, 10s if zero
+}
+
+// RetryPolicy : how a delivery that failed is retried
+func (c CallbackInfo) RetryPolicy() *RetryPolicy {
+	policy := &RetryPolicy{
+		MaxAttempts:    c.MaxAttempts,
+		InitialBackoff: c.InitialBackoff,
+		MaxBackoff:     c.MaxBackoff,
+		Jitter:         0.1,
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 5
+	}
+	if policy.InitialBackoff.Duration <= 0 {
+		policy.InitialBackoff.Duration = 10 * time.Second
+	}
+	if policy.MaxBackoff.Duration <= 0 {
+		policy.MaxBackoff.Duration = 10 * time.Minute
+	}
+	return policy
+}
+
+// DeliveryTimeout : how long a delivery may take
+func (c CallbackInfo) DeliveryTimeout() time.Duration {
+	if c.Timeout.Duration > 0 {
+		return c.Timeout.Duration
+	}
+	return 10 * time.Second
+}
+
+// NamespaceInfo : config for a namespace, limits left at zero fall back to the manager's.
+// The default namespace is configured under the name "default"
+type NamespaceInfo struct {
 	ExecutionQueueSize int64 `toml:"execution_queue_size"`
 	TaskQueueSize      int64 `toml:"task_queue_size"`
+	Weight             int64 `toml:"weight"` // Share of execution capacity relative to other namespaces, 1 if zero
+}
+
+// defaultWeight : the weight of a namespace that is not given one
+const defaultWeight = 1
+
+// TaskQueueSizeFor : the most tasks the given namespace may have queued
+func (c *Config) TaskQueueSizeFor(namespace string) int64 {
+	if info, ok := c.namespaceInfo(namespace); ok && info.TaskQueueSize > 0 {
+		return info.TaskQueueSize
+	}
+	return c.Manager.TaskQueueSize
+}
+
+// ExecutionQueueSizeFor : the most tasks the given namespace may have executing
+func (c *Config) ExecutionQueueSizeFor(namespace string) int64 {
+	if info, ok := c.namespaceInfo(namespace); ok && info.ExecutionQueueSize > 0 {
+		return info.ExecutionQueueSize
+	}
+	return c.Manager.ExecutionQueueSize
+}
+
+// WeightFor : the weight of the given namespace when sharing execution capacity
+func (c *Config) WeightFor(namespace string) int64 {
+	if info, ok := c.namespaceInfo(namespace); ok && info.Weight > 0 {
+		return info.Weight
+	}
+	return defaultWeight
+}
+
+func (c *Config) namespaceInfo(namespace string) (NamespaceInfo, bool) {
+	info, ok := c.Namespaces[NamespaceName(namespace)]
+	return info, ok
 }
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Duration : a time.Duration that reads and writes itself
+// as a string such as "1m30s" in json and toml
+type Duration struct {
+	time.Duration
+}
+
+// MarshalText : marshals a Duration
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText : unmarshals a Duration
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
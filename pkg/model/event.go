@@ -0,0 +1,82 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// EventType : what happened to a task
+type EventType string
+
+const (
+	// EventCreated : the task was stored
+	EventCreated EventType = "created"
+	// EventQueued : the task was put on the task queue
+	EventQueued EventType = "queued"
+	// EventDelayed : the task was held back until it is due
+	EventDelayed EventType = "delayed"
+	// EventBlocked : the task was held back until the tasks it depends on have succeeded
+	EventBlocked EventType = "blocked"
+	// EventDispatched : the task was handed to a worker
+	EventDispatched EventType = "dispatched"
+	// EventProgress : the worker executing the task sent an update
+	EventProgress EventType = "progress"
+	// EventRetried : an attempt at the task failed and it will be tried again
+	EventRetried EventType = "retried"
+	// EventCancelled : the task was cancelled, or its worker was asked to stop it
+	EventCancelled EventType = "cancelled"
+	// EventCompleted : the task reached a terminal state
+	EventCompleted EventType = "completed"
+)
+
+// Sources of events
+const (
+	// SourceAPI : a request to the api
+	SourceAPI = "api"
+	// SourceScheduler : a recurring schedule
+	SourceScheduler = "scheduler"
+	// SourceManager : the task manager
+	SourceManager = "manager"
+	// SourceWorker : the worker executing the task
+	SourceWorker = "worker"
+	// SourceDependencies : the outcome of a task the task depends on
+	SourceDependencies = "dependencies"
+)
+
+// Event : something that happened to a task
+type Event struct {
+	Type    EventType `json:"type"`
+	At      time.Time `json:"at"`
+	Source  string    `json:"source"`
+	State   State     `json:"state,omitempty"` // State the task was in once the event happened
+	Message string    `json:"message,omitempty"`
+}
+
+// MarshalBinary : marshals an Event
+func (e *Event) MarshalBinary() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// UnmarshalBinary : unmarshals an Event
+func (e *Event) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, e)
+}
+
+// TaskStatus : an event that happened to a task, as announced to the clients watching tasks
+type TaskStatus struct {
+	TaskID    *uuid.UUID        `json:"taskId"`
+	Namespace string            `json:"namespace,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Event
+}
+
+// MarshalBinary : marshals a TaskStatus
+func (s *TaskStatus) MarshalBinary() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// UnmarshalBinary : unmarshals a TaskStatus
+func (s *TaskStatus) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, s)
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskFilter : narrows a listing of tasks, a field left empty matches every task
+type TaskFilter struct {
+	State         State
+	Image         string
+	Metadata      Selector
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// TaskCursor : where a listing of tasks carries on from, the last task of the previous page
+type TaskCursor struct {
+	CreatedAt time.Time
+	ID        *uuid.UUID
+}
+
+// Encode : the opaque form of the cursor handed to clients
+func (c *TaskCursor) Encode() string {
+	millis := c.CreatedAt.UnixNano() / int64(time.Millisecond)
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", millis, c.ID.String())))
+}
+
+// ParseTaskCursor : parse a cursor in the form Encode hands out
+func ParseTaskCursor(cursor string) (*TaskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("cursor %s is not valid", cursor)
+	}
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("cursor %s is not valid", cursor)
+	}
+	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cursor %s is not valid", cursor)
+	}
+	id, err := uuid.FromString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("cursor %s is not valid", cursor)
+	}
+	return &TaskCursor{CreatedAt: time.Unix(0, millis*int64(time.Millisecond)), ID: &id}, nil
+}
+
+// TaskSummary : a task as it appears in a listing
+type TaskSummary struct {
+	*Spec
+	State     State     `json:"state"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TaskPage : one page of a listing of tasks, the most recently created first
+type TaskPage struct {
+	Tasks      []*TaskSummary `json:"tasks"`
+	NextCursor string         `json:"nextCursor,omitempty"` // Empty on the last page
+}
@@ -0,0 +1,30 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("task cursor", func() {
+	It("should parse the cursor it encodes", func() {
+		id := uuid.Must(uuid.NewV4())
+		cursor := &model.TaskCursor{CreatedAt: time.Unix(1500000000, 123000000), ID: &id}
+
+		parsed, err := model.ParseTaskCursor(cursor.Encode())
+
+		assert.Nil(context, err)
+		assert.True(context, cursor.CreatedAt.Equal(parsed.CreatedAt))
+		assert.Equal(context, id, *parsed.ID)
+	})
+
+	It("should reject a cursor it did not encode", func() {
+		for _, cursor := range []string{"not base64!", "bm90LWEtY3Vyc29y", "MTIzOm5vdC1hbi1pZA"} {
+			_, err := model.ParseTaskCursor(cursor)
+
+			assert.NotNil(context, err)
+		}
+	})
+})
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namespacePattern : namespaces are lower case DNS labels, so they are safe to use in keys and paths
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// DefaultNamespace : the name the default namespace is shown and configured under
+const DefaultNamespace = "default"
+
+// ValidateNamespace : check the given name can be used as a namespace
+func ValidateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("namespace %q must be a lower case DNS label of at most 63 characters", namespace)
+	}
+	if namespace == DefaultNamespace {
+		return fmt.Errorf("namespace %q is reserved", namespace)
+	}
+	return nil
+}
+
+// NamespaceName : the name of the given namespace, which is empty for the default namespace
+func NamespaceName(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
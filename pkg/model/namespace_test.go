@@ -0,0 +1,53 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("namespace", func() {
+	Describe("validating a namespace", func() {
+		It("should accept lower case DNS labels", func() {
+			for _, namespace := range []string{"a", "team-a", "build01"} {
+				assert.Nil(context, model.ValidateNamespace(namespace))
+			}
+		})
+
+		It("should reject names that cannot be used in keys or paths", func() {
+			for _, namespace := range []string{"", "Team", "team:a", "-team", "team-", "team/a", model.DefaultNamespace} {
+				assert.NotNil(context, model.ValidateNamespace(namespace))
+			}
+		})
+	})
+
+	Describe("namespace limits", func() {
+		var config *model.Config
+
+		BeforeEach(func() {
+			config = &model.Config{
+				Manager: model.ManagerInfo{TaskQueueSize: 100, ExecutionQueueSize: 10},
+				Namespaces: map[string]model.NamespaceInfo{
+					"team-a":  {TaskQueueSize: 5, Weight: 3},
+					"default": {ExecutionQueueSize: 4},
+				},
+			}
+		})
+
+		It("should use the namespace's limits where they are given", func() {
+			assert.Equal(context, int64(5), config.TaskQueueSizeFor("team-a"))
+		})
+
+		It("should configure the default namespace under its name", func() {
+			assert.Equal(context, int64(4), config.ExecutionQueueSizeFor(""))
+			assert.Equal(context, int64(3), config.WeightFor("team-a"))
+		})
+
+		It("should fall back to the manager's limits", func() {
+			assert.Equal(context, int64(10), config.ExecutionQueueSizeFor("team-a"))
+			assert.Equal(context, int64(1), config.WeightFor("team-b"))
+			assert.Equal(context, int64(100), config.TaskQueueSizeFor("team-b"))
+			assert.Equal(context, int64(100), config.TaskQueueSizeFor(""))
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ResourceCPU : cpu, counted in millicores
+const ResourceCPU = "cpu"
+
+// ResourceMemory : memory, counted in MiB
+const ResourceMemory = "memory"
+
+// Resources : amounts of resources by name. Resources other than cpu and memory, such as
+// licenses, are plain counts
+type Resources map[string]int64
+
+// Validate : check no amount is negative
+func (r Resources) Validate() error {
+	for _, name := range r.names() {
+		if r[name] < 0 {
+			return fmt.Errorf("resource %s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// FitsWithin : check each amount is no more than the given capacity provides, so that the
+// resources could be granted once nothing else holds them
+func (r Resources) FitsWithin(capacity Resources) error {
+	for _, name := range r.names() {
+		if r[name] == 0 {
+			continue
+		}
+		available, ok := capacity[name]
+		if !ok {
+			return fmt.Errorf("resource %s is not provided", name)
+		}
+		if r[name] > available {
+			return fmt.Errorf("resource %s requested %d exceeds the capacity of %d", name, r[name], available)
+		}
+	}
+	return nil
+}
+
+func (r Resources) names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,39 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("resources", func() {
+	var pool model.Resources
+
+	BeforeEach(func() {
+		pool = model.Resources{model.ResourceCPU: 4000, model.ResourceMemory: 8192, "licenses": 2}
+	})
+
+	It("should reject negative amounts", func() {
+		spec := &model.Spec{Resources: model.Resources{model.ResourceCPU: -1}}
+
+		assert.NotNil(context, spec.Validate())
+	})
+
+	It("should fit requests that the pool could grant", func() {
+		requests := model.Resources{model.ResourceCPU: 4000, "licenses": 1, "gpu": 0}
+
+		assert.Nil(context, requests.FitsWithin(pool))
+	})
+
+	It("should not fit requests for more than the pool has", func() {
+		requests := model.Resources{model.ResourceMemory: 8193}
+
+		assert.NotNil(context, requests.FitsWithin(pool))
+	})
+
+	It("should not fit requests for resources the pool does not provide", func() {
+		requests := model.Resources{"gpu": 1}
+
+		assert.NotNil(context, requests.FitsWithin(pool))
+	})
+})
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// OverlapPolicy : what a schedule does when it is due while its previous run is still in progress
+type OverlapPolicy string
+
+const (
+	// OverlapSkip : the run is not started
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue : the run is started once the previous run has completed
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapAllow : the run is started alongside the previous run
+	OverlapAllow OverlapPolicy = "allow"
+)
+
+// CatchUpPolicy : what a schedule does about runs it missed while the service was down
+type CatchUpPolicy string
+
+const (
+	// CatchUpSkip : missed runs are dropped
+	CatchUpSkip CatchUpPolicy = "skip"
+	// CatchUpOnce : missed runs are collapsed into a single run
+	CatchUpOnce CatchUpPolicy = "once"
+	// CatchUpAll : every missed run is started
+	CatchUpAll CatchUpPolicy = "all"
+)
+
+// Schedule : a recurring task definition
+type Schedule struct {
+	ID         *uuid.UUID    `json:"id"`
+	Cron       string        `json:"cron"`               // Standard five field cron expression
+	TimeZone   string        `json:"timeZone,omitempty"` // IANA time zone the expression is evaluated in, UTC if empty
+	Template   Spec          `json:"template"`           // Spec each run's task is built from
+	Overlap    OverlapPolicy `json:"overlap,omitempty"`
+	CatchUp    CatchUpPolicy `json:"catchUp,omitempty"`
+	NextRun    *time.Time    `json:"nextRun,omitempty"`
+	LastTaskID *uuid.UUID    `json:"lastTaskId,omitempty"`
+	Pending    int           `json:"pending,omitempty"` // Runs waiting for the previous run to complete
+}
+
+// Validate : check the schedule's policies and template can be accepted
+func (s *Schedule) Validate() error {
+	switch s.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapAllow:
+	default:
+		return fmt.Errorf("unknown overlap policy %q", s.Overlap)
+	}
+	switch s.CatchUp {
+	case "", CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return fmt.Errorf("unknown catch up policy %q", s.CatchUp)
+	}
+	if s.Template.RunAt != nil || s.Template.Delay != nil {
+		return fmt.Errorf("a schedule's template may not have a runAt or delay")
+	}
+	if len(s.Template.DependsOn) > 0 || s.Template.Dedupe != nil {
+		return fmt.Errorf("a schedule's template may not have dependsOn or dedupe")
+	}
+	return s.Template.Validate()
+}
+
+// MarshalBinary : marshals a Schedule
+func (s *Schedule) MarshalBinary() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// UnmarshalBinary : unmarshals a Schedule
+func (s *Schedule) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, s)
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector : values the metadata of a task must have for the task to be selected
+type Selector map[string]string
+
+// ParseSelector : parse a selector of the form key=value,key=value.
+// The empty selector selects every task
+func ParseSelector(selector string) (Selector, error) {
+	parsed := Selector{}
+	if strings.TrimSpace(selector) == "" {
+		return parsed, nil
+	}
+	for _, requirement := range strings.Split(selector, ",") {
+		parts := strings.SplitN(requirement, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("selector requirement %q must be of the form key=value", requirement)
+		}
+		value := strings.TrimSpace(parts[1])
+		if existing, ok := parsed[key]; ok && existing != value {
+			return nil, fmt.Errorf("selector requires %s to be both %s and %s", key, existing, value)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// Matches : true if the given metadata has every value the selector requires
+func (s Selector) Matches(metadata map[string]string) bool {
+	for key, value := range s {
+		actual, ok := metadata[key]
+		if !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("selector", func() {
+	It("should select tasks with every required value", func() {
+		selector, err := model.ParseSelector("team=a, env=prod")
+
+		assert.Nil(context, err)
+		assert.True(context, selector.Matches(map[string]string{"team": "a", "env": "prod", "other": "x"}))
+		assert.False(context, selector.Matches(map[string]string{"team": "a", "env": "dev"}))
+		assert.False(context, selector.Matches(map[string]string{"team": "a"}))
+	})
+
+	It("should select every task if empty", func() {
+		selector, err := model.ParseSelector("")
+
+		assert.Nil(context, err)
+		assert.True(context, selector.Matches(nil))
+	})
+
+	It("should reject requirements without a value", func() {
+		_, err := model.ParseSelector("team")
+
+		assert.NotNil(context, err)
+	})
+
+	It("should reject requirements that contradict each other", func() {
+		_, err := model.ParseSelector("team=a,team=b")
+
+		assert.NotNil(context, err)
+	})
+})
@@ -0,0 +1,80 @@
+package model
+
+// State : the lifecycle state of a task
+type State string
+
+const (
+	// StateQueued : the task is waiting on the task queue
+	StateQueued State = "queued"
+	// StateDelayed : the task is waiting to be queued at a later time
+	StateDelayed State = "delayed"
+	// StateBlocked : the task is waiting for the tasks it depends on to succeed
+	StateBlocked State = "blocked"
+	// StateScheduled : the task has been handed to a worker
+	StateScheduled State = "scheduled"
+	// StateRunning : a worker has started executing the task
+	StateRunning State = "running"
+	// StateSucceeded : the task completed successfully
+	StateSucceeded State = "succeeded"
+	// StateFailed : the task completed unsuccessfully
+	StateFailed State = "failed"
+	// StateCancelled : the task was cancelled before it completed
+	StateCancelled State = "cancelled"
+	// StateExpired : the task was given up on before it completed
+	StateExpired State = "expired"
+	// StateSkipped : the task was never run because a task it depends on did not succeed
+	StateSkipped State = "skipped"
+)
+
+// states : every state a task may be in
+var states = []State{
+	StateQueued, StateDelayed, StateBlocked, StateScheduled, StateRunning,
+	StateSucceeded, StateFailed, StateCancelled, StateExpired, StateSkipped,
+}
+
+// transitions : the states a task may move to from a given state,
+// a task that has not been stored yet has the empty state
+var transitions = map[State][]State{
+	"":             {StateQueued},
+	StateQueued:    {StateDelayed, StateBlocked, StateScheduled, StateCancelled, StateExpired},
+	StateDelayed:   {StateQueued, StateCancelled, StateExpired},
+	StateBlocked:   {StateQueued, StateDelayed, StateSkipped, StateCancelled, StateExpired},
+	StateScheduled: {StateQueued, StateDelayed, StateRunning, StateSucceeded, StateFailed, StateCancelled, StateExpired},
+	StateRunning:   {StateQueued, StateDelayed, StateSucceeded, StateFailed, StateCancelled, StateExpired},
+}
+
+// CanTransitionTo : true if a task in this state may move to the given state
+func (s State) CanTransitionTo(to State) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal : true if no further transitions are possible from this state
+func (s State) IsTerminal() bool {
+	return s != "" && len(transitions[s]) == 0
+}
+
+// IsValid : true if this is a state a task may be in
+func (s State) IsValid() bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TerminalStates : every state a task cannot move on from
+func TerminalStates() []State {
+	var terminal []State
+	for _, state := range states {
+		if state.IsTerminal() {
+			terminal = append(terminal, state)
+		}
+	}
+	return terminal
+}
@@ -0,0 +1,63 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var context = GinkgoT()
+
+var _ = Describe("state", func() {
+	Describe("transitioning", func() {
+		It("should only allow a new task to be queued", func() {
+			assert.True(context, model.State("").CanTransitionTo(model.StateQueued))
+			assert.False(context, model.State("").CanTransitionTo(model.StateRunning))
+		})
+
+		It("should allow a queued task to be scheduled or cancelled", func() {
+			assert.True(context, model.StateQueued.CanTransitionTo(model.StateScheduled))
+			assert.True(context, model.StateQueued.CanTransitionTo(model.StateCancelled))
+			assert.False(context, model.StateQueued.CanTransitionTo(model.StateSucceeded))
+		})
+
+		It("should allow a failed attempt to be delayed for a retry", func() {
+			assert.True(context, model.StateRunning.CanTransitionTo(model.StateDelayed))
+			assert.True(context, model.StateDelayed.CanTransitionTo(model.StateQueued))
+			assert.False(context, model.StateDelayed.CanTransitionTo(model.StateRunning))
+		})
+
+		It("should allow a blocked task to be released or skipped", func() {
+			assert.True(context, model.StateQueued.CanTransitionTo(model.StateBlocked))
+			assert.True(context, model.StateBlocked.CanTransitionTo(model.StateQueued))
+			assert.True(context, model.StateBlocked.CanTransitionTo(model.StateDelayed))
+			assert.True(context, model.StateBlocked.CanTransitionTo(model.StateSkipped))
+			assert.False(context, model.StateBlocked.CanTransitionTo(model.StateScheduled))
+		})
+
+		It("should not allow a completed task to move", func() {
+			for _, state := range []model.State{model.StateSucceeded, model.StateFailed, model.StateCancelled, model.StateExpired, model.StateSkipped} {
+				assert.True(context, state.IsTerminal())
+				assert.False(context, state.CanTransitionTo(model.StateQueued))
+			}
+		})
+
+		It("should list every terminal state", func() {
+			terminal := model.TerminalStates()
+
+			assert.ElementsMatch(context, []model.State{model.StateSucceeded, model.StateFailed, model.StateCancelled, model.StateExpired, model.StateSkipped}, terminal)
+		})
+
+		It("should not treat an active task as completed", func() {
+			assert.False(context, model.State("").IsTerminal())
+			assert.False(context, model.StateQueued.IsTerminal())
+			assert.False(context, model.StateRunning.IsTerminal())
+		})
+
+		It("should only recognise the states a task may be in", func() {
+			assert.True(context, model.StateBlocked.IsValid())
+			assert.False(context, model.State("").IsValid())
+			assert.False(context, model.State("paused").IsValid())
+		})
+	})
+})
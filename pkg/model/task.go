@@ -1,17 +1,127 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"github.com/satori/go.uuid"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
 )
 
+// MinPriority : the lowest priority a task may have
+const MinPriority = -1000
+
+// MaxPriority : the highest priority a task may have
+const MaxPriority = 1000
+
 // Spec is the specification for a task
 type Spec struct {
-	ID       *uuid.UUID        `json:"id"`
-	Metadata map[string]string `json:"metadata"`
-	Image    string            `json:"image"`
-	Init     string            `json:"init"`
-	InitArgs []string          `json:"initArgs"`
+	ID        *uuid.UUID        `json:"id"`
+	Metadata  map[string]string `json:"metadata"`
+	Image     string            `json:"image"`
+	Init      string            `json:"init"`
+	InitArgs  []string          `json:"initArgs"`
+	Retry     *RetryPolicy      `json:"retry,omitempty"`
+	Timeout   *Duration         `json:"timeout,omitempty"`
+	Priority  int               `json:"priority,omitempty"`
+	RunAt     *time.Time        `json:"runAt,omitempty"`
+	Delay     *Duration         `json:"delay,omitempty"`
+	DependsOn []uuid.UUID       `json:"dependsOn,omitempty"` // Tasks that must succeed before this one is queued
+	Dedupe    *Dedupe           `json:"dedupe,omitempty"`
+	Resources Resources         `json:"resources,omitempty"` // Resources the task holds while it executes
+
+	CallbackURL     string            `json:"callbackURL,omitempty"`     // Where the result is posted once the task completes
+	CallbackHeaders map[string]string `json:"callbackHeaders,omitempty"` // Extra headers sent with the result
+}
+
+// Dedupe : opts a task in to being merged into an identical task that is already queued or executing
+type Dedupe struct {
+	MetadataKeys []string `json:"metadataKeys,omitempty"` // Metadata that must also match for tasks to be identical
+}
+
+// Validate : check the spec can be accepted as a task
+func (s *Spec) Validate() error {
+	if s.Priority < MinPriority || s.Priority > MaxPriority {
+		return fmt.Errorf("priority %d is outside of the allowed range [%d, %d]", s.Priority, MinPriority, MaxPriority)
+	}
+	if s.RunAt != nil && s.Delay != nil {
+		return fmt.Errorf("only one of runAt and delay may be given")
+	}
+	if s.Delay != nil && s.Delay.Duration < 0 {
+		return fmt.Errorf("delay %s must not be negative", s.Delay.Duration)
+	}
+	if err := s.Resources.Validate(); err != nil {
+		return err
+	}
+	seen := make(map[uuid.UUID]bool, len(s.DependsOn))
+	for _, parent := range s.DependsOn {
+		if seen[parent] {
+			return fmt.Errorf("dependency %s is given more than once", parent.String())
+		}
+		seen[parent] = true
+	}
+	return s.validateCallback()
+}
+
+func (s *Spec) validateCallback() error {
+	if s.CallbackURL == "" {
+		if len(s.CallbackHeaders) > 0 {
+			return fmt.Errorf("callback headers are only sent to a callback url")
+		}
+		return nil
+	}
+	callbackURL, err := url.Parse(s.CallbackURL)
+	if err != nil {
+		return fmt.Errorf("callback url %s is not valid : %s", s.CallbackURL, err.Error())
+	}
+	if (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+		return fmt.Errorf("callback url %s must be an absolute http or https url", s.CallbackURL)
+	}
+	for name := range s.CallbackHeaders {
+		if name == "" || http.CanonicalHeaderKey(name) == CallbackSignatureHeader {
+			return fmt.Errorf("callback header %q may not be set", name)
+		}
+	}
+	return nil
+}
+
+// ResolveRunAt : fix the time the task should start at, relative to the given
+// submission time when a delay was given, and report whether that is later than now
+func (s *Spec) ResolveRunAt(now time.Time) bool {
+	if s.Delay != nil {
+		runAt := now.Add(s.Delay.Duration)
+		s.RunAt = &runAt
+	}
+	return s.RunAt != nil && s.RunAt.After(now)
+}
+
+// DedupeHash : identifies the work the spec describes by its image, init, init args and the
+// metadata named by its dedupe options. Specs with the same hash are duplicates of each other
+func (s *Spec) DedupeHash() string {
+	normalized := struct {
+		Image    string            `json:"image"`
+		Init     string            `json:"init"`
+		InitArgs []string          `json:"initArgs"`
+		Metadata map[string]string `json:"metadata"`
+	}{Image: s.Image, Init: s.Init, InitArgs: s.InitArgs, Metadata: map[string]string{}}
+	if len(normalized.InitArgs) == 0 {
+		normalized.InitArgs = nil
+	}
+	if s.Dedupe != nil {
+		for _, key := range s.Dedupe.MetadataKeys {
+			if value, ok := s.Metadata[key]; ok {
+				normalized.Metadata[key] = value
+			}
+		}
+	}
+
+	data, _ := json.Marshal(&normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 // MarshalBinary marshals a Spec
@@ -24,12 +134,75 @@ func (s *Spec) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, s)
 }
 
+// RetryPolicy : how a failed task is retried
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"maxAttempts"`          // Total attempts, including the first
+	InitialBackoff Duration `json:"initialBackoff"`       // Wait before the first retry
+	MaxBackoff     Duration `json:"maxBackoff,omitempty"` // Upper bound for the wait, unbounded if zero
+	Multiplier     float64  `json:"multiplier,omitempty"` // Growth of the wait per attempt, 2 if zero
+	Jitter         float64  `json:"jitter,omitempty"`     // Fraction of the wait to randomise by, between 0 and 1
+}
+
+// Backoff : the wait before retrying after the given number of failed attempts,
+// random is a number in [0, 1) used to apply jitter
+func (p *RetryPolicy) Backoff(failedAttempts int, random float64) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	backoff := float64(p.InitialBackoff.Duration) * math.Pow(multiplier, float64(failedAttempts-1))
+	if p.MaxBackoff.Duration > 0 && backoff > float64(p.MaxBackoff.Duration) {
+		backoff = float64(p.MaxBackoff.Duration)
+	}
+	backoff += backoff * p.Jitter * (2*random - 1)
+	return time.Duration(backoff)
+}
+
+// InfoStatus : what a message from a worker about a task reports
+type InfoStatus string
+
+const (
+	// InfoStarted : the worker has started executing the task
+	InfoStarted InfoStatus = "started"
+	// InfoProgress : the worker reports how far the task has got
+	InfoProgress InfoStatus = "progress"
+	// InfoCompleted : the task has completed, messages without a status are completions
+	InfoCompleted InfoStatus = "completed"
+)
+
 // Info : task information
 type Info struct {
 	ID           *uuid.UUID     `json:"id"`
+	Status       InfoStatus     `json:"status,omitempty"`
 	Metadata     interface{}    `json:"metadata,omitempty"`
 	Succeeded    bool           `json:"succeeded"`
+	Cancelled    bool           `json:"cancelled,omitempty"`
 	FailureStats *FailureStatus `json:"failureStats,omitempty"`
+	Percent      *float64       `json:"percent,omitempty"` // How far the task has got, from 0 to 100
+	Phase        string         `json:"phase,omitempty"`
+	Message      string         `json:"message,omitempty"`
+	Worker       string         `json:"worker,omitempty"` // Worker that sent the report, empty for outcomes the manager decides
+}
+
+// Validate : check the info is something a worker may report
+func (i *Info) Validate() error {
+	if i.ID == nil {
+		return fmt.Errorf("info must have a task id")
+	}
+	switch i.Status {
+	case "", InfoStarted, InfoProgress, InfoCompleted:
+	default:
+		return fmt.Errorf("status %q is not one of %q, %q or %q", i.Status, InfoStarted, InfoProgress, InfoCompleted)
+	}
+	if i.Percent != nil && (*i.Percent < 0 || *i.Percent > 100) {
+		return fmt.Errorf("percent %v is outside of the allowed range 0 to 100", *i.Percent)
+	}
+	return nil
+}
+
+// IsTerminal : true if the info reports that the task has completed, rather than how it is getting on
+func (i *Info) IsTerminal() bool {
+	return i.Status == "" || i.Status == InfoCompleted
 }
 
 // MarshalBinary marshals a Spec
@@ -42,6 +215,48 @@ func (i *Info) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, i)
 }
 
+// Progress : the latest of the updates a worker has sent about how an executing task is getting on.
+// Fields an update leaves out keep the value of an earlier update
+type Progress struct {
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	Percent   *float64   `json:"percent,omitempty"`
+	Phase     string     `json:"phase,omitempty"`
+	Message   string     `json:"message,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// MergedCaller : a request to create a task that was merged into an identical existing task
+type MergedCaller struct {
+	At       time.Time         `json:"at"`
+	Source   string            `json:"source,omitempty"`   // Address the request came from
+	Metadata map[string]string `json:"metadata,omitempty"` // Metadata of the spec that was merged
+}
+
+// MarshalBinary : marshals a MergedCaller
+func (m *MergedCaller) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// UnmarshalBinary : unmarshals a MergedCaller
+func (m *MergedCaller) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, m)
+}
+
+// CancelRequest : asks the worker executing a task to stop it
+type CancelRequest struct {
+	ID *uuid.UUID `json:"id"`
+}
+
+// MarshalBinary : marshals a CancelRequest
+func (c *CancelRequest) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// UnmarshalBinary : unmarshals a CancelRequest
+func (c *CancelRequest) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, c)
+}
+
 // FailureStatus : contains status information for the result of an execution
 type FailureStatus struct {
 	Type        string          `json:"type"`               // The type of the "thing" that failed
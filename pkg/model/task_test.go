@@ -0,0 +1,209 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("task", func() {
+	Describe("retry backoff", func() {
+		var policy *model.RetryPolicy
+
+		BeforeEach(func() {
+			policy = &model.RetryPolicy{
+				MaxAttempts:    5,
+				InitialBackoff: model.Duration{Duration: time.Second},
+			}
+		})
+
+		It("should double the backoff after each failed attempt by default", func() {
+			assert.Equal(context, time.Second, policy.Backoff(1, 0.5))
+			assert.Equal(context, 2*time.Second, policy.Backoff(2, 0.5))
+			assert.Equal(context, 4*time.Second, policy.Backoff(3, 0.5))
+		})
+
+		It("should grow the backoff by the given multiplier", func() {
+			policy.Multiplier = 3
+
+			assert.Equal(context, 9*time.Second, policy.Backoff(3, 0.5))
+		})
+
+		It("should not exceed the max backoff", func() {
+			policy.MaxBackoff = model.Duration{Duration: 3 * time.Second}
+
+			assert.Equal(context, 3*time.Second, policy.Backoff(4, 0.5))
+		})
+
+		It("should apply jitter either side of the backoff", func() {
+			policy.Jitter = 0.5
+
+			assert.Equal(context, 500*time.Millisecond, policy.Backoff(1, 0))
+			assert.Equal(context, 1500*time.Millisecond, policy.Backoff(1, 1))
+		})
+	})
+
+	Describe("validating a spec", func() {
+		It("should accept priorities in the allowed range", func() {
+			for _, priority := range []int{model.MinPriority, 0, model.MaxPriority} {
+				spec := &model.Spec{Priority: priority}
+				assert.Nil(context, spec.Validate())
+			}
+		})
+
+		It("should reject priorities outside of the allowed range", func() {
+			for _, priority := range []int{model.MinPriority - 1, model.MaxPriority + 1} {
+				spec := &model.Spec{Priority: priority}
+				assert.NotNil(context, spec.Validate())
+			}
+		})
+
+		It("should reject a dependency given more than once", func() {
+			parent := uuid.Must(uuid.NewV4())
+			spec := &model.Spec{DependsOn: []uuid.UUID{parent, parent}}
+
+			assert.NotNil(context, spec.Validate())
+		})
+	})
+
+	Describe("hashing a spec for dedupe", func() {
+		var spec *model.Spec
+
+		BeforeEach(func() {
+			spec = &model.Spec{
+				Image:    "alpine",
+				Init:     "init.sh",
+				InitArgs: []string{"10"},
+				Metadata: map[string]string{"repo": "task-store", "requester": "ci"},
+				Dedupe:   &model.Dedupe{MetadataKeys: []string{"repo"}},
+			}
+		})
+
+		It("should give identical work the same hash", func() {
+			other := *spec
+			other.Metadata = map[string]string{"repo": "task-store", "requester": "nightly"}
+			other.Priority = 10
+
+			assert.Equal(context, spec.DedupeHash(), other.DedupeHash())
+		})
+
+		It("should tell apart work with different init args", func() {
+			other := *spec
+			other.InitArgs = []string{"20"}
+
+			assert.NotEqual(context, spec.DedupeHash(), other.DedupeHash())
+		})
+
+		It("should tell apart work with different selected metadata", func() {
+			other := *spec
+			other.Metadata = map[string]string{"repo": "executor", "requester": "ci"}
+
+			assert.NotEqual(context, spec.DedupeHash(), other.DedupeHash())
+		})
+
+		It("should treat missing and empty init args alike", func() {
+			spec.InitArgs = nil
+			other := *spec
+			other.InitArgs = []string{}
+
+			assert.Equal(context, spec.DedupeHash(), other.DedupeHash())
+		})
+	})
+
+	Describe("resolving when a task should run", func() {
+		It("should run a task without a delay straight away", func() {
+			spec := &model.Spec{}
+
+			assert.False(context, spec.ResolveRunAt(time.Now()))
+			assert.Nil(context, spec.RunAt)
+		})
+
+		It("should run a delayed task after its delay", func() {
+			now := time.Now()
+			spec := &model.Spec{Delay: &model.Duration{Duration: time.Minute}}
+
+			assert.True(context, spec.ResolveRunAt(now))
+			assert.Equal(context, now.Add(time.Minute), *spec.RunAt)
+		})
+
+		It("should run a task at its given time", func() {
+			now := time.Now()
+			past := now.Add(-time.Minute)
+			future := now.Add(time.Minute)
+
+			assert.False(context, (&model.Spec{RunAt: &past}).ResolveRunAt(now))
+			assert.True(context, (&model.Spec{RunAt: &future}).ResolveRunAt(now))
+		})
+
+		It("should reject a spec with both a time and a delay", func() {
+			now := time.Now()
+			spec := &model.Spec{RunAt: &now, Delay: &model.Duration{Duration: time.Minute}}
+
+			assert.NotNil(context, spec.Validate())
+		})
+	})
+
+	Describe("reading a spec", func() {
+		It("should read durations in the retry policy", func() {
+			// Arrange
+			data := []byte(`{"image": "alpine", "retry": {"maxAttempts": 3, "initialBackoff": "1m30s"}}`)
+			spec := new(model.Spec)
+
+			// Act
+			err := spec.UnmarshalBinary(data)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, 3, spec.Retry.MaxAttempts)
+			assert.Equal(context, 90*time.Second, spec.Retry.InitialBackoff.Duration)
+		})
+
+		It("should return error if a duration is malformed", func() {
+			// Arrange
+			data := []byte(`{"image": "alpine", "retry": {"maxAttempts": 3, "initialBackoff": "soon"}}`)
+			spec := new(model.Spec)
+
+			// Act
+			err := spec.UnmarshalBinary(data)
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("validating info from a worker", func() {
+		It("should treat info without a status as a completion", func() {
+			id := uuid.Must(uuid.NewV4())
+			info := &model.Info{ID: &id, Succeeded: true}
+
+			assert.Nil(context, info.Validate())
+			assert.True(context, info.IsTerminal())
+		})
+
+		It("should accept progress within the allowed range", func() {
+			id := uuid.Must(uuid.NewV4())
+			percent := 100.0
+			info := &model.Info{ID: &id, Status: model.InfoProgress, Percent: &percent}
+
+			assert.Nil(context, info.Validate())
+			assert.False(context, info.IsTerminal())
+		})
+
+		It("should reject progress outside of the allowed range", func() {
+			id := uuid.Must(uuid.NewV4())
+			percent := 101.0
+			info := &model.Info{ID: &id, Status: model.InfoProgress, Percent: &percent}
+
+			assert.NotNil(context, info.Validate())
+		})
+
+		It("should reject an unknown status", func() {
+			id := uuid.Must(uuid.NewV4())
+			info := &model.Info{ID: &id, Status: "paused"}
+
+			assert.NotNil(context, info.Validate())
+		})
+	})
+})
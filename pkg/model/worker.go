@@ -0,0 +1,57 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"regexp"
+	"time"
+)
+
+// workerIDPattern : worker ids are used in keys and paths
+var workerIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Worker : a worker consuming the work queue, along with the executing tasks it holds
+type Worker struct {
+	ID            string       `json:"id"`
+	Hostname      string       `json:"hostname,omitempty"`
+	RegisteredAt  time.Time    `json:"registeredAt"`
+	LastHeartbeat time.Time    `json:"lastHeartbeat"`
+	Tasks         []*uuid.UUID `json:"tasks"`
+}
+
+// MarshalBinary : marshals a Worker
+func (w *Worker) MarshalBinary() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+// UnmarshalBinary : unmarshals a Worker
+func (w *Worker) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, w)
+}
+
+// Heartbeat : sent by a worker to show it is alive, listing every task it is executing
+type Heartbeat struct {
+	Tasks []*uuid.UUID `json:"tasks"`
+}
+
+// ValidateWorkerID : check the given id can be used for a worker
+func ValidateWorkerID(id string) error {
+	if !workerIDPattern.MatchString(id) {
+		return fmt.Errorf("worker id %q must be at most 128 letters, digits, '.', '_' or '-'", id)
+	}
+	return nil
+}
+
+// Lease : an executing task's claim on its slot, which expires unless the worker executing the task renews it
+type Lease struct {
+	TaskID    *uuid.UUID `json:"taskId"`
+	Worker    string     `json:"worker,omitempty"`    // Worker that renewed the lease, empty until one has
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Nil if the lease never expires
+}
+
+// LeaseRenewal : sent by the worker executing a task to extend the task's lease
+type LeaseRenewal struct {
+	Worker   string    `json:"worker"`
+	Duration *Duration `json:"duration,omitempty"` // How long from now the lease lasts, the manager's lease duration if not given
+}
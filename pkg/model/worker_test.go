@@ -0,0 +1,21 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("worker", func() {
+	It("should accept ids that are safe to use in keys and paths", func() {
+		for _, id := range []string{"w", "worker-1", "host.example.com", "Worker_2"} {
+			assert.Nil(context, model.ValidateWorkerID(id))
+		}
+	})
+
+	It("should reject ids that cannot be used in keys or paths", func() {
+		for _, id := range []string{"", "-worker", "worker:1", "worker/1", "worker 1"} {
+			assert.NotNil(context, model.ValidateWorkerID(id))
+		}
+	})
+})
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+)
+
+// WorkflowStatus : the overall progress of a workflow
+type WorkflowStatus string
+
+const (
+	// WorkflowRunning : some of the workflow's steps have not completed
+	WorkflowRunning WorkflowStatus = "running"
+	// WorkflowSucceeded : every step of the workflow succeeded
+	WorkflowSucceeded WorkflowStatus = "succeeded"
+	// WorkflowFailed : a step of the workflow did not succeed
+	WorkflowFailed WorkflowStatus = "failed"
+	// WorkflowCancelled : a step of the workflow was cancelled
+	WorkflowCancelled WorkflowStatus = "cancelled"
+)
+
+// Step : a named task within a workflow
+type Step struct {
+	Name string `json:"name"`
+	Spec Spec   `json:"spec"`
+}
+
+// Edge : the step named From must succeed before the step named To is queued
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Workflow : a set of steps run as ordinary tasks, ordered by the edges between them
+type Workflow struct {
+	ID    *uuid.UUID            `json:"id"`
+	Name  string                `json:"name"`
+	Steps []Step                `json:"steps"`
+	Edges []Edge                `json:"edges,omitempty"`
+	Tasks map[string]*uuid.UUID `json:"tasks,omitempty"` // Task created for each step, by step name
+}
+
+// Validate : check the workflow's steps and edges can be accepted
+func (w *Workflow) Validate() error {
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("a workflow must have at least one step")
+	}
+
+	names := make(map[string]bool, len(w.Steps))
+	for _, step := range w.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("every step must have a name")
+		}
+		if names[step.Name] {
+			return fmt.Errorf("step %q is given more than once", step.Name)
+		}
+		names[step.Name] = true
+		if len(step.Spec.DependsOn) > 0 {
+			return fmt.Errorf("step %q may only depend on other steps through edges", step.Name)
+		}
+		if err := step.Spec.Validate(); err != nil {
+			return fmt.Errorf("step %q is not valid : %s", step.Name, err.Error())
+		}
+	}
+
+	seen := make(map[Edge]bool, len(w.Edges))
+	for _, edge := range w.Edges {
+		if !names[edge.From] || !names[edge.To] {
+			return fmt.Errorf("edge from %q to %q joins a step that does not exist", edge.From, edge.To)
+		}
+		if seen[edge] {
+			return fmt.Errorf("edge from %q to %q is given more than once", edge.From, edge.To)
+		}
+		seen[edge] = true
+	}
+
+	_, err := w.Order()
+	return err
+}
+
+// Order : the workflow's steps ordered so that every step comes after the steps it depends on
+func (w *Workflow) Order() ([]Step, error) {
+	parents := make(map[string]int, len(w.Steps))
+	children := make(map[string][]string, len(w.Steps))
+	for _, edge := range w.Edges {
+		parents[edge.To]++
+		children[edge.From] = append(children[edge.From], edge.To)
+	}
+
+	steps := make(map[string]Step, len(w.Steps))
+	var ready []string
+	for _, step := range w.Steps {
+		steps[step.Name] = step
+		if parents[step.Name] == 0 {
+			ready = append(ready, step.Name)
+		}
+	}
+
+	ordered := make([]Step, 0, len(w.Steps))
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, steps[name])
+		for _, child := range children[name] {
+			parents[child]--
+			if parents[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	if len(ordered) != len(w.Steps) {
+		return nil, fmt.Errorf("the workflow's edges form a cycle")
+	}
+	return ordered, nil
+}
+
+// Parents : the names of the steps the named step depends on
+func (w *Workflow) Parents(name string) []string {
+	var parents []string
+	for _, edge := range w.Edges {
+		if edge.To == name {
+			parents = append(parents, edge.From)
+		}
+	}
+	return parents
+}
+
+// AggregateStatus : the status of a workflow whose steps are in the given states
+func AggregateStatus(states []State) WorkflowStatus {
+	status := WorkflowSucceeded
+	for _, state := range states {
+		switch state {
+		case StateSucceeded:
+		case StateCancelled:
+			return WorkflowCancelled
+		case StateFailed, StateExpired, StateSkipped:
+			status = WorkflowFailed
+		default:
+			if status != WorkflowFailed {
+				status = WorkflowRunning
+			}
+		}
+	}
+	return status
+}
+
+// MarshalBinary : marshals a Workflow
+func (w *Workflow) MarshalBinary() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+// UnmarshalBinary : unmarshals a Workflow
+func (w *Workflow) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, w)
+}
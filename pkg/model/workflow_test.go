@@ -0,0 +1,101 @@
+package model_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("workflow", func() {
+	var wf *model.Workflow
+
+	BeforeEach(func() {
+		wf = &model.Workflow{
+			Name: "release",
+			Steps: []model.Step{
+				{Name: "publish", Spec: model.Spec{Image: "alpine"}},
+				{Name: "test", Spec: model.Spec{Image: "alpine"}},
+				{Name: "build", Spec: model.Spec{Image: "alpine"}},
+			},
+			Edges: []model.Edge{
+				{From: "build", To: "test"},
+				{From: "test", To: "publish"},
+			},
+		}
+	})
+
+	Describe("validating a workflow", func() {
+		It("should accept steps joined by edges", func() {
+			assert.Nil(context, wf.Validate())
+		})
+
+		It("should reject a workflow without steps", func() {
+			wf.Steps = nil
+
+			assert.NotNil(context, wf.Validate())
+		})
+
+		It("should reject steps with the same name", func() {
+			wf.Steps[1].Name = "build"
+
+			assert.NotNil(context, wf.Validate())
+		})
+
+		It("should reject an edge to a step that does not exist", func() {
+			wf.Edges = append(wf.Edges, model.Edge{From: "build", To: "deploy"})
+
+			assert.NotNil(context, wf.Validate())
+		})
+
+		It("should reject edges that form a cycle", func() {
+			wf.Edges = append(wf.Edges, model.Edge{From: "publish", To: "build"})
+
+			assert.NotNil(context, wf.Validate())
+		})
+
+		It("should reject a step that is not valid", func() {
+			wf.Steps[0].Spec.Priority = model.MaxPriority + 1
+
+			assert.NotNil(context, wf.Validate())
+		})
+	})
+
+	Describe("ordering steps", func() {
+		It("should put every step after the steps it depends on", func() {
+			// Act
+			ordered, err := wf.Order()
+
+			// Assert
+			assert.Nil(context, err)
+			names := []string{ordered[0].Name, ordered[1].Name, ordered[2].Name}
+			assert.Equal(context, []string{"build", "test", "publish"}, names)
+			assert.Equal(context, []string{"test"}, wf.Parents("publish"))
+		})
+	})
+
+	Describe("aggregating status", func() {
+		It("should succeed once every step has succeeded", func() {
+			status := model.AggregateStatus([]model.State{model.StateSucceeded, model.StateSucceeded})
+
+			assert.Equal(context, model.WorkflowSucceeded, status)
+		})
+
+		It("should be running while a step has not completed", func() {
+			status := model.AggregateStatus([]model.State{model.StateSucceeded, model.StateBlocked})
+
+			assert.Equal(context, model.WorkflowRunning, status)
+		})
+
+		It("should fail once a step has not succeeded", func() {
+			status := model.AggregateStatus([]model.State{model.StateFailed, model.StateRunning, model.StateSkipped})
+
+			assert.Equal(context, model.WorkflowFailed, status)
+		})
+
+		It("should be cancelled once a step is cancelled", func() {
+			status := model.AggregateStatus([]model.State{model.StateFailed, model.StateCancelled})
+
+			assert.Equal(context, model.WorkflowCancelled, status)
+		})
+	})
+})
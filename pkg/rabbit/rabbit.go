@@ -4,15 +4,18 @@ import (
 	"github.com/NeowayLabs/wabbit"
 	"github.com/NeowayLabs/wabbit/amqp"
 	"github.com/execd/task-store/pkg/model"
+	"github.com/satori/go.uuid"
 	"log"
 )
 
 const queueName = "work_queue"
+const cancelQueueName = "cancel_queue"
 
 // Service : interface for building rabbit services
 type Service interface {
 	GetTaskStatusQueueChan() <-chan wabbit.Delivery
 	PublishWork(task *model.Spec) error
+	PublishCancel(id *uuid.UUID) error
 }
 
 // ServiceImpl : service to interact with rabbit
@@ -23,6 +26,7 @@ type ServiceImpl struct {
 	taskStatusQueueName string
 	taskStatusQueueChan <-chan wabbit.Delivery
 	workQueueName       string
+	cancelQueueName     string
 }
 
 // NewRabbitMqImpl : build a new connection to rabbitmq
@@ -49,6 +53,19 @@ func (r *ServiceImpl) PublishWork(task *model.Spec) error {
 	return r.channel.Publish("", r.workQueueName, data, opts)
 }
 
+// PublishCancel : ask the worker executing the given task to stop it
+func (r *ServiceImpl) PublishCancel(id *uuid.UUID) error {
+	request := &model.CancelRequest{ID: id}
+	data, err := request.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	opts := wabbit.Option{
+		"contentType": "application/json",
+	}
+	return r.channel.Publish("", r.cancelQueueName, data, opts)
+}
+
 func (r *ServiceImpl) initialize(address string) {
 	c := make(chan wabbit.Error)
 	go func() {
@@ -71,6 +88,7 @@ func (r *ServiceImpl) initialize(address string) {
 	r.connection = conn
 	r.channel = ch
 	r.initializeWorkQueueConsumer()
+	r.declareCancelQueue()
 	r.declareTaskQueue()
 }
 
@@ -96,6 +114,23 @@ func (r *ServiceImpl) initializeWorkQueueConsumer() {
 	r.workQueueName = workQueue.Name()
 }
 
+func (r *ServiceImpl) declareCancelQueue() {
+	cancelQueue, err := r.channel.QueueDeclare(
+		cancelQueueName,
+		wabbit.Option{
+			"durable":    true,
+			"autoDelete": false,
+			"exclusive":  false,
+			"noWait":     false,
+		},
+	)
+	if err != nil {
+		panic("Could not setup cancel_queue")
+	}
+
+	r.cancelQueueName = cancelQueue.Name()
+}
+
 func (r *ServiceImpl) declareTaskQueue() {
 	name := "task_status_queue"
 	taskStatusQueue, err := r.channel.QueueDeclare(
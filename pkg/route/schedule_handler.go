@@ -0,0 +1,133 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/schedule"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// ScheduleHandlerImpl : handles requests for recurring task schedules
+type ScheduleHandlerImpl struct {
+	scheduleStore schedule.Store
+	config        *model.Config
+}
+
+// NewScheduleHandlerImpl creates a new ScheduleHandlerImpl
+func NewScheduleHandlerImpl(scheduleStore schedule.Store, config *model.Config) *ScheduleHandlerImpl {
+	return &ScheduleHandlerImpl{scheduleStore: scheduleStore, config: config}
+}
+
+// CreateSchedule handles schedule creation requests
+func (h *ScheduleHandlerImpl) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	sched := new(model.Schedule)
+	err = sched.UnmarshalBinary(body)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	err = schedule.Prepare(sched, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	err = admissible(&sched.Template, h.config)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	sched.LastTaskID = nil
+
+	id, err := h.scheduleStore.StoreSchedule(*sched)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Printf("Schedule %s created, next run at %s\n", id.String(), sched.NextRun.Format(time.RFC3339))
+
+	w.WriteHeader(201)
+	w.Write([]byte(id.String()))
+}
+
+// GetSchedule : retrieve the schedule denoted by the given id
+func (h *ScheduleHandlerImpl) GetSchedule(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	sched, err := h.scheduleStore.GetSchedule(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if sched == nil {
+		http.Error(w, fmt.Sprintf("schedule %s does not exist", id.String()), 404)
+		return
+	}
+
+	data, err := json.Marshal(sched)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// ListSchedules : retrieve every schedule
+func (h *ScheduleHandlerImpl) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.scheduleStore.ListSchedules()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	data, err := json.Marshal(schedules)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// DeleteSchedule : remove the schedule denoted by the given id, tasks it
+// has already started are left to run
+func (h *ScheduleHandlerImpl) DeleteSchedule(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	removed, err := h.scheduleStore.DeleteSchedule(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !removed {
+		http.Error(w, fmt.Sprintf("schedule %s does not exist", id.String()), 404)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte(id.String()))
+}
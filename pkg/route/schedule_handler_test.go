@@ -0,0 +1,240 @@
+package route_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/route"
+	"github.com/execd/task-store/pkg/schedule"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("schedule handler", func() {
+	var scheduleStore *schedule.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var handler *route.ScheduleHandlerImpl
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		redis := redis.NewClient(s.Addr())
+		uuidGen := util.NewUUIDGenImpl()
+		scheduleStore = schedule.NewStoreImpl(redis, uuidGen)
+		config := &model.Config{Manager: model.ManagerInfo{Resources: model.Resources{model.ResourceCPU: 1000}}}
+		handler = route.NewScheduleHandlerImpl(scheduleStore, config)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	Describe("create schedule", func() {
+		It("should store the schedule with its first run", func() {
+			// Arrange
+			body := []byte(`{"cron": "0 9 * * 1", "timeZone": "Europe/London", "template": {"image": "alpine"}, "overlap": "queue"}`)
+			req, _ := http.NewRequest("POST", "/schedules/", bytes.NewReader(body))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateSchedule(writer, req)
+
+			// Assert
+			assert.Equal(context, 201, writer.Code)
+			id := uuid.FromStringOrNil(writer.Body.String())
+			stored, err := scheduleStore.GetSchedule(&id)
+			assert.Nil(context, err)
+			assert.Equal(context, "0 9 * * 1", stored.Cron)
+			assert.Equal(context, model.OverlapQueue, stored.Overlap)
+			assert.Equal(context, model.CatchUpSkip, stored.CatchUp)
+			assert.NotNil(context, stored.NextRun)
+		})
+
+		It("should return bad request for an invalid cron expression", func() {
+			// Arrange
+			body := []byte(`{"cron": "every day", "template": {"image": "alpine"}}`)
+			req, _ := http.NewRequest("POST", "/schedules/", bytes.NewReader(body))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateSchedule(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+		})
+
+		It("should return bad request for a template with a delay", func() {
+			// Arrange
+			body := []byte(`{"cron": "* * * * *", "template": {"image": "alpine", "delay": "1m"}}`)
+			req, _ := http.NewRequest("POST", "/schedules/", bytes.NewReader(body))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateSchedule(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+		})
+
+		It("should return bad request for a template with dependencies or dedupe", func() {
+			for _, template := range []string{`{"image": "alpine", "dependsOn": ["` + uuid.Must(uuid.NewV4()).String() + `"]}`, `{"image": "alpine", "dedupe": {}}`} {
+				// Arrange
+				body := []byte(`{"cron": "* * * * *", "template": ` + template + `}`)
+				req, _ := http.NewRequest("POST", "/schedules/", bytes.NewReader(body))
+				writer := httptest.NewRecorder()
+
+				// Act
+				handler.CreateSchedule(writer, req)
+
+				// Assert
+				assert.Equal(context, 400, writer.Code, template)
+			}
+		})
+
+		It("should return bad request for a template with a callback url when callbacks are not enabled", func() {
+			// Arrange
+			body := []byte(`{"cron": "* * * * *", "template": {"image": "alpine", "callbackURL": "http://example.com/done"}}`)
+			req, _ := http.NewRequest("POST", "/schedules/", bytes.NewReader(body))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateSchedule(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			assert.Contains(context, writer.Body.String(), "callbacks are not enabled")
+		})
+
+		It("should return bad request for a template that requests more resources than the pool has", func() {
+			// Arrange
+			body := []byte(`{"cron": "* * * * *", "template": {"image": "alpine", "resources": {"cpu": 2000}}}`)
+			req, _ := http.NewRequest("POST", "/schedules/", bytes.NewReader(body))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateSchedule(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			schedules, err := scheduleStore.ListSchedules()
+			assert.Nil(context, err)
+			assert.Empty(context, schedules)
+		})
+
+		It("should return an error if reading body fails", func() {
+			// Arrange
+			req, _ := http.NewRequest("POST", "/schedules/", errReader(0))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateSchedule(writer, req)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+		})
+	})
+
+	Describe("get schedule", func() {
+		It("should return the schedule", func() {
+			// Arrange
+			id, err := scheduleStore.StoreSchedule(model.Schedule{Cron: "* * * * *", Template: model.Spec{Image: "alpine"}})
+			failOnError(err)
+			req, _ := http.NewRequest("GET", "/schedules/"+id.String(), nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetSchedule(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			returned := new(model.Schedule)
+			err = json.Unmarshal(writer.Body.Bytes(), returned)
+			assert.Equal(context, 200, writer.Code)
+			assert.Nil(context, err)
+			assert.Equal(context, *id, *returned.ID)
+			assert.Equal(context, "alpine", returned.Template.Image)
+		})
+
+		It("should return not found if there is no such schedule", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+			req, _ := http.NewRequest("GET", "/schedules/"+id.String(), nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetSchedule(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+	})
+
+	Describe("list schedules", func() {
+		It("should return every schedule", func() {
+			// Arrange
+			_, err := scheduleStore.StoreSchedule(model.Schedule{Cron: "* * * * *", Template: model.Spec{Image: "alpine"}})
+			failOnError(err)
+			_, err = scheduleStore.StoreSchedule(model.Schedule{Cron: "0 * * * *", Template: model.Spec{Image: "busybox"}})
+			failOnError(err)
+			req, _ := http.NewRequest("GET", "/schedules/", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.ListSchedules(writer, req)
+
+			// Assert
+			var returned []model.Schedule
+			err = json.Unmarshal(writer.Body.Bytes(), &returned)
+			assert.Equal(context, 200, writer.Code)
+			assert.Nil(context, err)
+			assert.Len(context, returned, 2)
+		})
+	})
+
+	Describe("delete schedule", func() {
+		It("should remove the schedule", func() {
+			// Arrange
+			id, err := scheduleStore.StoreSchedule(model.Schedule{Cron: "* * * * *", Template: model.Spec{Image: "alpine"}})
+			failOnError(err)
+			req, _ := http.NewRequest("DELETE", "/schedules/"+id.String(), nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.DeleteSchedule(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			stored, err := scheduleStore.GetSchedule(id)
+			assert.Equal(context, 200, writer.Code)
+			assert.Nil(context, err)
+			assert.Nil(context, stored)
+		})
+
+		It("should return not found if there is no such schedule", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+			req, _ := http.NewRequest("DELETE", "/schedules/"+id.String(), nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.DeleteSchedule(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+	})
+})
+
+func failOnError(err error) {
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
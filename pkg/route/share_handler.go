@@ -0,0 +1,81 @@
+package route
+
+import (
+	"encoding/json"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	"net/http"
+)
+
+// namespaceShare : how much of the execution capacity a namespace holds and is entitled to
+type namespaceShare struct {
+	Namespace string  `json:"namespace"`
+	Weight    int64   `json:"weight"`
+	Executing int64   `json:"executing"`
+	Backlog   int64   `json:"backlog"`   // Tasks queued waiting for execution capacity
+	Share     float64 `json:"share"`     // Fraction of the executing tasks that are the namespace's
+	FairShare float64 `json:"fairShare"` // Fraction the namespace's weight entitles it to among namespaces with work
+}
+
+// ShareHandlerImpl : reports how execution capacity is shared between namespaces
+type ShareHandlerImpl struct {
+	taskStore task.Store
+	config    *model.Config
+}
+
+// NewShareHandlerImpl creates a new ShareHandlerImpl
+func NewShareHandlerImpl(taskStore task.Store, config *model.Config) *ShareHandlerImpl {
+	return &ShareHandlerImpl{taskStore: taskStore, config: config}
+}
+
+// GetShares : retrieve the current share and backlog of every namespace, the default namespace first
+func (h *ShareHandlerImpl) GetShares(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := h.taskStore.ListNamespaces()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	stores := []task.Store{h.taskStore}
+	for _, namespace := range namespaces {
+		stores = append(stores, h.taskStore.InNamespace(namespace))
+	}
+
+	shares := make([]*namespaceShare, 0, len(stores))
+	var executing, activeWeight int64
+	for _, store := range stores {
+		share := &namespaceShare{Namespace: model.NamespaceName(store.Namespace()), Weight: h.config.WeightFor(store.Namespace())}
+		share.Executing, err = store.ExecutingSetSize()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		share.Backlog, err = store.TaskQueueSize()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		executing += share.Executing
+		if share.Executing > 0 || share.Backlog > 0 {
+			activeWeight += share.Weight
+		}
+		shares = append(shares, share)
+	}
+
+	for _, share := range shares {
+		if executing > 0 {
+			share.Share = float64(share.Executing) / float64(executing)
+		}
+		if share.Executing > 0 || share.Backlog > 0 {
+			share.FairShare = float64(share.Weight) / float64(activeWeight)
+		}
+	}
+
+	data, err := json.Marshal(shares)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write(data)
+}
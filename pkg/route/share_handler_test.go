@@ -0,0 +1,90 @@
+package route_test
+
+import (
+	"encoding/json"
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/route"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("share handler", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var handler *route.ShareHandlerImpl
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		config := &model.Config{
+			Manager:    model.ManagerInfo{ExecutionQueueSize: 10, TaskQueueSize: 10},
+			Namespaces: map[string]model.NamespaceInfo{"team-a": {Weight: 3}},
+		}
+		handler = route.NewShareHandlerImpl(taskStore, config)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	Describe("get shares", func() {
+		It("should show each namespace's share of the executing tasks and its backlog", func() {
+			// Arrange
+			spec := model.Spec{Image: "alpine"}
+			teamA := taskStore.InNamespace("team-a")
+			for i := 0; i < 3; i++ {
+				created, err := teamA.CreateTask(spec, 10, time.Now())
+				failOnError(err)
+				failOnError(teamA.AddTaskToExecutingSet(created.ID, time.Time{}))
+			}
+			created, err := taskStore.CreateTask(spec, 10, time.Now())
+			failOnError(err)
+			failOnError(taskStore.AddTaskToExecutingSet(created.ID, time.Time{}))
+			_, err = taskStore.CreateTask(spec, 10, time.Now())
+			failOnError(err)
+			req, _ := http.NewRequest("GET", "/shares", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetShares(writer, req)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			var shares []map[string]interface{}
+			failOnError(json.Unmarshal(writer.Body.Bytes(), &shares))
+			assert.Len(context, shares, 2)
+			assert.Equal(context, "default", shares[0]["namespace"])
+			assert.Equal(context, float64(1), shares[0]["executing"])
+			assert.Equal(context, float64(2), shares[0]["backlog"])
+			assert.Equal(context, 0.25, shares[0]["share"])
+			assert.Equal(context, 0.25, shares[0]["fairShare"])
+			assert.Equal(context, "team-a", shares[1]["namespace"])
+			assert.Equal(context, float64(3), shares[1]["weight"])
+			assert.Equal(context, 0.75, shares[1]["share"])
+			assert.Equal(context, 0.75, shares[1]["fairShare"])
+		})
+
+		It("should return error if the namespaces cannot be read", func() {
+			// Arrange
+			directRedis.Close()
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetShares(writer, httptest.NewRequest("GET", "/shares", nil))
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+		})
+	})
+})
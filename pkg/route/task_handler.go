@@ -2,14 +2,76 @@ package route
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/execd/task-store/pkg/model"
 	"github.com/execd/task-store/pkg/task"
 	"github.com/satori/go.uuid"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// idempotencyKeyHeader : the request header a client sets to make task creation safe to retry
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader : the response header set when a creation request is answered from an earlier one
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// deduplicatedHeader : the response header set when a creation request is merged into an identical task
+const deduplicatedHeader = "Task-Deduplicated"
+
+// maxIdempotencyKeyLength : the longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// defaultIdempotencyWindow : how long an idempotency key is remembered when the config does not say
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// errTaskQueueFull : answered when a task is refused because the task queue has reached its limit
+var errTaskQueueFull = errors.New("Failed to create task, task queue has reached its limit!")
+
+// maxBatchSize : the most tasks accepted in a single batch request
+const maxBatchSize = 1000
+
+// taskView : a task's spec along with where it is in its lifecycle
+type taskView struct {
+	*model.Spec
+	State         model.State           `json:"state"`
+	DueAt         *time.Time            `json:"dueAt,omitempty"`
+	BlockedOn     []*uuid.UUID          `json:"blockedOn,omitempty"`
+	MergedCallers []*model.MergedCaller `json:"mergedCallers,omitempty"`
+	Worker        string                `json:"worker,omitempty"` // Worker that last reported executing the task
+	Lease         *model.Lease          `json:"lease,omitempty"`
+	Progress      *model.Progress       `json:"progress,omitempty"`
+	Info          *model.Info           `json:"info,omitempty"` // Result of the task, only included when asked for
+}
+
+// includeInfo : the value of the include query parameter that adds a task's result to the task
+const includeInfo = "info"
+
+// defaultListLimit : the most tasks listed on a page when the request does not say
+const defaultListLimit = 100
+
+// maxListLimit : the most tasks that may be listed on a page
+const maxListLimit = 1000
+
+// batchResult : the outcome of creating one task of a batch, Status is the code the
+// task would have been answered with had it been created on its own
+type batchResult struct {
+	ID     *uuid.UUID `json:"id,omitempty"`
+	Status int        `json:"status"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// queueDepth : the number of queued tasks with a given priority
+type queueDepth struct {
+	Priority int   `json:"priority"`
+	Size     int64 `json:"size"`
+}
+
 // TaskHandler : interface for a task Handler
 type TaskHandler interface {
 	CreateTaskHandler(w http.ResponseWriter, r *http.Request)
@@ -17,16 +79,27 @@ type TaskHandler interface {
 
 // TaskHandlerImpl : implementation of a task Handler
 type TaskHandlerImpl struct {
-	taskStore task.Store
-	config    *model.Config
+	taskStore    task.Store
+	eventManager task.EventManager
+	config       *model.Config
 }
 
 // NewTaskHandlerImpl creates a new HandlerImpl
-func NewTaskHandlerImpl(taskStore task.Store, config *model.Config) *TaskHandlerImpl {
-	return &TaskHandlerImpl{taskStore: taskStore, config: config}
+func NewTaskHandlerImpl(taskStore task.Store, eventManager task.EventManager, config *model.Config) *TaskHandlerImpl {
+	return &TaskHandlerImpl{taskStore: taskStore, eventManager: eventManager, config: config}
 }
 
-// CreateTask handles task creation requests
+// InNamespace : a handler for the tasks of the given namespace, whose keys and limits are its own
+func (h *TaskHandlerImpl) InNamespace(namespace string) (*TaskHandlerImpl, error) {
+	err := model.ValidateNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskHandlerImpl{taskStore: h.taskStore.InNamespace(namespace), eventManager: h.eventManager, config: h.config}, nil
+}
+
+// CreateTask handles task creation requests. A request carrying an Idempotency-Key header
+// already seen within the configured window is answered with the original task's id
 func (h *TaskHandlerImpl) CreateTask(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
@@ -42,43 +115,289 @@ func (h *TaskHandlerImpl) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	size, err := h.taskStore.TaskQueueSize()
+	err = taskSpec.Validate()
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		http.Error(w, err.Error(), 400)
 		return
 	}
 
-	capacity := h.config.Manager.TaskQueueSize
-	if size >= capacity {
-		errStr := fmt.Sprintf("Failed to create task, task queue has reached its limit!")
-		fmt.Println(errStr)
-		http.Error(w, errStr, 500)
+	err = admissible(taskSpec, h.config)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, fmt.Sprintf("idempotency key must not be longer than %d characters", maxIdempotencyKeyLength), 400)
+			return
+		}
+		reserved, original, err := h.taskStore.ReserveIdempotencyKey(key)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if !reserved {
+			h.replay(w, key, original)
+			return
+		}
+	}
+
+	id, code, err := h.createTask(taskSpec)
+	if err != nil {
+		if key != "" {
+			h.releaseIdempotencyKey(key)
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if code == 200 {
+		h.recordMergedCaller(id, r, taskSpec)
+		w.Header().Set(deduplicatedHeader, "true")
+	}
+
+	if key != "" {
+		err = h.taskStore.BindIdempotencyKey(key, id, h.idempotencyWindow())
+		if err != nil {
+			fmt.Printf("Task %s created but could not be recorded against its idempotency key: %s\n", id.String(), err.Error())
+			h.releaseIdempotencyKey(key)
+		}
+	}
+
+	w.WriteHeader(code)
+	w.Write([]byte(id.String()))
+}
+
+// createTask : create the given task, queueing it or holding it back until it is due or its
+// dependencies have succeeded. A task that opted in to dedupe is merged into an identical
+// task that has not yet completed, in which case that task is returned with a 200
+func (h *TaskHandlerImpl) createTask(taskSpec *model.Spec) (*uuid.UUID, int, error) {
+	now := time.Now()
+	taskSpec.ResolveRunAt(now)
+
+	err := task.CheckDependencies(h.taskStore, taskSpec.DependsOn)
+	if err != nil {
+		return nil, 400, err
+	}
+
+	capacity := h.taskQueueSize()
+	created, err := h.taskStore.CreateTask(*taskSpec, capacity, now)
+	if _, full := err.(*task.TaskQueueFullError); full {
+		fmt.Println(errTaskQueueFull.Error())
+		return nil, 500, errTaskQueueFull
+	}
+	if err != nil {
+		return nil, 500, err
+	}
+	if created.Merged {
+		return created.ID, 200, nil
+	}
+
+	id := created.ID
+	event := &model.Event{Type: model.EventCreated, Source: model.SourceAPI, State: createdState(created)}
+	switch created.State {
+	case model.StateDelayed:
+		event.Message = "due at " + taskSpec.RunAt.Format(time.RFC3339)
+		fmt.Printf("Task %s delayed until %s\n", id.String(), taskSpec.RunAt.Format(time.RFC3339))
+	case model.StateQueued:
+		fmt.Printf("Task %s added to task queue - remaining queue capacity is %d\n", id.String(), capacity-created.QueueSize)
+	}
+	task.RecordEvent(h.taskStore, id, event)
+	task.RecordDependencies(h.taskStore, created, len(taskSpec.DependsOn))
+
+	if created.State == model.StateQueued {
+		h.taskStore.PublishTaskCreatedEvent(id)
+	}
+	return id, 201, nil
+}
+
+// CreateTaskBatch handles requests to create many tasks at once. The tasks that are accepted
+// are stored and queued together, so a batch is never partly enqueued. The response holds a
+// result for every task, in the order given, and is a 207 unless every task was created
+func (h *TaskHandlerImpl) CreateTaskBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
 		return
 	}
 
-	id, err := h.taskStore.StoreTask(*taskSpec)
+	var specs []model.Spec
+	err = json.Unmarshal(body, &specs)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
 
-	queueSize, err := h.taskStore.PushTask(id)
+	if len(specs) == 0 || len(specs) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("a batch must hold between 1 and %d tasks", maxBatchSize), 400)
+		return
+	}
+
+	now := time.Now()
+	results := make([]batchResult, len(specs))
+	var accepted []int
+	for i := range specs {
+		err = validateBatchTask(&specs[i], h.config)
+		if err != nil {
+			results[i] = batchResult{Status: 400, Error: err.Error()}
+			continue
+		}
+		specs[i].ResolveRunAt(now)
+		accepted = append(accepted, i)
+	}
+
+	if len(accepted) > 0 {
+		h.storeBatch(specs, accepted, results, now)
+	}
+
+	code := 201
+	for _, result := range results {
+		if result.Status != 201 {
+			code = 207
+			break
+		}
+	}
+
+	data, err := json.Marshal(results)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	fmt.Printf("Task %s added to task queue - remaining queue capacity is %d\n", id.String(), capacity-queueSize)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
 
-	h.taskStore.PublishTaskCreatedEvent(id)
+// createdState : the state recorded on the created event of a task. A task skipped because of the
+// tasks it depends on is created blocked, its skipping is recorded by task.RecordDependencies
+func createdState(created *task.CreatedTask) model.State {
+	if created.State == model.StateSkipped {
+		return model.StateBlocked
+	}
+	return created.State
+}
+
+// storeBatch : store and queue the accepted specs of a batch, as far as the task queue has room
+// for them, filling in their results
+func (h *TaskHandlerImpl) storeBatch(specs []model.Spec, accepted []int, results []batchResult, now time.Time) {
+	batch := make([]model.Spec, len(accepted))
+	for j, i := range accepted {
+		batch[j] = specs[i]
+	}
+
+	ids, err := h.taskStore.StoreTaskBatch(batch, h.taskQueueSize(), now)
 	if err != nil {
-		fmt.Printf("failed to publish task created event for %s: %s\n", id.String(), err.Error())
+		fmt.Printf("Failed to create batch of %d tasks: %s\n", len(batch), err.Error())
+		for _, i := range accepted {
+			results[i] = batchResult{Status: 500, Error: err.Error()}
+		}
+		return
 	}
 
-	w.WriteHeader(201)
-	w.Write([]byte(id.String()))
+	var queued *uuid.UUID
+	stored := 0
+	for j, i := range accepted {
+		if ids[j] == nil {
+			results[i] = batchResult{Status: 500, Error: errTaskQueueFull.Error()}
+			continue
+		}
+		stored++
+		results[i] = batchResult{ID: ids[j], Status: 201}
+		event := &model.Event{Type: model.EventCreated, Source: model.SourceAPI, State: model.StateQueued, Message: "created in a batch"}
+		if batch[j].RunAt == nil || !batch[j].RunAt.After(now) {
+			queued = ids[j]
+		} else {
+			event.State = model.StateDelayed
+		}
+		task.RecordEvent(h.taskStore, ids[j], event)
+	}
+	if stored < len(batch) {
+		fmt.Printf("Batch of %d tasks exceeds remaining task queue capacity %d\n", len(batch), stored)
+	}
+	fmt.Printf("Batch of %d tasks added to the task store\n", stored)
+
+	// one event is enough for the manager to dispatch everything that was queued
+	if queued != nil {
+		h.taskStore.PublishTaskCreatedEvent(queued)
+	}
+}
+
+// admissible : check a valid spec can be run with the given config
+func admissible(taskSpec *model.Spec, config *model.Config) error {
+	err := taskSpec.Resources.FitsWithin(config.Manager.Resources)
+	if err != nil {
+		return err
+	}
+	if taskSpec.CallbackURL != "" && config.Manager.Callbacks.Secret == "" {
+		return errors.New("callbacks are not enabled, there is no secret to sign them with")
+	}
+	return nil
 }
 
-// GetTask : retrieve a task denoted by the given id
+// validateBatchTask : check a spec can be created as part of a batch. Dependencies and
+// dedupe need the store to be consulted per task, so those tasks must be created alone
+func validateBatchTask(taskSpec *model.Spec, config *model.Config) error {
+	err := taskSpec.Validate()
+	if err != nil {
+		return err
+	}
+	err = admissible(taskSpec, config)
+	if err != nil {
+		return err
+	}
+	if len(taskSpec.DependsOn) > 0 {
+		return errors.New("tasks with dependencies cannot be created in a batch")
+	}
+	if taskSpec.Dedupe != nil {
+		return errors.New("tasks with dedupe cannot be created in a batch")
+	}
+	return nil
+}
+
+func (h *TaskHandlerImpl) recordMergedCaller(id *uuid.UUID, r *http.Request, taskSpec *model.Spec) {
+	fmt.Printf("Request from %s merged into task %s\n", r.RemoteAddr, id.String())
+	caller := &model.MergedCaller{At: time.Now(), Source: r.RemoteAddr, Metadata: taskSpec.Metadata}
+	err := h.taskStore.RecordMergedCaller(id, caller)
+	if err != nil {
+		fmt.Printf("Failed to record caller merged into task %s: %s\n", id.String(), err.Error())
+	}
+}
+
+// replay : answer a request whose idempotency key has already been used with the
+// task created for it, or a conflict if that request is still being handled
+func (h *TaskHandlerImpl) replay(w http.ResponseWriter, key string, original *uuid.UUID) {
+	if original == nil {
+		http.Error(w, fmt.Sprintf("a request with idempotency key %q is still in progress", key), 409)
+		return
+	}
+	fmt.Printf("Replaying creation of task %s for idempotency key %q\n", original.String(), key)
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(200)
+	w.Write([]byte(original.String()))
+}
+
+func (h *TaskHandlerImpl) releaseIdempotencyKey(key string) {
+	err := h.taskStore.ReleaseIdempotencyKey(key)
+	if err != nil {
+		fmt.Printf("Failed to release idempotency key %q: %s\n", key, err.Error())
+	}
+}
+
+func (h *TaskHandlerImpl) taskQueueSize() int64 {
+	return h.config.TaskQueueSizeFor(h.taskStore.Namespace())
+}
+
+func (h *TaskHandlerImpl) idempotencyWindow() time.Duration {
+	if h.config.Manager.IdempotencyWindow.Duration > 0 {
+		return h.config.Manager.IdempotencyWindow.Duration
+	}
+	return defaultIdempotencyWindow
+}
+
+// GetTask : retrieve a task denoted by the given id, along with its result if asked to include info
 func (h *TaskHandlerImpl) GetTask(w http.ResponseWriter, r *http.Request, vars map[string]string) {
 	idStr := vars["id"]
 	id, err := uuid.FromString(idStr)
@@ -87,13 +406,78 @@ func (h *TaskHandlerImpl) GetTask(w http.ResponseWriter, r *http.Request, vars m
 		return
 	}
 
+	withInfo := false
+	for _, include := range strings.Split(r.URL.Query().Get("include"), ",") {
+		switch strings.TrimSpace(include) {
+		case "":
+		case includeInfo:
+			withInfo = true
+		default:
+			http.Error(w, fmt.Sprintf("cannot include %s, only %s", include, includeInfo), 400)
+			return
+		}
+	}
+
 	taskSpec, err := h.taskStore.GetTask(&id)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
 
-	data, err := json.Marshal(taskSpec)
+	state, err := h.taskStore.GetTaskState(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	view := &taskView{Spec: taskSpec, State: state}
+	if state == model.StateDelayed {
+		view.DueAt, err = h.taskStore.GetTaskDueTime(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	if state == model.StateBlocked {
+		view.BlockedOn, err = h.taskStore.GetPendingDependencies(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	if state == model.StateScheduled || state == model.StateRunning {
+		view.Worker, err = h.taskStore.GetTaskWorker(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		view.Lease, err = h.taskStore.GetLease(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		view.Progress, err = h.taskStore.GetTaskProgress(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	if taskSpec.Dedupe != nil {
+		view.MergedCallers, err = h.taskStore.GetMergedCallers(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	if withInfo {
+		view.Info, err = h.taskStore.GetTaskInfo(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	data, err := json.Marshal(view)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -102,3 +486,353 @@ func (h *TaskHandlerImpl) GetTask(w http.ResponseWriter, r *http.Request, vars m
 	w.WriteHeader(200)
 	w.Write(data)
 }
+
+// ListTasks : list the tasks matching the filters in the query, the most recently created first. A page
+// holds at most limit tasks, and the nextCursor it is answered with is given as cursor to get the next one
+func (h *TaskHandlerImpl) ListTasks(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	query := r.URL.Query()
+	filter, err := parseTaskFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	limit := defaultListLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			http.Error(w, fmt.Sprintf("limit %s must be a number between 1 and %d", limitStr, maxListLimit), 400)
+			return
+		}
+	}
+
+	var cursor *model.TaskCursor
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, err = model.ParseTaskCursor(cursorStr)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+
+	page, err := h.taskStore.ListTasks(filter, cursor, limit)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// parseTaskFilter : the filter given by the state, image, selector, createdAfter and createdBefore
+// query parameters, the times in RFC 3339 form
+func parseTaskFilter(query url.Values) (*model.TaskFilter, error) {
+	filter := &model.TaskFilter{Image: query.Get("image")}
+	if state := query.Get("state"); state != "" {
+		filter.State = model.State(state)
+		if !filter.State.IsValid() {
+			return nil, fmt.Errorf("state %s is not a state a task may be in", state)
+		}
+	}
+
+	selector, err := model.ParseSelector(query.Get("selector"))
+	if err != nil {
+		return nil, err
+	}
+	filter.Metadata = selector
+
+	filter.CreatedAfter, err = parseQueryTime(query, "createdAfter")
+	if err != nil {
+		return nil, err
+	}
+	filter.CreatedBefore, err = parseQueryTime(query, "createdBefore")
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseQueryTime : the RFC 3339 time given by the query parameter, nil if it is not given
+func parseQueryTime(query url.Values, param string) (*time.Time, error) {
+	value := query.Get(param)
+	if value == "" {
+		return nil, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s is not an RFC 3339 time", param, value)
+	}
+	return &at, nil
+}
+
+// GetTaskInfo : retrieve the result of the task denoted by the given id, including the tree of
+// failures that led to it failing
+func (h *TaskHandlerImpl) GetTaskInfo(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	info, err := h.taskStore.GetTaskInfo(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if info == nil {
+		http.Error(w, fmt.Sprintf("task %s has no result, it does not exist or has not completed", id.String()), 404)
+		return
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// GetTaskEvents : retrieve the history of the task denoted by the given id, oldest event first.
+// Every task records an event when it is created, so a task without any does not exist
+func (h *TaskHandlerImpl) GetTaskEvents(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	events, err := h.taskStore.GetTaskEvents(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, fmt.Sprintf("no events recorded for task %s", id.String()), 404)
+		return
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// GetTaskCallback : retrieve the delivery of the result of the task denoted by the given id to its
+// callback url, along with every attempt made at it
+func (h *TaskHandlerImpl) GetTaskCallback(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	callback, err := h.taskStore.GetCallback(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if callback == nil {
+		http.Error(w, fmt.Sprintf("task %s has no callback, or has not completed", id.String()), 404)
+		return
+	}
+
+	data, err := json.Marshal(callback)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// ListDeadCallbacks : retrieve the deliveries of results that ran out of attempts
+func (h *TaskHandlerImpl) ListDeadCallbacks(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	callbacks, err := h.taskStore.ListDeadCallbacks()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	data, err := json.Marshal(callbacks)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// GetQueueDepth : retrieve the number of queued tasks with the given priority
+func (h *TaskHandlerImpl) GetQueueDepth(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	priorityStr := vars["priority"]
+	priority, err := strconv.Atoi(priorityStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build priority from %s : %s", priorityStr, err.Error()), 400)
+		return
+	}
+
+	size, err := h.taskStore.TaskQueueSizeForPriority(priority)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	data, err := json.Marshal(&queueDepth{Priority: priority, Size: size})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// CancelTask : cancel the task denoted by the given id. A queued, delayed or blocked task is
+// removed straight away, an executing task is asked to stop and is
+// cancelled once its worker confirms. Tasks that depend on a cancelled task are skipped
+func (h *TaskHandlerImpl) CancelTask(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	state, err := h.taskStore.GetTaskState(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if state == model.StateQueued || state == model.StateDelayed || state == model.StateBlocked {
+		err = h.taskStore.TransitionTaskFrom(&id, state, model.StateCancelled)
+		if transitionErr, ok := err.(*task.InvalidTransitionError); ok {
+			// the task was picked up while we were cancelling it
+			state = transitionErr.From
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		} else {
+			task.RecordEvent(h.taskStore, &id, &model.Event{Type: model.EventCancelled, Source: model.SourceAPI, State: model.StateCancelled})
+			h.removeCancelledTask(&id, state)
+			w.WriteHeader(200)
+			w.Write([]byte(id.String()))
+			return
+		}
+	}
+
+	if state != model.StateScheduled && state != model.StateRunning {
+		http.Error(w, fmt.Sprintf("task %s cannot be cancelled, it is %s", id.String(), state), 409)
+		return
+	}
+
+	err = h.eventManager.PublishCancel(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	task.RecordEvent(h.taskStore, &id, &model.Event{Type: model.EventCancelled, Source: model.SourceAPI,
+		State: state, Message: "asked the worker to stop the task"})
+
+	w.WriteHeader(202)
+	w.Write([]byte(id.String()))
+}
+
+// RenewLease : extend the lease of the executing task denoted by the given id on behalf of the worker
+// executing it. A worker whose renewal is refused should stop the task, it has been or will be reaped
+func (h *TaskHandlerImpl) RenewLease(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	renewal := new(model.LeaseRenewal)
+	err = json.Unmarshal(body, renewal)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	err = model.ValidateWorkerID(renewal.Worker)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if renewal.Duration != nil && renewal.Duration.Duration <= 0 {
+		http.Error(w, fmt.Sprintf("lease duration %s must be positive", renewal.Duration.Duration), 400)
+		return
+	}
+
+	duration := h.config.Manager.LeaseDuration.Duration
+	if renewal.Duration != nil {
+		duration = renewal.Duration.Duration
+	}
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+
+	lease, err := h.taskStore.RenewLease(&id, renewal.Worker, until)
+	switch err.(type) {
+	case nil:
+	case *task.LeaseLostError:
+		http.Error(w, err.Error(), 404)
+		return
+	case *task.LeaseHeldError:
+		http.Error(w, err.Error(), 409)
+		return
+	default:
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	data, err := json.Marshal(lease)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func (h *TaskHandlerImpl) removeCancelledTask(id *uuid.UUID, state model.State) {
+	defer task.ResolveDependents(h.taskStore, id, false)
+
+	var err error
+	switch state {
+	case model.StateDelayed:
+		_, err = h.taskStore.RemoveDelayedTask(id)
+	case model.StateQueued:
+		_, err = h.taskStore.RemoveTaskFromQueue(id)
+	}
+	if err != nil {
+		fmt.Printf("Task %s cancelled but could not be removed from the %s tasks: %s\n", id.String(), state, err.Error())
+	}
+}
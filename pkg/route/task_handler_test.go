@@ -17,6 +17,8 @@ import (
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 )
 
 var context = GinkgoT()
@@ -25,6 +27,7 @@ var _ = Describe("task handler", func() {
 	var taskStore *task.StoreImpl
 	var directRedis *miniredis.Miniredis
 	var handler *route.TaskHandlerImpl
+	var eventManagerMock *mocks.EventManager
 
 	BeforeEach(func() {
 		s, err := miniredis.Run()
@@ -41,7 +44,8 @@ var _ = Describe("task handler", func() {
 				TaskQueueSize:      10,
 			},
 		}
-		handler = route.NewTaskHandlerImpl(taskStore, config)
+		eventManagerMock = &mocks.EventManager{}
+		handler = route.NewTaskHandlerImpl(taskStore, eventManagerMock, config)
 	})
 
 	Describe("create task", func() {
@@ -104,6 +108,116 @@ var _ = Describe("task handler", func() {
 			assert.NotNil(context, id)
 		})
 
+		It("should hold a task with a delay back until it is due", func() {
+			// Arrange
+			taskString := `{"image": "alpine", "init": "init.sh", "delay": "1h"}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 201, writer.Code)
+			id, err := uuid.FromString(writer.Body.String())
+			assert.Nil(context, err)
+			state, err := taskStore.GetTaskState(&id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateDelayed, state)
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(0), size)
+			dueAt, err := taskStore.GetTaskDueTime(&id)
+			assert.Nil(context, err)
+			assert.WithinDuration(context, time.Now().Add(time.Hour), *dueAt, time.Minute)
+		})
+
+		It("should block a task until the tasks it depends on have succeeded", func() {
+			// Arrange
+			parentID, err := storeTask(taskStore, model.Spec{Image: "alpine"})
+			failOnError(err)
+			_, err = taskStore.RemoveTaskFromQueue(parentID)
+			failOnError(err)
+			taskString := `{"image": "alpine", "init": "init.sh", "dependsOn": ["` + parentID.String() + `"]}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 201, writer.Code)
+			id, err := uuid.FromString(writer.Body.String())
+			assert.Nil(context, err)
+			state, err := taskStore.GetTaskState(&id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateBlocked, state)
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(0), size)
+			pending, err := taskStore.GetPendingDependencies(&id)
+			assert.Nil(context, err)
+			assert.Equal(context, []*uuid.UUID{parentID}, pending)
+		})
+
+		It("should return error if the task depends on a task that does not exist", func() {
+			// Arrange
+			unknownID := uuid.Must(uuid.NewV4())
+			taskString := `{"image": "alpine", "init": "init.sh", "dependsOn": ["` + unknownID.String() + `"]}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			assert.Contains(context, writer.Body.String(), "does not exist")
+		})
+
+		It("should return error if the task is not valid", func() {
+			// Arrange
+			taskString := `{"image": "alpine", "init": "init.sh", "priority": 5000}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			assert.Contains(context, writer.Body.String(), "priority 5000 is outside of the allowed range")
+		})
+
+		It("should return error if the task asks for a callback but no secret is configured", func() {
+			// Arrange
+			taskString := `{"image": "alpine", "init": "init.sh", "callbackURL": "http://example.com/done"}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			assert.Contains(context, writer.Body.String(), "callbacks are not enabled")
+		})
+
+		It("should return error if the task requests more resources than the pool has", func() {
+			// Arrange
+			taskString := `{"image": "alpine", "init": "init.sh", "resources": {"cpu": 2000}}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			size, _ := taskStore.TaskQueueSize()
+			assert.Equal(context, int64(0), size)
+		})
+
 		It("should return error of task queue size is greater than max task queue size", func() {
 			// Arrange
 			config := &model.Config{
@@ -112,7 +226,7 @@ var _ = Describe("task handler", func() {
 					TaskQueueSize:      0,
 				},
 			}
-			handler = route.NewTaskHandlerImpl(taskStore, config)
+			handler = route.NewTaskHandlerImpl(taskStore, eventManagerMock, config)
 			givenID := uuid.Must(uuid.NewV4())
 			taskStore.PushTask(&givenID)
 			taskString := `{"name": "test", "image": "alpine", "init": "init.sh"}`
@@ -120,39 +234,519 @@ var _ = Describe("task handler", func() {
 			writer := httptest.NewRecorder()
 
 			// Act
-			handler.CreateTask(writer, req)
+			handler.CreateTask(writer, req)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+			assert.Equal(context, writer.Body.String(), "Failed to create task, task queue has reached its limit!\n")
+		})
+	})
+
+	Describe("create task in a namespace", func() {
+		var namespaceHandler *route.TaskHandlerImpl
+
+		BeforeEach(func() {
+			config := &model.Config{
+				Manager:    model.ManagerInfo{ExecutionQueueSize: 10, TaskQueueSize: 10},
+				Namespaces: map[string]model.NamespaceInfo{"team-a": {TaskQueueSize: 1}},
+			}
+			handler = route.NewTaskHandlerImpl(taskStore, eventManagerMock, config)
+			h, err := handler.InNamespace("team-a")
+			failOnError(err)
+			namespaceHandler = h
+		})
+
+		create := func(h *route.TaskHandlerImpl) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(`{"image": "alpine"}`)))
+			writer := httptest.NewRecorder()
+			h.CreateTask(writer, req)
+			return writer
+		}
+
+		It("should hold the namespace to its own task queue limit", func() {
+			// Arrange
+			assert.Equal(context, 201, create(namespaceHandler).Code)
+
+			// Act
+			writer := create(namespaceHandler)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+			assert.Equal(context, 201, create(handler).Code)
+		})
+
+		It("should only find a task in the namespace it was created in", func() {
+			// Arrange
+			id := create(namespaceHandler).Body.String()
+			vars := map[string]string{"id": id}
+
+			// Act
+			writer := httptest.NewRecorder()
+			namespaceHandler.GetTask(writer, httptest.NewRequest("GET", "/handle", nil), vars)
+			defaultWriter := httptest.NewRecorder()
+			handler.GetTask(defaultWriter, httptest.NewRequest("GET", "/handle", nil), vars)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			assert.NotEqual(context, 200, defaultWriter.Code)
+		})
+
+		It("should reject a namespace that is not a DNS label", func() {
+			// Act
+			_, err := handler.InNamespace("Team:A")
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("create task batch", func() {
+		createBatch := func(batch string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(batch)))
+			writer := httptest.NewRecorder()
+			handler.CreateTaskBatch(writer, req)
+			var results []map[string]interface{}
+			json.Unmarshal(writer.Body.Bytes(), &results)
+			return writer, results
+		}
+
+		It("should create and queue every task of the batch", func() {
+			// Arrange
+			batch := `[{"image": "alpine", "init": "init.sh"}, {"image": "alpine", "init": "init.sh", "delay": "1h"}]`
+
+			// Act
+			writer, results := createBatch(batch)
+
+			// Assert
+			assert.Equal(context, 201, writer.Code)
+			assert.Len(context, results, 2)
+			id, err := uuid.FromString(results[0]["id"].(string))
+			assert.Nil(context, err)
+			state, err := taskStore.GetTaskState(&id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateQueued, state)
+			id, err = uuid.FromString(results[1]["id"].(string))
+			assert.Nil(context, err)
+			state, err = taskStore.GetTaskState(&id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateDelayed, state)
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should report invalid tasks and still create the rest", func() {
+			// Arrange
+			parent := uuid.Must(uuid.NewV4())
+			batch := `[{"image": "alpine", "priority": 5000}, {"image": "alpine"}, {"image": "alpine", "dependsOn": ["` + parent.String() + `"]}]`
+
+			// Act
+			writer, results := createBatch(batch)
+
+			// Assert
+			assert.Equal(context, 207, writer.Code)
+			assert.Equal(context, float64(400), results[0]["status"])
+			assert.NotEmpty(context, results[0]["error"])
+			assert.Equal(context, float64(201), results[1]["status"])
+			assert.NotNil(context, results[1]["id"])
+			assert.Equal(context, float64(400), results[2]["status"])
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should report the tasks that do not fit in the task queue", func() {
+			// Arrange
+			for i := 0; i < 8; i++ {
+				givenID := uuid.Must(uuid.NewV4())
+				taskStore.PushTask(&givenID)
+			}
+			batch := `[{"image": "alpine"}, {"image": "alpine"}, {"image": "alpine"}]`
+
+			// Act
+			writer, results := createBatch(batch)
+
+			// Assert
+			assert.Equal(context, 207, writer.Code)
+			assert.Equal(context, float64(201), results[0]["status"])
+			assert.Equal(context, float64(201), results[1]["status"])
+			assert.Equal(context, float64(500), results[2]["status"])
+			assert.Equal(context, "Failed to create task, task queue has reached its limit!", results[2]["error"])
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(10), size)
+		})
+
+		It("should return error if the batch is empty", func() {
+			// Act
+			writer, _ := createBatch(`[]`)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+		})
+
+		It("should return error if request body does not contain a batch", func() {
+			// Act
+			writer, _ := createBatch(`{"image": "alpine"}`)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+		})
+
+		It("should report every task as failed if the batch cannot be stored", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			writer, results := createBatch(`[{"image": "alpine"}]`)
+
+			// Assert
+			assert.Equal(context, 207, writer.Code)
+			assert.Len(context, results, 1)
+			assert.Equal(context, float64(500), results[0]["status"])
+		})
+	})
+
+	Describe("create task with an idempotency key", func() {
+		createWithKey := func(key string) *httptest.ResponseRecorder {
+			taskString := `{"image": "alpine", "init": "init.sh"}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			req.Header.Set("Idempotency-Key", key)
+			writer := httptest.NewRecorder()
+			handler.CreateTask(writer, req)
+			return writer
+		}
+
+		It("should return the original task for a repeated request without queueing a copy", func() {
+			// Arrange
+			first := createWithKey("create-1")
+
+			// Act
+			second := createWithKey("create-1")
+
+			// Assert
+			assert.Equal(context, 201, first.Code)
+			assert.Equal(context, 200, second.Code)
+			assert.Equal(context, first.Body.String(), second.Body.String())
+			assert.Equal(context, "true", second.Header().Get("Idempotent-Replayed"))
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should create separate tasks for different keys", func() {
+			// Act
+			first := createWithKey("create-1")
+			second := createWithKey("create-2")
+
+			// Assert
+			assert.Equal(context, 201, first.Code)
+			assert.Equal(context, 201, second.Code)
+			assert.NotEqual(context, first.Body.String(), second.Body.String())
+		})
+
+		It("should return a conflict while the original request is still being handled", func() {
+			// Arrange
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
+			failOnError(err)
+
+			// Act
+			writer := createWithKey("create-1")
+
+			// Assert
+			assert.Equal(context, 409, writer.Code)
+		})
+
+		It("should let a failed request be retried with the same key", func() {
+			// Arrange
+			full := &model.Config{Manager: model.ManagerInfo{TaskQueueSize: 0}}
+			handler = route.NewTaskHandlerImpl(taskStore, eventManagerMock, full)
+			failed := createWithKey("create-1")
+			handler = route.NewTaskHandlerImpl(taskStore, eventManagerMock, &model.Config{Manager: model.ManagerInfo{TaskQueueSize: 10}})
+
+			// Act
+			retried := createWithKey("create-1")
+
+			// Assert
+			assert.Equal(context, 500, failed.Code)
+			assert.Equal(context, 201, retried.Code)
+		})
+	})
+
+	Describe("create task with dedupe", func() {
+		taskString := `{"image": "alpine", "init": "init.sh", "metadata": {"repo": "task-store"}, "dedupe": {"metadataKeys": ["repo"]}}`
+
+		createDeduped := func() *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			req.RemoteAddr = "10.0.0.1:5000"
+			writer := httptest.NewRecorder()
+			handler.CreateTask(writer, req)
+			return writer
+		}
+
+		It("should merge an identical request into the queued task and record the caller", func() {
+			// Arrange
+			first := createDeduped()
+
+			// Act
+			second := createDeduped()
+
+			// Assert
+			assert.Equal(context, 201, first.Code)
+			assert.Equal(context, 200, second.Code)
+			assert.Equal(context, "true", second.Header().Get("Task-Deduplicated"))
+			assert.Equal(context, first.Body.String(), second.Body.String())
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+			id := uuid.FromStringOrNil(first.Body.String())
+			callers, err := taskStore.GetMergedCallers(&id)
+			assert.Nil(context, err)
+			assert.Len(context, callers, 1)
+			assert.Equal(context, "10.0.0.1:5000", callers[0].Source)
+			assert.Equal(context, "task-store", callers[0].Metadata["repo"])
+		})
+
+		It("should leave nothing behind of a merged request", func() {
+			// Arrange
+			first := createDeduped()
+
+			// Act
+			createDeduped()
+
+			// Assert
+			req, _ := http.NewRequest("GET", "/handle", nil)
+			writer := httptest.NewRecorder()
+			handler.ListTasks(writer, req, map[string]string{})
+			view := new(model.TaskPage)
+			failOnError(json.Unmarshal(writer.Body.Bytes(), view))
+			assert.Len(context, view.Tasks, 1)
+			assert.Equal(context, first.Body.String(), view.Tasks[0].ID.String())
+			for _, key := range directRedis.Keys() {
+				if strings.HasPrefix(key, "task:") {
+					assert.Contains(context, key, first.Body.String())
+				}
+			}
+		})
+
+		It("should create a new task once the identical task has completed", func() {
+			// Arrange
+			first := createDeduped()
+			id := uuid.FromStringOrNil(first.Body.String())
+			failOnError(taskStore.TransitionTask(&id, model.StateCancelled))
+
+			// Act
+			second := createDeduped()
+
+			// Assert
+			assert.Equal(context, 201, second.Code)
+			assert.NotEqual(context, first.Body.String(), second.Body.String())
+		})
+	})
+
+	Describe("renew lease", func() {
+		var id uuid.UUID
+
+		BeforeEach(func() {
+			id = uuid.Must(uuid.NewV4())
+		})
+
+		It("should extend the lease of an executing task for the worker executing it", func() {
+			// Arrange
+			failOnError(taskStore.AddTaskToExecutingSet(&id, time.Now().Add(time.Second)))
+			body := `{"worker": "worker-1", "duration": "1m"}`
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(body)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.RenewLease(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			lease := new(model.Lease)
+			assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), lease))
+			assert.Equal(context, "worker-1", lease.Worker)
+			assert.WithinDuration(context, time.Now().Add(time.Minute), *lease.ExpiresAt, 10*time.Second)
+		})
+
+		It("should return bad request if the duration is not positive", func() {
+			// Arrange
+			failOnError(taskStore.AddTaskToExecutingSet(&id, time.Now().Add(time.Minute)))
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(`{"worker": "worker-1", "duration": "-1m"}`)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.RenewLease(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			lease, err := taskStore.GetLease(&id)
+			failOnError(err)
+			assert.Empty(context, lease.Worker)
+			assert.WithinDuration(context, time.Now().Add(time.Minute), *lease.ExpiresAt, 10*time.Second)
+		})
+
+		It("should return not found if the task holds no live lease", func() {
+			// Arrange
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(`{"worker": "worker-1"}`)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.RenewLease(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+
+		It("should return a conflict if another worker holds the lease", func() {
+			// Arrange
+			failOnError(taskStore.AddTaskToExecutingSet(&id, time.Time{}))
+			_, err := taskStore.RenewLease(&id, "worker-1", time.Time{})
+			failOnError(err)
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(`{"worker": "worker-2"}`)))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.RenewLease(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 409, writer.Code)
+		})
+	})
+
+	Describe("get task", func() {
+		It("should return the task related to the given id", func() {
+			// Arrange
+			givenTaskSpec := model.Spec{
+				Image:    "alpine",
+				Init:     "init.sh",
+				InitArgs: []string{"10"},
+			}
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader(nil))
+
+			writer := httptest.NewRecorder()
+			givenTaskSpec.ID = id
+			vars := map[string]string{
+				"id": id.String(),
+			}
+			// Act
+			handler.GetTask(writer, req, vars)
+
+			// Assert
+			taskSpec := new(model.Spec)
+			json.Unmarshal(writer.Body.Bytes(), taskSpec)
+			assert.Equal(context, 200, writer.Code)
+			assert.Equal(context, givenTaskSpec, *taskSpec)
+		})
+
+		It("should include the result of the task when asked to", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", Init: "init.sh"})
+			failOnError(err)
+			failure := &model.FailureStatus{Type: "pod", Name: "build", Reason: "Error",
+				ChildStatus: []model.FailureStatus{{Type: "container", Name: "compile", Reason: "OOMKilled"}}}
+			failOnError(taskStore.UpdateTaskInfo(&model.Info{ID: id, FailureStats: failure}))
+			req, _ := http.NewRequest("GET", "/handle?include=info", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTask(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			var view struct {
+				Image string      `json:"image"`
+				Info  *model.Info `json:"info"`
+			}
+			assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), &view))
+			assert.Equal(context, "alpine", view.Image)
+			assert.Equal(context, failure, view.Info.FailureStats)
+		})
+
+		It("should leave out the result of the task unless asked to include it", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", Init: "init.sh"})
+			failOnError(err)
+			failOnError(taskStore.UpdateTaskInfo(&model.Info{ID: id, Succeeded: true}))
+			req, _ := http.NewRequest("GET", "/handle", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTask(writer, req, map[string]string{"id": id.String()})
 
 			// Assert
-			assert.Equal(context, 500, writer.Code)
-			assert.Equal(context, writer.Body.String(), "Failed to create task, task queue has reached its limit!\n")
+			assert.Equal(context, 200, writer.Code)
+			assert.NotContains(context, writer.Body.String(), `"info"`)
 		})
-	})
 
-	Describe("get task", func() {
-		It("should return the task related to the given id", func() {
+		It("should return error if asked to include something it cannot", func() {
 			// Arrange
-			givenTaskSpec := model.Spec{
-				Image:    "alpine",
-				Init:     "init.sh",
-				InitArgs: []string{"10"},
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", Init: "init.sh"})
+			failOnError(err)
+			req, _ := http.NewRequest("GET", "/handle?include=everything", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTask(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+		})
+
+		It("should show the progress of an executing task", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", Init: "init.sh"})
+			failOnError(err)
+			failOnError(taskStore.TransitionTask(id, model.StateScheduled))
+			failOnError(taskStore.TransitionTask(id, model.StateRunning))
+			percent := 60.0
+			failOnError(taskStore.UpdateTaskProgress(&model.Info{ID: id, Status: model.InfoProgress, Percent: &percent,
+				Phase: "testing", Message: "12 of 20 suites"}, time.Now()))
+			req, _ := http.NewRequest("GET", "/handle", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTask(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			var view struct {
+				State    model.State     `json:"state"`
+				Progress *model.Progress `json:"progress"`
 			}
-			id, err := taskStore.StoreTask(givenTaskSpec)
-			assert.Nil(context, err)
-			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader(nil))
+			assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), &view))
+			assert.Equal(context, model.StateRunning, view.State)
+			assert.Equal(context, percent, *view.Progress.Percent)
+			assert.Equal(context, "testing", view.Progress.Phase)
+			assert.Equal(context, "12 of 20 suites", view.Progress.Message)
+		})
 
+		It("should show the state of the task and when a delayed task is due", func() {
+			// Arrange
+			runAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+			givenTaskSpec := model.Spec{Image: "alpine", RunAt: &runAt}
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
 			writer := httptest.NewRecorder()
-			givenTaskSpec.ID = id
 			vars := map[string]string{
 				"id": id.String(),
 			}
+
 			// Act
 			handler.GetTask(writer, req, vars)
 
 			// Assert
-			taskSpec := new(model.Spec)
-			json.Unmarshal(writer.Body.Bytes(), taskSpec)
+			view := struct {
+				State model.State `json:"state"`
+				DueAt *time.Time  `json:"dueAt"`
+			}{}
+			json.Unmarshal(writer.Body.Bytes(), &view)
 			assert.Equal(context, 200, writer.Code)
-			assert.Equal(context, givenTaskSpec, *taskSpec)
+			assert.Equal(context, model.StateDelayed, view.State)
+			assert.True(context, runAt.Equal(*view.DueAt))
 		})
 
 		It("should return error if id is not a v4 uuid", func() {
@@ -204,7 +798,7 @@ var _ = Describe("task handler", func() {
 					TaskQueueSize:      10,
 				},
 			}
-			handler = route.NewTaskHandlerImpl(taskStoreMock, config)
+			handler = route.NewTaskHandlerImpl(taskStoreMock, eventManagerMock, config)
 
 			taskStoreMock.On("GetTask", mock.Anything).Return(nil, errors.New("error"))
 			// Act
@@ -215,6 +809,429 @@ var _ = Describe("task handler", func() {
 			assert.Equal(context, "error\n", writer.Body.String())
 		})
 	})
+
+	Describe("get queue depth", func() {
+		It("should return the number of queued tasks with the given priority", func() {
+			// Arrange
+			_, err := storeTask(taskStore, model.Spec{Image: "alpine", Priority: 3})
+			assert.Nil(context, err)
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"priority": "3",
+			}
+
+			// Act
+			handler.GetQueueDepth(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			assert.JSONEq(context, `{"priority": 3, "size": 1}`, writer.Body.String())
+		})
+
+		It("should return error if priority is not a number", func() {
+			// Arrange
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"priority": "high",
+			}
+
+			// Act
+			handler.GetQueueDepth(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			assert.Contains(context, writer.Body.String(), "failed to build priority from high")
+		})
+	})
+
+	Describe("get task info", func() {
+		It("should return the result of the task with its tree of failures", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", Init: "init.sh"})
+			failOnError(err)
+			info := &model.Info{ID: id, FailureStats: &model.FailureStatus{Type: "pod", Name: "build", Reason: "Error",
+				ChildStatus: []model.FailureStatus{{Type: "container", Name: "compile", Reason: "OOMKilled", Message: "exit 137"}}}}
+			failOnError(taskStore.UpdateTaskInfo(info))
+			req, _ := http.NewRequest("GET", "/handle", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTaskInfo(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			stored := new(model.Info)
+			assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), stored))
+			assert.Equal(context, info, stored)
+		})
+
+		It("should return not found for a task that has not completed", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", Init: "init.sh"})
+			failOnError(err)
+			req, _ := http.NewRequest("GET", "/handle", nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTaskInfo(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+	})
+
+	Describe("list tasks", func() {
+		It("should list the tasks matching the filters a page at a time", func() {
+			// Arrange
+			var ids []*uuid.UUID
+			for i := 0; i < 3; i++ {
+				id, err := storeTask(taskStore, model.Spec{Image: "alpine", Metadata: map[string]string{"team": "a"}})
+				failOnError(err)
+				ids = append(ids, id)
+			}
+			_, err := storeTask(taskStore, model.Spec{Image: "alpine", Metadata: map[string]string{"team": "b"}})
+			failOnError(err)
+			listed := map[uuid.UUID]bool{}
+			cursor := ""
+
+			// Act
+			for page := 0; page < 2; page++ {
+				req, _ := http.NewRequest("GET", "/handle?state=queued&image=alpine&selector=team%3Da&limit=2&cursor="+cursor, nil)
+				writer := httptest.NewRecorder()
+				handler.ListTasks(writer, req, map[string]string{})
+				assert.Equal(context, 200, writer.Code)
+				view := new(model.TaskPage)
+				assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), view))
+				for _, summary := range view.Tasks {
+					assert.Equal(context, model.StateQueued, summary.State)
+					listed[*summary.ID] = true
+				}
+				cursor = view.NextCursor
+			}
+
+			// Assert
+			assert.Empty(context, cursor)
+			assert.Len(context, listed, 3)
+			for _, id := range ids {
+				assert.True(context, listed[*id])
+			}
+		})
+
+		It("should reject filters that cannot be applied", func() {
+			for _, query := range []string{"state=paused", "selector=team", "createdAfter=yesterday", "limit=0", "limit=5000", "cursor=nonsense"} {
+				// Arrange
+				req, _ := http.NewRequest("GET", "/handle?"+query, nil)
+				writer := httptest.NewRecorder()
+
+				// Act
+				handler.ListTasks(writer, req, map[string]string{})
+
+				// Assert
+				assert.Equal(context, 400, writer.Code, query)
+			}
+		})
+	})
+
+	Describe("task callbacks", func() {
+		It("should return the delivery of a task's result with its attempts", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/done"})
+			failOnError(err)
+			_, err = taskStore.ScheduleCallback(id, time.Now())
+			failOnError(err)
+			callback, err := taskStore.GetCallback(id)
+			failOnError(err)
+			callback.Attempts = []model.CallbackAttempt{{At: time.Now(), Error: "connection refused"}}
+			failOnError(taskStore.UpdateCallback(callback))
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTaskCallback(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			view := new(model.Callback)
+			assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), view))
+			assert.Equal(context, model.CallbackPending, view.State)
+			assert.Equal(context, "connection refused", view.Attempts[0].Error)
+		})
+
+		It("should return not found for a task without a callback", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine"})
+			failOnError(err)
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetTaskCallback(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+
+		It("should list the dead-lettered deliveries", func() {
+			// Arrange
+			id, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/done"})
+			failOnError(err)
+			failOnError(taskStore.UpdateCallback(&model.Callback{TaskID: id, URL: "http://example.com/done", State: model.CallbackDead}))
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.ListDeadCallbacks(writer, req, map[string]string{})
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			var dead []model.Callback
+			assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), &dead))
+			assert.Len(context, dead, 1)
+			assert.Equal(context, id, dead[0].TaskID)
+		})
+	})
+
+	Describe("get task events", func() {
+		createTask := func(taskString string) *uuid.UUID {
+			req, _ := http.NewRequest("POST", "/handle", bytes.NewReader([]byte(taskString)))
+			writer := httptest.NewRecorder()
+			handler.CreateTask(writer, req)
+			id, err := uuid.FromString(writer.Body.String())
+			failOnError(err)
+			return &id
+		}
+
+		getEvents := func(id *uuid.UUID) (*httptest.ResponseRecorder, []model.Event) {
+			req, _ := http.NewRequest("GET", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			handler.GetTaskEvents(writer, req, map[string]string{"id": id.String()})
+			var events []model.Event
+			json.Unmarshal(writer.Body.Bytes(), &events)
+			return writer, events
+		}
+
+		It("should return the events of a task that was created and cancelled", func() {
+			// Arrange
+			id := createTask(`{"image": "alpine", "init": "init.sh"}`)
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			handler.CancelTask(httptest.NewRecorder(), req, map[string]string{"id": id.String()})
+
+			// Act
+			writer, events := getEvents(id)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			assert.Len(context, events, 2)
+			assert.Equal(context, model.EventCreated, events[0].Type)
+			assert.Equal(context, model.SourceAPI, events[0].Source)
+			assert.Equal(context, model.StateQueued, events[0].State)
+			assert.Equal(context, model.EventCancelled, events[1].Type)
+			assert.Equal(context, model.StateCancelled, events[1].State)
+			assert.False(context, events[1].At.Before(events[0].At))
+		})
+
+		It("should record that a task is blocked on the tasks it depends on", func() {
+			// Arrange
+			parentID, err := storeTask(taskStore, model.Spec{Image: "alpine"})
+			failOnError(err)
+			id := createTask(`{"image": "alpine", "init": "init.sh", "dependsOn": ["` + parentID.String() + `"]}`)
+
+			// Act
+			writer, events := getEvents(id)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			assert.Len(context, events, 2)
+			assert.Equal(context, model.EventCreated, events[0].Type)
+			assert.Equal(context, model.EventBlocked, events[1].Type)
+			assert.Equal(context, model.SourceDependencies, events[1].Source)
+			assert.Equal(context, model.StateBlocked, events[1].State)
+		})
+
+		It("should return not found if the task does not exist", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+
+			// Act
+			writer, _ := getEvents(&id)
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+	})
+
+	Describe("cancel task", func() {
+		var givenTaskSpec model.Spec
+
+		BeforeEach(func() {
+			givenTaskSpec = model.Spec{
+				Image: "alpine",
+				Init:  "init.sh",
+			}
+		})
+
+		It("should cancel a queued task and remove it from the task queue", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": id.String(),
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateCancelled, state)
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(0), size)
+			eventManagerMock.AssertNotCalled(context, "PublishCancel", mock.Anything)
+		})
+
+		It("should cancel a delayed task and remove it from the delayed tasks", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			assert.Nil(context, taskStore.TransitionTask(id, model.StateScheduled))
+			assert.Nil(context, taskStore.TransitionTask(id, model.StateDelayed))
+			assert.Nil(context, taskStore.DelayTask(id, time.Now()))
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": id.String(),
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateCancelled, state)
+			due, err := taskStore.PopDueTasks(time.Now())
+			assert.Nil(context, err)
+			assert.Empty(context, due)
+		})
+
+		It("should cancel a blocked task and skip the tasks that depend on it", func() {
+			// Arrange
+			parentID, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+			blockedSpec := givenTaskSpec
+			blockedSpec.DependsOn = []uuid.UUID{*parentID}
+			id, err := storeTask(taskStore, blockedSpec)
+			failOnError(err)
+			childSpec := givenTaskSpec
+			childSpec.DependsOn = []uuid.UUID{*id}
+			childID, err := storeTask(taskStore, childSpec)
+			failOnError(err)
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": id.String(),
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 200, writer.Code)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateCancelled, state)
+			childState, err := taskStore.GetTaskState(childID)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateSkipped, childState)
+		})
+
+		It("should ask the worker to stop an executing task", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			assert.Nil(context, taskStore.TransitionTask(id, model.StateScheduled))
+			eventManagerMock.On("PublishCancel", id).Return(nil)
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": id.String(),
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 202, writer.Code)
+			eventManagerMock.AssertCalled(context, "PublishCancel", id)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateScheduled, state)
+		})
+
+		It("should return error if publishing the cancel request fails", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			assert.Nil(context, taskStore.TransitionTask(id, model.StateScheduled))
+			eventManagerMock.On("PublishCancel", id).Return(errors.New("error"))
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": id.String(),
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+			assert.Equal(context, "error\n", writer.Body.String())
+		})
+
+		It("should return a conflict if the task has already completed", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			assert.Nil(context, taskStore.TransitionTask(id, model.StateScheduled))
+			assert.Nil(context, taskStore.TransitionTask(id, model.StateSucceeded))
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": id.String(),
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 409, writer.Code)
+			assert.Contains(context, writer.Body.String(), "cannot be cancelled, it is succeeded")
+		})
+
+		It("should return error if id is not a v4 uuid", func() {
+			// Arrange
+			req, _ := http.NewRequest("DELETE", "/handle", bytes.NewReader(nil))
+			writer := httptest.NewRecorder()
+			vars := map[string]string{
+				"id": "1234",
+			}
+
+			// Act
+			handler.CancelTask(writer, req, vars)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+			assert.Contains(context, writer.Body.String(), "failed to build id from 1234")
+		})
+	})
 })
 
 type errReader int
@@ -222,3 +1239,12 @@ type errReader int
 func (errReader) Read(p []byte) (n int, err error) {
 	return 0, errors.New("error")
 }
+
+// storeTask : create the given task in the given store, returning its id
+func storeTask(store task.Store, taskSpec model.Spec) (*uuid.UUID, error) {
+	created, err := store.CreateTask(taskSpec, 100, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return created.ID, nil
+}
@@ -0,0 +1,152 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+// watchKeepAlive : how often a watch stream that has nothing to say shows it is still open,
+// so proxies do not close it for being idle
+const watchKeepAlive = 15 * time.Second
+
+// WatchTask : stream what happens to the task denoted by the given id as Server-Sent Events, starting with
+// the latest event recorded for it. The stream ends once the task reaches a terminal state
+func (h *TaskHandlerImpl) WatchTask(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	stream, err := openEventStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// watch before reading the history, so nothing that happens in between is missed
+	statuses, stop := h.taskStore.WatchTaskStatus()
+	defer stop()
+
+	events, err := h.taskStore.GetTaskEvents(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, fmt.Sprintf("no events recorded for task %s", id.String()), 404)
+		return
+	}
+
+	latest := &model.TaskStatus{TaskID: &id, Namespace: h.taskStore.Namespace(), Event: *events[len(events)-1]}
+	if taskSpec, err := h.taskStore.GetTask(&id); err == nil {
+		latest.Metadata = taskSpec.Metadata
+	}
+	stream.start()
+	stream.send(latest)
+	if latest.State.IsTerminal() {
+		return
+	}
+
+	h.streamStatuses(r, stream, statuses, func(status *model.TaskStatus) bool {
+		return uuid.Equal(*status.TaskID, id)
+	}, func(status *model.TaskStatus) bool {
+		return status.State.IsTerminal()
+	})
+}
+
+// WatchTasks : stream what happens to the tasks whose metadata matches the selector given
+// in the query as Server-Sent Events, until the client goes away
+func (h *TaskHandlerImpl) WatchTasks(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	selector, err := model.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	stream, err := openEventStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	statuses, stop := h.taskStore.WatchTaskStatus()
+	defer stop()
+
+	stream.start()
+	h.streamStatuses(r, stream, statuses, func(status *model.TaskStatus) bool {
+		return selector.Matches(status.Metadata)
+	}, func(*model.TaskStatus) bool {
+		return false
+	})
+}
+
+// streamStatuses : send the statuses of this handler's namespace that are selected until
+// one is last, the client goes away or the watch is dropped for falling behind
+func (h *TaskHandlerImpl) streamStatuses(r *http.Request, stream *eventStream, statuses <-chan *model.TaskStatus,
+	selected func(*model.TaskStatus) bool, last func(*model.TaskStatus) bool) {
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case status, ok := <-statuses:
+			if !ok {
+				return
+			}
+			if status.Namespace != h.taskStore.Namespace() || !selected(status) {
+				continue
+			}
+			stream.send(status)
+			if last(status) {
+				return
+			}
+		case <-keepAlive.C:
+			stream.keepAlive()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// eventStream : a response streamed to the client as Server-Sent Events
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func openEventStream(w http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported")
+	}
+	return &eventStream{w: w, flusher: flusher}, nil
+}
+
+func (s *eventStream) start() {
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("Connection", "keep-alive")
+	s.w.WriteHeader(200)
+	s.flusher.Flush()
+}
+
+func (s *eventStream) send(status *model.TaskStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		fmt.Printf("Failed to marshal status of task %s: %s\n", status.TaskID.String(), err.Error())
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", status.Type, data)
+	s.flusher.Flush()
+}
+
+func (s *eventStream) keepAlive() {
+	fmt.Fprint(s.w, ": keep-alive\n\n")
+	s.flusher.Flush()
+}
@@ -0,0 +1,157 @@
+package route_test
+
+import (
+	"bufio"
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/mocks"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/route"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("task watch", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var handler *route.TaskHandlerImpl
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		config := &model.Config{
+			Manager: model.ManagerInfo{
+				ExecutionQueueSize: 10,
+				TaskQueueSize:      10,
+			},
+		}
+		handler = route.NewTaskHandlerImpl(taskStore, &mocks.EventManager{}, config)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	createTask := func(store task.Store, metadata map[string]string) *uuid.UUID {
+		id, err := storeTask(store, model.Spec{Image: "alpine", Metadata: metadata})
+		failOnError(err)
+		task.RecordEvent(store, id, &model.Event{Type: model.EventCreated, Source: model.SourceAPI, State: model.StateQueued})
+		return id
+	}
+
+	watch := func(handle func(http.ResponseWriter, *http.Request, map[string]string), target string,
+		vars map[string]string) (*http.Response, *bufio.Reader, func()) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handle(w, r, vars)
+		}))
+		resp, err := http.Get(server.URL + target)
+		failOnError(err)
+		return resp, bufio.NewReader(resp.Body), func() {
+			resp.Body.Close()
+			server.Close()
+		}
+	}
+
+	// readStatus : read the next event of the stream, nil once the stream has ended
+	readStatus := func(reader *bufio.Reader) *model.TaskStatus {
+		var status *model.TaskStatus
+		for {
+			line, err := reader.ReadString('\n')
+			if err == io.EOF {
+				return status
+			}
+			failOnError(err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" && status != nil {
+				return status
+			}
+			if strings.HasPrefix(line, "data: ") {
+				status = new(model.TaskStatus)
+				failOnError(status.UnmarshalBinary([]byte(strings.TrimPrefix(line, "data: "))))
+			}
+		}
+	}
+
+	It("should stream the events of a task until it completes", func() {
+		// Arrange
+		id := createTask(taskStore, nil)
+		resp, reader, stop := watch(handler.WatchTask, "", map[string]string{"id": id.String()})
+		defer stop()
+		first := readStatus(reader)
+
+		// Act
+		task.RecordEvent(taskStore, id, &model.Event{Type: model.EventDispatched, State: model.StateScheduled})
+		task.RecordEvent(taskStore, id, &model.Event{Type: model.EventCompleted, State: model.StateSucceeded})
+
+		// Assert
+		assert.Equal(context, 200, resp.StatusCode)
+		assert.Equal(context, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.Equal(context, model.EventCreated, first.Type)
+		assert.Equal(context, id, first.TaskID)
+		assert.Equal(context, model.EventDispatched, readStatus(reader).Type)
+		assert.Equal(context, model.StateSucceeded, readStatus(reader).State)
+		assert.Nil(context, readStatus(reader))
+	})
+
+	It("should end the stream of a task that has already completed after its latest event", func() {
+		// Arrange
+		id := createTask(taskStore, nil)
+		task.RecordEvent(taskStore, id, &model.Event{Type: model.EventCancelled, State: model.StateCancelled})
+
+		// Act
+		_, reader, stop := watch(handler.WatchTask, "", map[string]string{"id": id.String()})
+		defer stop()
+
+		// Assert
+		assert.Equal(context, model.StateCancelled, readStatus(reader).State)
+		assert.Nil(context, readStatus(reader))
+	})
+
+	It("should return not found when watching a task that does not exist", func() {
+		// Arrange
+		id := uuid.Must(uuid.NewV4())
+
+		// Act
+		resp, _, stop := watch(handler.WatchTask, "", map[string]string{"id": id.String()})
+		defer stop()
+
+		// Assert
+		assert.Equal(context, 404, resp.StatusCode)
+	})
+
+	It("should only stream the events of the namespace's tasks that match the selector", func() {
+		// Arrange
+		_, reader, stop := watch(handler.WatchTasks, "/?selector=team%3Da", map[string]string{})
+		defer stop()
+
+		// Act
+		createTask(taskStore, map[string]string{"team": "b"})
+		createTask(taskStore.InNamespace("team-b"), map[string]string{"team": "a"})
+		matching := createTask(taskStore, map[string]string{"team": "a", "env": "prod"})
+
+		// Assert
+		status := readStatus(reader)
+		assert.Equal(context, matching, status.TaskID)
+		assert.Equal(context, map[string]string{"team": "a", "env": "prod"}, status.Metadata)
+	})
+
+	It("should reject a selector it cannot parse", func() {
+		// Act
+		resp, _, stop := watch(handler.WatchTasks, "/?selector=team", map[string]string{})
+		defer stop()
+
+		// Assert
+		assert.Equal(context, 400, resp.StatusCode)
+	})
+})
@@ -0,0 +1,118 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// WorkerHandlerImpl : handles workers announcing themselves and sending heartbeats
+type WorkerHandlerImpl struct {
+	taskStore task.Store
+}
+
+// NewWorkerHandlerImpl creates a new WorkerHandlerImpl
+func NewWorkerHandlerImpl(taskStore task.Store) *WorkerHandlerImpl {
+	return &WorkerHandlerImpl{taskStore: taskStore}
+}
+
+// RegisterWorker : announce the worker with the given id, the body may describe the worker
+func (h *WorkerHandlerImpl) RegisterWorker(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	workerID := vars["id"]
+	err := model.ValidateWorkerID(workerID)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	worker := new(model.Worker)
+	if len(body) > 0 {
+		err = worker.UnmarshalBinary(body)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	worker.ID = workerID
+	worker.Tasks = nil
+
+	err = h.taskStore.RegisterWorker(worker, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Printf("Worker %s registered\n", workerID)
+
+	data, err := json.Marshal(worker)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// Heartbeat : record that the worker with the given id is alive, the body lists the tasks it is executing.
+// A worker that is not registered, because its heartbeat lapsed, must register again
+func (h *WorkerHandlerImpl) Heartbeat(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	workerID := vars["id"]
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	heartbeat := new(model.Heartbeat)
+	err = json.Unmarshal(body, heartbeat)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	for _, id := range heartbeat.Tasks {
+		if id == nil {
+			http.Error(w, "heartbeat tasks must be task ids", 400)
+			return
+		}
+	}
+
+	recorded, err := h.taskStore.RecordHeartbeat(workerID, heartbeat.Tasks, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !recorded {
+		http.Error(w, fmt.Sprintf("worker %s is not registered", workerID), 404)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+// ListWorkers : retrieve the registered workers and the tasks each is executing
+func (h *WorkerHandlerImpl) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	workers, err := h.taskStore.ListWorkers()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	data, err := json.Marshal(workers)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(200)
+	w.Write(data)
+}
@@ -0,0 +1,108 @@
+package route_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/route"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("worker handler", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var handler *route.WorkerHandlerImpl
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		handler = route.NewWorkerHandlerImpl(taskStore)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	It("should list a registered worker with the tasks of its last heartbeat", func() {
+		// Arrange
+		id := uuid.Must(uuid.NewV4())
+		req, _ := http.NewRequest("PUT", "/workers/worker-1", bytes.NewReader([]byte(`{"hostname": "host-1"}`)))
+		writer := httptest.NewRecorder()
+		handler.RegisterWorker(writer, req, map[string]string{"id": "worker-1"})
+		assert.Equal(context, 200, writer.Code)
+		heartbeat := `{"tasks": ["` + id.String() + `"]}`
+		req, _ = http.NewRequest("POST", "/workers/worker-1/heartbeat", bytes.NewReader([]byte(heartbeat)))
+		writer = httptest.NewRecorder()
+		handler.Heartbeat(writer, req, map[string]string{"id": "worker-1"})
+		assert.Equal(context, 200, writer.Code)
+
+		// Act
+		req, _ = http.NewRequest("GET", "/workers", nil)
+		writer = httptest.NewRecorder()
+		handler.ListWorkers(writer, req)
+
+		// Assert
+		assert.Equal(context, 200, writer.Code)
+		var workers []*model.Worker
+		assert.Nil(context, json.Unmarshal(writer.Body.Bytes(), &workers))
+		assert.Len(context, workers, 1)
+		assert.Equal(context, "host-1", workers[0].Hostname)
+		assert.Equal(context, []*uuid.UUID{&id}, workers[0].Tasks)
+		assert.WithinDuration(context, time.Now(), workers[0].LastHeartbeat, 10*time.Second)
+	})
+
+	It("should return not found for a heartbeat from a worker that is not registered", func() {
+		// Arrange
+		req, _ := http.NewRequest("POST", "/workers/worker-1/heartbeat", bytes.NewReader([]byte(`{"tasks": []}`)))
+		writer := httptest.NewRecorder()
+
+		// Act
+		handler.Heartbeat(writer, req, map[string]string{"id": "worker-1"})
+
+		// Assert
+		assert.Equal(context, 404, writer.Code)
+	})
+
+	It("should reject a heartbeat that lists a task without an id", func() {
+		// Arrange
+		req, _ := http.NewRequest("PUT", "/workers/worker-1", bytes.NewReader(nil))
+		handler.RegisterWorker(httptest.NewRecorder(), req, map[string]string{"id": "worker-1"})
+		req, _ = http.NewRequest("POST", "/workers/worker-1/heartbeat", bytes.NewReader([]byte(`{"tasks": [null]}`)))
+		writer := httptest.NewRecorder()
+
+		// Act
+		handler.Heartbeat(writer, req, map[string]string{"id": "worker-1"})
+
+		// Assert
+		assert.Equal(context, 400, writer.Code)
+		workers, err := taskStore.ListWorkers()
+		assert.Nil(context, err)
+		assert.Len(context, workers, 1)
+		assert.Empty(context, workers[0].Tasks)
+	})
+
+	It("should reject a worker id that cannot be used in keys or paths", func() {
+		// Arrange
+		req, _ := http.NewRequest("PUT", "/workers/a:b", bytes.NewReader(nil))
+		writer := httptest.NewRecorder()
+
+		// Act
+		handler.RegisterWorker(writer, req, map[string]string{"id": "a:b"})
+
+		// Assert
+		assert.Equal(context, 400, writer.Code)
+	})
+})
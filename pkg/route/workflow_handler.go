@@ -0,0 +1,234 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	"github.com/execd/task-store/pkg/workflow"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// workflowMetadataKey : the metadata key a step's workflow id is recorded under
+const workflowMetadataKey = "workflow"
+
+// stepMetadataKey : the metadata key a step's name is recorded under
+const stepMetadataKey = "step"
+
+// workflowView : a workflow along with the progress of each of its steps
+type workflowView struct {
+	ID     *uuid.UUID           `json:"id"`
+	Name   string               `json:"name"`
+	Status model.WorkflowStatus `json:"status"`
+	Steps  []stepView           `json:"steps"`
+	Edges  []model.Edge         `json:"edges,omitempty"`
+}
+
+// stepView : a workflow step along with the progress of its task
+type stepView struct {
+	Name   string      `json:"name"`
+	TaskID *uuid.UUID  `json:"taskId"`
+	State  model.State `json:"state"`
+	Info   *model.Info `json:"info,omitempty"`
+}
+
+// WorkflowHandlerImpl : handles requests for workflows
+type WorkflowHandlerImpl struct {
+	taskStore     task.Store
+	workflowStore workflow.Store
+	uuidGen       util.UUIDGen
+	config        *model.Config
+}
+
+// NewWorkflowHandlerImpl creates a new WorkflowHandlerImpl
+func NewWorkflowHandlerImpl(taskStore task.Store, workflowStore workflow.Store, uuidGen util.UUIDGen, config *model.Config) *WorkflowHandlerImpl {
+	return &WorkflowHandlerImpl{taskStore: taskStore, workflowStore: workflowStore, uuidGen: uuidGen, config: config}
+}
+
+// CreateWorkflow handles workflow creation requests. Each step is created as an ordinary
+// task that depends on the tasks of the steps with an edge to it
+func (h *WorkflowHandlerImpl) CreateWorkflow(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	wf := new(model.Workflow)
+	err = wf.UnmarshalBinary(body)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	wf.Tasks = nil
+
+	err = wf.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	for _, step := range wf.Steps {
+		err = admissible(&step.Spec, h.config)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("step %s : %s", step.Name, err.Error()), 400)
+			return
+		}
+		if step.Spec.Dedupe != nil {
+			http.Error(w, fmt.Sprintf("step %s : the steps of a workflow cannot be deduplicated", step.Name), 400)
+			return
+		}
+	}
+
+	workflowID, err := h.uuidGen.GenV4()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	wf.ID = &workflowID
+
+	ordered, specs, err := h.buildSteps(wf)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	id, err := h.workflowStore.StoreWorkflow(*wf)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	err = h.createSteps(wf, ordered, specs)
+	if err != nil {
+		if err := h.workflowStore.DeleteWorkflow(id); err != nil {
+			fmt.Printf("Failed to remove workflow %s whose steps were not created: %s\n", id.String(), err.Error())
+		}
+	}
+	if _, full := err.(*task.TaskQueueFullError); full {
+		errStr := fmt.Sprintf("Failed to create workflow, task queue has reached its limit!")
+		fmt.Println(errStr)
+		http.Error(w, errStr, 500)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Printf("Workflow %s created with %d steps\n", id.String(), len(wf.Steps))
+
+	w.WriteHeader(201)
+	w.Write([]byte(id.String()))
+}
+
+// buildSteps : build the spec of the task for every step of the workflow, in the order they must be created,
+// and record the id of each step's task on the workflow
+func (h *WorkflowHandlerImpl) buildSteps(wf *model.Workflow) ([]model.Step, []model.Spec, error) {
+	ordered, err := wf.Order()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tasks := make(map[string]*uuid.UUID, len(ordered))
+	specs := make([]model.Spec, 0, len(ordered))
+	for _, step := range ordered {
+		id, err := h.uuidGen.GenV4()
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks[step.Name] = &id
+
+		taskSpec := step.Spec
+		taskSpec.ID = &id
+		taskSpec.Metadata = make(map[string]string, len(step.Spec.Metadata)+2)
+		for key, value := range step.Spec.Metadata {
+			taskSpec.Metadata[key] = value
+		}
+		taskSpec.Metadata[workflowMetadataKey] = wf.ID.String()
+		taskSpec.Metadata[stepMetadataKey] = step.Name
+		for _, parent := range wf.Parents(step.Name) {
+			taskSpec.DependsOn = append(taskSpec.DependsOn, *tasks[parent])
+		}
+		taskSpec.ResolveRunAt(now)
+		specs = append(specs, taskSpec)
+	}
+	wf.Tasks = tasks
+	return ordered, specs, nil
+}
+
+// createSteps : create the tasks built for the steps of the workflow. The tasks are created together, so
+// either the task queue has room for every step or none are created, and no step can be dispatched
+// before the steps that depend on it have been created
+func (h *WorkflowHandlerImpl) createSteps(wf *model.Workflow, ordered []model.Step, specs []model.Spec) error {
+	created, err := h.taskStore.CreateTasks(specs, h.config.TaskQueueSizeFor(h.taskStore.Namespace()), time.Now())
+	if err != nil {
+		return err
+	}
+
+	for i, step := range ordered {
+		task.RecordEvent(h.taskStore, created[i].ID, &model.Event{Type: model.EventCreated, Source: model.SourceAPI,
+			State: createdState(created[i]), Message: fmt.Sprintf("step %q of workflow %s", step.Name, wf.ID.String())})
+		task.RecordDependencies(h.taskStore, created[i], len(specs[i].DependsOn))
+		if created[i].State == model.StateQueued {
+			h.taskStore.PublishTaskCreatedEvent(created[i].ID)
+		}
+	}
+	return nil
+}
+
+// GetWorkflow : retrieve the workflow denoted by the given id, along with the state
+// and result of each of its steps and the status of the workflow as a whole
+func (h *WorkflowHandlerImpl) GetWorkflow(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	idStr := vars["id"]
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build id from %s : %s", idStr, err.Error()), 500)
+		return
+	}
+
+	wf, err := h.workflowStore.GetWorkflow(&id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if wf == nil {
+		http.Error(w, fmt.Sprintf("workflow %s does not exist", id.String()), 404)
+		return
+	}
+
+	view := &workflowView{ID: wf.ID, Name: wf.Name, Edges: wf.Edges}
+	states := make([]model.State, 0, len(wf.Steps))
+	for _, step := range wf.Steps {
+		stepV := stepView{Name: step.Name, TaskID: wf.Tasks[step.Name]}
+		if stepV.TaskID != nil {
+			stepV.State, err = h.taskStore.GetTaskState(stepV.TaskID)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			stepV.Info, err = h.taskStore.GetTaskInfo(stepV.TaskID)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+		states = append(states, stepV.State)
+		view.Steps = append(view.Steps, stepV)
+	}
+	view.Status = model.AggregateStatus(states)
+
+	data, err := json.Marshal(view)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(data)
+}
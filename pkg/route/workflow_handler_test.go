@@ -0,0 +1,173 @@
+package route_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/route"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	"github.com/execd/task-store/pkg/workflow"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("workflow handler", func() {
+	var taskStore *task.StoreImpl
+	var workflowStore *workflow.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var handler *route.WorkflowHandlerImpl
+	var config *model.Config
+
+	givenWorkflow := `{"name": "release", "steps": [
+		{"name": "build", "spec": {"image": "alpine", "init": "build.sh"}},
+		{"name": "test", "spec": {"image": "alpine", "init": "test.sh", "metadata": {"team": "qa"}}}
+	], "edges": [{"from": "build", "to": "test"}]}`
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		redis := redis.NewClient(s.Addr())
+		uuidGen := util.NewUUIDGenImpl()
+		taskStore = task.NewStoreImpl(redis, uuidGen)
+		workflowStore = workflow.NewStoreImpl(redis, uuidGen)
+		config = &model.Config{
+			Manager: model.ManagerInfo{
+				ExecutionQueueSize: 10,
+				TaskQueueSize:      10,
+			},
+		}
+		handler = route.NewWorkflowHandlerImpl(taskStore, workflowStore, uuidGen, config)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	createWorkflow := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/workflows/", bytes.NewReader([]byte(body)))
+		writer := httptest.NewRecorder()
+		handler.CreateWorkflow(writer, req)
+		return writer
+	}
+
+	Describe("create workflow", func() {
+		It("should queue the first step and block the steps that depend on it", func() {
+			// Act
+			writer := createWorkflow(givenWorkflow)
+
+			// Assert
+			assert.Equal(context, 201, writer.Code)
+			id := uuid.FromStringOrNil(writer.Body.String())
+			stored, err := workflowStore.GetWorkflow(&id)
+			assert.Nil(context, err)
+			buildID, testID := stored.Tasks["build"], stored.Tasks["test"]
+			buildState, err := taskStore.GetTaskState(buildID)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateQueued, buildState)
+			testState, err := taskStore.GetTaskState(testID)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateBlocked, testState)
+			testSpec, err := taskStore.GetTask(testID)
+			assert.Nil(context, err)
+			assert.Equal(context, []uuid.UUID{*buildID}, testSpec.DependsOn)
+			assert.Equal(context, "qa", testSpec.Metadata["team"])
+			assert.Equal(context, "test", testSpec.Metadata["step"])
+			assert.Equal(context, id.String(), testSpec.Metadata["workflow"])
+			popped, err := taskStore.PopTask()
+			assert.Nil(context, err)
+			assert.Equal(context, *buildID, *popped)
+		})
+
+		It("should return bad request if the steps form a cycle", func() {
+			// Arrange
+			body := `{"name": "loop", "steps": [
+				{"name": "a", "spec": {"image": "alpine"}},
+				{"name": "b", "spec": {"image": "alpine"}}
+			], "edges": [{"from": "a", "to": "b"}, {"from": "b", "to": "a"}]}`
+
+			// Act
+			writer := createWorkflow(body)
+
+			// Assert
+			assert.Equal(context, 400, writer.Code)
+			assert.Contains(context, writer.Body.String(), "cycle")
+		})
+
+		It("should return error if the task queue cannot take every step", func() {
+			// Arrange
+			config.Manager.TaskQueueSize = 1
+
+			// Act
+			writer := createWorkflow(givenWorkflow)
+
+			// Assert
+			assert.Equal(context, 500, writer.Code)
+			assert.Equal(context, "Failed to create workflow, task queue has reached its limit!\n", writer.Body.String())
+			for _, key := range directRedis.Keys() {
+				assert.False(context, strings.HasPrefix(key, "workflow:"), "workflow %s was left behind", key)
+			}
+		})
+	})
+
+	Describe("get workflow", func() {
+		It("should return the state and result of each step and the overall status", func() {
+			// Arrange
+			created := createWorkflow(givenWorkflow)
+			id := uuid.FromStringOrNil(created.Body.String())
+			stored, err := workflowStore.GetWorkflow(&id)
+			failOnError(err)
+			buildID := stored.Tasks["build"]
+			failOnError(taskStore.TransitionTask(buildID, model.StateScheduled))
+			failOnError(taskStore.TransitionTask(buildID, model.StateFailed))
+			failOnError(taskStore.UpdateTaskInfo(&model.Info{ID: buildID, FailureStats: &model.FailureStatus{Name: "build", Reason: "Error"}}))
+			task.ResolveDependents(taskStore, buildID, false)
+			req, _ := http.NewRequest("GET", "/workflows/"+id.String(), nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetWorkflow(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			view := struct {
+				Status model.WorkflowStatus `json:"status"`
+				Steps  []struct {
+					Name  string      `json:"name"`
+					State model.State `json:"state"`
+					Info  *model.Info `json:"info"`
+				} `json:"steps"`
+			}{}
+			err = json.Unmarshal(writer.Body.Bytes(), &view)
+			assert.Equal(context, 200, writer.Code)
+			assert.Nil(context, err)
+			assert.Equal(context, model.WorkflowFailed, view.Status)
+			assert.Equal(context, "build", view.Steps[0].Name)
+			assert.Equal(context, model.StateFailed, view.Steps[0].State)
+			assert.Equal(context, "Error", view.Steps[0].Info.FailureStats.Reason)
+			assert.Equal(context, model.StateSkipped, view.Steps[1].State)
+			assert.Nil(context, view.Steps[1].Info)
+		})
+
+		It("should return not found if there is no such workflow", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+			req, _ := http.NewRequest("GET", "/workflows/"+id.String(), nil)
+			writer := httptest.NewRecorder()
+
+			// Act
+			handler.GetWorkflow(writer, req, map[string]string{"id": id.String()})
+
+			// Assert
+			assert.Equal(context, 404, writer.Code)
+		})
+	})
+})
@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/robfig/cron"
+	"time"
+)
+
+// maxCatchUpRuns : the most missed runs a schedule will start or hold pending
+const maxCatchUpRuns = 100
+
+// missedRunGrace : how late a run may be started before it counts as missed
+const missedRunGrace = time.Minute
+
+// Prepare : validate the given schedule, fill in its default
+// policies and set its first run after the given time
+func Prepare(s *model.Schedule, now time.Time) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if s.Overlap == "" {
+		s.Overlap = model.OverlapSkip
+	}
+	if s.CatchUp == "" {
+		s.CatchUp = model.CatchUpSkip
+	}
+
+	cronSchedule, location, err := parse(s)
+	if err != nil {
+		return err
+	}
+	next := cronSchedule.Next(now.In(location))
+	if next.IsZero() {
+		return fmt.Errorf("cron expression %q never fires", s.Cron)
+	}
+	s.NextRun = &next
+	s.Pending = 0
+	return nil
+}
+
+// DueRuns : the runs the given schedule should start at the given time following its
+// catch up policy, along with the time it is next due
+func DueRuns(s *model.Schedule, now time.Time) ([]time.Time, time.Time, error) {
+	cronSchedule, location, err := parse(s)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if s.NextRun == nil {
+		return nil, cronSchedule.Next(now.In(location)), nil
+	}
+
+	var due []time.Time
+	next := s.NextRun.In(location)
+	for !next.IsZero() && !next.After(now) {
+		due = append(due, next)
+		if len(due) > maxCatchUpRuns {
+			due = due[1:]
+		}
+		next = cronSchedule.Next(next)
+	}
+	if len(due) == 0 {
+		return nil, next, nil
+	}
+
+	last := due[len(due)-1]
+	switch s.CatchUp {
+	case model.CatchUpAll:
+		return due, next, nil
+	case model.CatchUpOnce:
+		return []time.Time{last}, next, nil
+	default:
+		if now.Sub(last) > missedRunGrace {
+			return nil, next, nil
+		}
+		return []time.Time{last}, next, nil
+	}
+}
+
+func parse(s *model.Schedule) (cron.Schedule, *time.Location, error) {
+	cronSchedule, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q : %s", s.Cron, err.Error())
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid time zone %q : %s", s.TimeZone, err.Error())
+	}
+	return cronSchedule, location, nil
+}
@@ -0,0 +1,174 @@
+package schedule_test
+
+import (
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/schedule"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("cron", func() {
+	var givenSchedule *model.Schedule
+	var now time.Time
+
+	BeforeEach(func() {
+		givenSchedule = &model.Schedule{
+			Cron:     "0 * * * *",
+			Template: model.Spec{Image: "alpine"},
+		}
+		now = time.Date(2018, 11, 5, 12, 30, 0, 0, time.UTC)
+	})
+
+	Describe("preparing a schedule", func() {
+
+		It("should set the first run and default policies", func() {
+			// Act
+			err := schedule.Prepare(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, time.Date(2018, 11, 5, 13, 0, 0, 0, time.UTC), givenSchedule.NextRun.UTC())
+			assert.Equal(context, model.OverlapSkip, givenSchedule.Overlap)
+			assert.Equal(context, model.CatchUpSkip, givenSchedule.CatchUp)
+		})
+
+		It("should evaluate the cron expression in the schedule's time zone", func() {
+			// Arrange
+			givenSchedule.Cron = "0 9 * * *"
+			givenSchedule.TimeZone = "America/New_York"
+
+			// Act
+			err := schedule.Prepare(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, time.Date(2018, 11, 5, 14, 0, 0, 0, time.UTC), givenSchedule.NextRun.UTC())
+		})
+
+		It("should reject an invalid cron expression", func() {
+			// Arrange
+			givenSchedule.Cron = "every tuesday"
+
+			// Act
+			err := schedule.Prepare(givenSchedule, now)
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+
+		It("should reject an unknown time zone", func() {
+			// Arrange
+			givenSchedule.TimeZone = "Mars/Olympus_Mons"
+
+			// Act
+			err := schedule.Prepare(givenSchedule, now)
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+
+		It("should reject an unknown overlap policy", func() {
+			// Arrange
+			givenSchedule.Overlap = "sometimes"
+
+			// Act
+			err := schedule.Prepare(givenSchedule, now)
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("finding due runs", func() {
+
+		It("should return nothing before the next run", func() {
+			// Arrange
+			nextRun := now.Add(30 * time.Minute)
+			givenSchedule.NextRun = &nextRun
+
+			// Act
+			due, next, err := schedule.DueRuns(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Empty(context, due)
+			assert.Equal(context, nextRun, next)
+		})
+
+		It("should return the run that has just fallen due", func() {
+			// Arrange
+			nextRun := now
+			givenSchedule.NextRun = &nextRun
+			givenSchedule.Cron = "* * * * *"
+
+			// Act
+			due, next, err := schedule.DueRuns(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, []time.Time{nextRun}, due)
+			assert.Equal(context, now.Add(time.Minute), next)
+		})
+
+		It("should drop missed runs when catch up is skip", func() {
+			// Arrange
+			nextRun := now.Add(-150 * time.Minute)
+			givenSchedule.NextRun = &nextRun
+			givenSchedule.CatchUp = model.CatchUpSkip
+
+			// Act
+			due, next, err := schedule.DueRuns(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Empty(context, due)
+			assert.Equal(context, now.Add(30*time.Minute), next)
+		})
+
+		It("should collapse missed runs into one when catch up is once", func() {
+			// Arrange
+			nextRun := now.Add(-150 * time.Minute)
+			givenSchedule.NextRun = &nextRun
+			givenSchedule.CatchUp = model.CatchUpOnce
+
+			// Act
+			due, _, err := schedule.DueRuns(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, []time.Time{now.Add(-30 * time.Minute)}, due)
+		})
+
+		It("should return every missed run when catch up is all", func() {
+			// Arrange
+			nextRun := now.Add(-150 * time.Minute)
+			givenSchedule.NextRun = &nextRun
+			givenSchedule.CatchUp = model.CatchUpAll
+
+			// Act
+			due, next, err := schedule.DueRuns(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Len(context, due, 3)
+			assert.Equal(context, nextRun, due[0])
+			assert.Equal(context, now.Add(30*time.Minute), next)
+		})
+
+		It("should cap the number of missed runs returned", func() {
+			// Arrange
+			nextRun := now.Add(-1000 * time.Hour)
+			givenSchedule.NextRun = &nextRun
+			givenSchedule.CatchUp = model.CatchUpAll
+
+			// Act
+			due, _, err := schedule.DueRuns(givenSchedule, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Len(context, due, 100)
+			assert.Equal(context, now.Add(-30*time.Minute), due[99])
+		})
+	})
+})
@@ -0,0 +1,125 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/util"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+)
+
+const scheduleSetName = "schedules"
+const schedulePrefix = "schedule"
+
+// Store : a Store allows saving reading and removing recurring task schedules
+type Store interface {
+	StoreSchedule(schedule model.Schedule) (*uuid.UUID, error)
+	GetSchedule(id *uuid.UUID) (*model.Schedule, error)
+	ListSchedules() ([]*model.Schedule, error)
+	UpdateSchedule(schedule *model.Schedule) error
+	DeleteSchedule(id *uuid.UUID) (bool, error)
+}
+
+// NewStoreImpl : build a StoreImpl
+func NewStoreImpl(redis *redis.Client, uuidGen util.UUIDGen) *StoreImpl {
+	return &StoreImpl{redis: redis, uuidGen: uuidGen}
+}
+
+// StoreImpl : redis implementation of a Store.
+type StoreImpl struct {
+	redis   *redis.Client
+	uuidGen util.UUIDGen
+}
+
+// StoreSchedule : store the given schedule
+func (s *StoreImpl) StoreSchedule(schedule model.Schedule) (*uuid.UUID, error) {
+	id, err := s.uuidGen.GenV4()
+	if err != nil {
+		return nil, err
+	}
+	schedule.ID = &id
+
+	var created *redis.BoolCmd
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		created = pipe.SetNX(buildScheduleKey(&id), &schedule, 0)
+		pipe.SAdd(scheduleSetName, id.String())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storing schedule with id %s failed", id.String())
+	}
+	if !created.Val() {
+		return nil, fmt.Errorf("schedule with id %s already exists", id.String())
+	}
+	return schedule.ID, nil
+}
+
+// GetSchedule : retrieve the schedule with the given id, nil if there is no such schedule
+func (s *StoreImpl) GetSchedule(id *uuid.UUID) (*model.Schedule, error) {
+	data, err := s.redis.Get(buildScheduleKey(id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve schedule with id %s", id.String())
+	}
+
+	schedule := new(model.Schedule)
+	if err := schedule.UnmarshalBinary([]byte(data)); err != nil {
+		return nil, fmt.Errorf("failed to build schedule with id %s from retrieved data %s", id.String(), data)
+	}
+	return schedule, nil
+}
+
+// ListSchedules : retrieve every stored schedule
+func (s *StoreImpl) ListSchedules() ([]*model.Schedule, error) {
+	members, err := s.redis.SMembers(scheduleSetName).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules : %s", err.Error())
+	}
+
+	schedules := make([]*model.Schedule, 0, len(members))
+	for _, member := range members {
+		id := new(uuid.UUID)
+		if err := id.UnmarshalText([]byte(member)); err != nil {
+			continue
+		}
+		schedule, err := s.GetSchedule(id)
+		if err != nil {
+			return nil, err
+		}
+		if schedule != nil {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+// UpdateSchedule : save the given schedule's run state, a schedule that
+// has been deleted is left deleted
+func (s *StoreImpl) UpdateSchedule(schedule *model.Schedule) error {
+	_, err := s.redis.SetXX(buildScheduleKey(schedule.ID), schedule, 0).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to update schedule with id %s : %s", schedule.ID.String(), err.Error())
+	}
+	return nil
+}
+
+// DeleteSchedule : remove the schedule with the given id,
+// returning false if there was no such schedule
+func (s *StoreImpl) DeleteSchedule(id *uuid.UUID) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		removed = pipe.Del(buildScheduleKey(id))
+		pipe.SRem(scheduleSetName, id.String())
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete schedule with id %s : %s", id.String(), err.Error())
+	}
+	return removed.Val() > 0, nil
+}
+
+func buildScheduleKey(id *uuid.UUID) string {
+	return fmt.Sprintf("%s:%s", schedulePrefix, id.String())
+}
@@ -0,0 +1,212 @@
+package schedule_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/mocks"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/schedule"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"log"
+)
+
+var context = GinkgoT()
+
+var _ = Describe("store", func() {
+	var scheduleStore *schedule.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var givenSchedule model.Schedule
+	var uuidGenMock mocks.UUIDGen
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+
+		redis := redis.NewClient(s.Addr())
+		uuidGenMock = mocks.UUIDGen{}
+		scheduleStore = schedule.NewStoreImpl(redis, &uuidGenMock)
+		directRedis = s
+		givenSchedule = model.Schedule{
+			Cron:     "*/5 * * * *",
+			TimeZone: "Europe/London",
+			Template: model.Spec{Image: "alpine", Init: "init.sh"},
+			Overlap:  model.OverlapQueue,
+		}
+	})
+
+	AfterEach(func() {
+		defer directRedis.Close()
+	})
+
+	Describe("storing a schedule", func() {
+
+		It("should store the schedule under a new id", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+
+			// Act
+			id, err := scheduleStore.StoreSchedule(givenSchedule)
+			failOnError(err)
+			stored, err := scheduleStore.GetSchedule(id)
+			failOnError(err)
+
+			// Assert
+			assert.Equal(context, givenID, *id)
+			assert.Equal(context, givenID, *stored.ID)
+			assert.Equal(context, "*/5 * * * *", stored.Cron)
+			assert.Equal(context, "alpine", stored.Template.Image)
+			assert.Equal(context, model.OverlapQueue, stored.Overlap)
+		})
+
+		It("should return an error if storing fails", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			directRedis.Close()
+
+			// Act
+			id, err := scheduleStore.StoreSchedule(givenSchedule)
+
+			// Assert
+			assert.Nil(context, id)
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("getting a schedule", func() {
+
+		It("should return nil if there is no such schedule", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			stored, err := scheduleStore.GetSchedule(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Nil(context, stored)
+		})
+	})
+
+	Describe("listing schedules", func() {
+
+		It("should return every stored schedule", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil).Once()
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil).Once()
+			first, err := scheduleStore.StoreSchedule(givenSchedule)
+			failOnError(err)
+			second, err := scheduleStore.StoreSchedule(givenSchedule)
+			failOnError(err)
+
+			// Act
+			schedules, err := scheduleStore.ListSchedules()
+			failOnError(err)
+
+			// Assert
+			ids := []uuid.UUID{*schedules[0].ID, *schedules[1].ID}
+			assert.Len(context, schedules, 2)
+			assert.Contains(context, ids, *first)
+			assert.Contains(context, ids, *second)
+		})
+
+		It("should return an error if listing fails", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			schedules, err := scheduleStore.ListSchedules()
+
+			// Assert
+			assert.Nil(context, schedules)
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("updating a schedule", func() {
+
+		It("should save the schedule's run state", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			id, err := scheduleStore.StoreSchedule(givenSchedule)
+			failOnError(err)
+			stored, err := scheduleStore.GetSchedule(id)
+			failOnError(err)
+			givenTaskID := uuid.Must(uuid.NewV4())
+			stored.LastTaskID = &givenTaskID
+			stored.Pending = 2
+
+			// Act
+			err = scheduleStore.UpdateSchedule(stored)
+			failOnError(err)
+			updated, err := scheduleStore.GetSchedule(id)
+			failOnError(err)
+
+			// Assert
+			assert.Equal(context, givenTaskID, *updated.LastTaskID)
+			assert.Equal(context, 2, updated.Pending)
+		})
+
+		It("should not bring back a deleted schedule", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			id, err := scheduleStore.StoreSchedule(givenSchedule)
+			failOnError(err)
+			stored, err := scheduleStore.GetSchedule(id)
+			failOnError(err)
+			_, err = scheduleStore.DeleteSchedule(id)
+			failOnError(err)
+
+			// Act
+			err = scheduleStore.UpdateSchedule(stored)
+			failOnError(err)
+			updated, err := scheduleStore.GetSchedule(id)
+			failOnError(err)
+
+			// Assert
+			assert.Nil(context, updated)
+		})
+	})
+
+	Describe("deleting a schedule", func() {
+
+		It("should remove the schedule", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			id, err := scheduleStore.StoreSchedule(givenSchedule)
+			failOnError(err)
+
+			// Act
+			removed, err := scheduleStore.DeleteSchedule(id)
+			failOnError(err)
+			schedules, err := scheduleStore.ListSchedules()
+			failOnError(err)
+
+			// Assert
+			assert.True(context, removed)
+			assert.Empty(context, schedules)
+		})
+
+		It("should return false if there is no such schedule", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			removed, err := scheduleStore.DeleteSchedule(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.False(context, removed)
+		})
+	})
+})
+
+func failOnError(err error) {
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
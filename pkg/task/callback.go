@@ -0,0 +1,111 @@
+package task
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+const callbacksSetName = "callbacks"
+const deadCallbacksSetName = "callbacks:dead"
+const callbackPostFix = "callback"
+
+// ScheduleCallback : if the given task was created with a callback url, schedule delivering its result
+// to it at the given time. Returns false if the task has no callback url
+func (s *StoreImpl) ScheduleCallback(id *uuid.UUID, at time.Time) (bool, error) {
+	taskSpec, err := s.GetTask(id)
+	if err != nil {
+		return false, err
+	}
+	if taskSpec.CallbackURL == "" {
+		return false, nil
+	}
+
+	callback := &model.Callback{
+		TaskID:        id,
+		URL:           taskSpec.CallbackURL,
+		Headers:       taskSpec.CallbackHeaders,
+		State:         model.CallbackPending,
+		NextAttemptAt: &at,
+	}
+	return true, s.UpdateCallback(callback)
+}
+
+// UpdateCallback : record the given delivery, a pending delivery is due at its next attempt
+// and a dead one is dead-lettered
+func (s *StoreImpl) UpdateCallback(callback *model.Callback) error {
+	data, err := callback.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(s.buildTaskCallbackKey(callback.TaskID), data, 0)
+		switch {
+		case callback.State == model.CallbackPending && callback.NextAttemptAt != nil:
+			pipe.ZAdd(s.key(callbacksSetName), redis.Z{Score: float64(toMillis(*callback.NextAttemptAt)), Member: callback.TaskID.String()})
+		case callback.State == model.CallbackDead:
+			pipe.ZRem(s.key(callbacksSetName), callback.TaskID.String())
+			pipe.ZAdd(s.key(deadCallbacksSetName), redis.Z{Score: float64(toMillis(time.Now())), Member: callback.TaskID.String()})
+		default:
+			pipe.ZRem(s.key(callbacksSetName), callback.TaskID.String())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update callback of task %s : %s", callback.TaskID.String(), err.Error())
+	}
+	return nil
+}
+
+// GetCallback : retrieve the delivery of the given task's result, nil if it has none
+func (s *StoreImpl) GetCallback(id *uuid.UUID) (*model.Callback, error) {
+	data, err := s.redis.Get(s.buildTaskCallbackKey(id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve callback of task %s : %s", id.String(), err.Error())
+	}
+
+	callback := new(model.Callback)
+	if err := callback.UnmarshalBinary([]byte(data)); err != nil {
+		return nil, fmt.Errorf("failed to build callback of task %s from retrieved data %s", id.String(), data)
+	}
+	return callback, nil
+}
+
+// PopDueCallbacks : remove and return the tasks whose deliveries are due at the given time
+func (s *StoreImpl) PopDueCallbacks(now time.Time) ([]*uuid.UUID, error) {
+	ids, err := s.popDue(s.key(callbacksSetName), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve due callbacks : %s", err.Error())
+	}
+	return ids, nil
+}
+
+// ListDeadCallbacks : the deliveries that ran out of attempts, the most recently dead-lettered first
+func (s *StoreImpl) ListDeadCallbacks() ([]*model.Callback, error) {
+	members, err := s.redis.ZRevRange(s.key(deadCallbacksSetName), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve dead callbacks : %s", err.Error())
+	}
+
+	callbacks := make([]*model.Callback, 0, len(members))
+	for _, id := range parseTaskIDs(members, s.key(deadCallbacksSetName)) {
+		callback, err := s.GetCallback(id)
+		if err != nil {
+			return nil, err
+		}
+		if callback != nil {
+			callbacks = append(callbacks, callback)
+		}
+	}
+	return callbacks, nil
+}
+
+func (s *StoreImpl) buildTaskCallbackKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), callbackPostFix))
+}
@@ -0,0 +1,141 @@
+package task_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("callbacks", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var now time.Time
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		now = time.Now().UTC().Round(time.Millisecond)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	It("should schedule delivering the result of a task with a callback url", func() {
+		// Arrange
+		id, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/done",
+			CallbackHeaders: map[string]string{"Authorization": "Bearer x"}})
+		failOnError(err)
+
+		// Act
+		scheduled, err := taskStore.ScheduleCallback(id, now)
+		failOnError(err)
+		notDue, err := taskStore.PopDueCallbacks(now.Add(-time.Second))
+		failOnError(err)
+		due, err := taskStore.PopDueCallbacks(now)
+		failOnError(err)
+		callback, err := taskStore.GetCallback(id)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.True(context, scheduled)
+		assert.Empty(context, notDue)
+		assert.Equal(context, []*uuid.UUID{id}, due)
+		assert.Equal(context, "http://example.com/done", callback.URL)
+		assert.Equal(context, map[string]string{"Authorization": "Bearer x"}, callback.Headers)
+		assert.Equal(context, model.CallbackPending, callback.State)
+		assert.True(context, now.Equal(*callback.NextAttemptAt))
+	})
+
+	It("should not schedule a callback for a task without a callback url", func() {
+		// Arrange
+		id, err := storeTask(taskStore, model.Spec{Image: "alpine"})
+		failOnError(err)
+
+		// Act
+		scheduled, err := taskStore.ScheduleCallback(id, now)
+		failOnError(err)
+		callback, err := taskStore.GetCallback(id)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.False(context, scheduled)
+		assert.Nil(context, callback)
+	})
+
+	It("should stop scheduling a delivered callback", func() {
+		// Arrange
+		id, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/done"})
+		failOnError(err)
+		_, err = taskStore.ScheduleCallback(id, now)
+		failOnError(err)
+		callback, err := taskStore.GetCallback(id)
+		failOnError(err)
+		callback.State = model.CallbackDelivered
+		callback.NextAttemptAt = nil
+
+		// Act
+		err = taskStore.UpdateCallback(callback)
+		failOnError(err)
+		due, err := taskStore.PopDueCallbacks(now.Add(time.Hour))
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Empty(context, due)
+	})
+
+	It("should dead-letter a callback that ran out of attempts", func() {
+		// Arrange
+		first, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/first"})
+		failOnError(err)
+		second, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/second"})
+		failOnError(err)
+		for _, id := range []*uuid.UUID{first, second} {
+			_, err = taskStore.ScheduleCallback(id, now)
+			failOnError(err)
+		}
+		callback, err := taskStore.GetCallback(first)
+		failOnError(err)
+		callback.State = model.CallbackDead
+		callback.Attempts = []model.CallbackAttempt{{At: now, StatusCode: 500}}
+
+		// Act
+		err = taskStore.UpdateCallback(callback)
+		failOnError(err)
+		dead, err := taskStore.ListDeadCallbacks()
+		failOnError(err)
+		due, err := taskStore.PopDueCallbacks(now)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Len(context, dead, 1)
+		assert.Equal(context, first, dead[0].TaskID)
+		assert.Equal(context, 500, dead[0].Attempts[0].StatusCode)
+		assert.Equal(context, []*uuid.UUID{second}, due)
+	})
+
+	It("should return error if scheduling a callback fails", func() {
+		// Arrange
+		id, err := storeTask(taskStore, model.Spec{Image: "alpine", CallbackURL: "http://example.com/done"})
+		failOnError(err)
+		callback := &model.Callback{TaskID: id, State: model.CallbackPending, NextAttemptAt: &now}
+		directRedis.Close()
+
+		// Act
+		err = taskStore.UpdateCallback(callback)
+
+		// Assert
+		assert.NotNil(context, err)
+		assert.Contains(context, err.Error(), "failed to update callback")
+	})
+})
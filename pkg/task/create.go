@@ -0,0 +1,398 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// createTasksScript : atomically creates tasks, checking the task queue has room for them, merging a task that
+// opted in to dedupe into an identical task that has not completed, including one created earlier in the same
+// call, and recording the tasks each one depends on.
+// A task is blocked while any task it depends on has not succeeded, skipped if one of them completed without
+// succeeding, and otherwise queued, or delayed if it is not yet due. Every task created takes up room in the
+// task queue. When ARGV[2] is '1' as many of the tasks are created as there is room for, otherwise none are
+// unless every one of them can be. KEYS[9] and ARGV[12] onwards hold a section for each task, see createTasks.
+// Returns the size of the task queue followed by an outcome and an id for each task: the state it was created
+// in, 'merged' along with the task it was merged into, 'full' or 'exists'. Returns 'changed' alone, having
+// written nothing, if a task's dedupe key no longer names the task it named when the keys were gathered
+var createTasksScript = redis.NewScript(`
+local capacity, partial, namespace, created = tonumber(ARGV[1]), ARGV[2] == '1', ARGV[3], ARGV[4]
+local queued, delayed, blocked, skipped, succeeded = ARGV[5], ARGV[6], ARGV[7], ARGV[8], ARGV[9]
+local terminal = {}
+for state in string.gmatch(ARGV[10], '[^,]+') do
+	terminal[state] = true
+end
+local stateIndexes = {[queued] = KEYS[5], [delayed] = KEYS[6], [blocked] = KEYS[7], [skipped] = KEYS[8]}
+
+local tasks = {}
+local i, k = 12, 9
+for t = 1, tonumber(ARGV[11]) do
+	local task = {id = ARGV[i], data = ARGV[i + 1], score = ARGV[i + 2], due = ARGV[i + 3], owner = ARGV[i + 5],
+		key = KEYS[k], stateKey = KEYS[k + 1], parentsKey = KEYS[k + 2], parents = {}, indexes = {}}
+	local dedupe = tonumber(ARGV[i + 4])
+	i, k = i + 6, k + 3
+	if dedupe > 0 then
+		task.dedupeKey = KEYS[k]
+		k = k + 1
+	end
+	if dedupe > 1 then
+		task.ownerStateKey = KEYS[k]
+		k = k + 1
+	end
+	for p = 1, tonumber(ARGV[i]) do
+		task.parents[p] = {id = ARGV[i + p], childrenKey = KEYS[k], stateKey = KEYS[k + 1]}
+		k = k + 2
+	end
+	i = i + 1 + #task.parents
+	for x = 1, tonumber(ARGV[i]) do
+		task.indexes[x] = KEYS[k]
+		k = k + 1
+	end
+	i = i + 1
+	tasks[t] = task
+end
+
+local outcomes, needed, exists, claimed = {}, 0, false, {}
+for t, task in ipairs(tasks) do
+	if redis.call('EXISTS', task.key) == 1 then
+		outcomes[t] = {'exists', task.id}
+		exists = true
+	elseif task.dedupeKey and claimed[task.dedupeKey] then
+		task.duplicateOf = claimed[task.dedupeKey]
+	elseif task.dedupeKey then
+		if (redis.call('GET', task.dedupeKey) or '') ~= task.owner then
+			return {'changed'}
+		end
+		if task.ownerStateKey then
+			local state = redis.call('GET', task.ownerStateKey)
+			if state and not terminal[state] then
+				outcomes[t] = {'merged', task.owner}
+			end
+		end
+	end
+	if not outcomes[t] and not task.duplicateOf then
+		needed = needed + 1
+		if task.dedupeKey then
+			claimed[task.dedupeKey] = t
+		end
+	end
+end
+
+local room = capacity - redis.call('ZCARD', KEYS[1])
+if not partial and (exists or needed > room) then
+	room = 0
+end
+
+local function create(task)
+	if task.dedupeKey then
+		redis.call('SET', task.dedupeKey, task.id)
+	end
+	if namespace ~= '' then
+		redis.call('SADD', KEYS[3], namespace)
+		redis.call('HSET', KEYS[4], task.id, namespace)
+	end
+	redis.call('SET', task.key, task.data)
+
+	local pending, failed = false, false
+	for _, parent in ipairs(task.parents) do
+		redis.call('SADD', parent.childrenKey, task.id)
+		local state = redis.call('GET', parent.stateKey) or ''
+		if state ~= succeeded then
+			redis.call('SADD', task.parentsKey, parent.id)
+			if terminal[state] then
+				failed = true
+			else
+				pending = true
+			end
+		end
+	end
+
+	local state = queued
+	if failed then
+		state = skipped
+	elseif pending then
+		state = blocked
+	elseif task.due ~= '' then
+		state = delayed
+		redis.call('ZADD', KEYS[2], task.due, task.id)
+	else
+		redis.call('ZADD', KEYS[1], task.score, task.id)
+	end
+	redis.call('SET', task.stateKey, state)
+	redis.call('ZADD', stateIndexes[state], created, task.id)
+	for _, index in ipairs(task.indexes) do
+		redis.call('ZADD', index, created, task.id)
+	end
+	return state
+end
+
+for t, task in ipairs(tasks) do
+	if task.duplicateOf then
+		local original = outcomes[task.duplicateOf]
+		if original[1] == 'full' then
+			outcomes[t] = {'full', task.id}
+		else
+			outcomes[t] = {'merged', original[2]}
+		end
+	elseif not outcomes[t] then
+		if room > 0 then
+			room = room - 1
+			outcomes[t] = {create(task), task.id}
+		else
+			outcomes[t] = {'full', task.id}
+		end
+	end
+end
+
+local result = {redis.call('ZCARD', KEYS[1])}
+for t = 1, #tasks do
+	result[#result + 1] = outcomes[t][1]
+	result[#result + 1] = outcomes[t][2]
+end
+return result
+`)
+
+// CreatedTask : the outcome of creating a task
+type CreatedTask struct {
+	ID        *uuid.UUID
+	State     model.State // State the task was created in, empty if it was merged
+	Merged    bool        // True if the task was merged into the identical task with the ID rather than created
+	QueueSize int64       // Size of the task queue once the task was created
+}
+
+// createdOutcome : an outcome of createTasksScript for a task
+type createdOutcome struct {
+	created *CreatedTask
+	full    bool
+	exists  bool
+}
+
+// CreateTask : create the given task, provided the task queue holds fewer than capacity tasks. The task
+// is queued, delayed if it is not due at the given time, or held back until the tasks it depends on have
+// succeeded, and a task that opted in to dedupe is merged into an identical task that has not completed.
+// Everything happens in one step, so concurrent callers cannot overshoot the limit and a failure cannot
+// leave a stored task that is never queued
+func (s *StoreImpl) CreateTask(task model.Spec, capacity int64, now time.Time) (*CreatedTask, error) {
+	task.ID = nil
+	created, err := s.CreateTasks([]model.Spec{task}, capacity, now)
+	if err != nil {
+		return nil, err
+	}
+	return created[0], nil
+}
+
+// CreateTasks : create the given tasks in the way CreateTask does, all of them or, if the task queue does not
+// have room for every one, none. A task given an id keeps it, so tasks created together can depend on one another
+func (s *StoreImpl) CreateTasks(tasks []model.Spec, capacity int64, now time.Time) ([]*CreatedTask, error) {
+	outcomes, err := s.createTasks(tasks, capacity, false, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.exists {
+			return nil, fmt.Errorf("task with id %s already exists", outcome.created.ID.String())
+		}
+	}
+	created := make([]*CreatedTask, len(outcomes))
+	for i, outcome := range outcomes {
+		if outcome.full {
+			return nil, &TaskQueueFullError{Capacity: capacity}
+		}
+		created[i] = outcome.created
+	}
+	return created, nil
+}
+
+// StoreTaskBatch : store the given tasks and queue them, or delay the ones that are not due at the given
+// time, as far as the task queue has room for them. Returns the ids of the tasks, in the order given, nil
+// for those there was no room for. Everything is written in one step, so the tasks that fit are all stored
+// and queued or none are
+func (s *StoreImpl) StoreTaskBatch(tasks []model.Spec, capacity int64, now time.Time) ([]*uuid.UUID, error) {
+	batch := make([]model.Spec, len(tasks))
+	copy(batch, tasks)
+	for i := range batch {
+		batch[i].ID = nil
+	}
+
+	outcomes, err := s.createTasks(batch, capacity, true, now)
+	if err != nil {
+		return nil, fmt.Errorf("storing batch of %d tasks failed : %s", len(batch), err.Error())
+	}
+
+	ids := make([]*uuid.UUID, len(outcomes))
+	for i, outcome := range outcomes {
+		if outcome.exists {
+			return nil, fmt.Errorf("task with id %s already exists", outcome.created.ID.String())
+		}
+		if !outcome.full {
+			ids[i] = outcome.created.ID
+		}
+	}
+	return ids, nil
+}
+
+// errDedupeOwnerChanged : returned by runCreateTasks when a dedupe key changed after its owner was read
+var errDedupeOwnerChanged = errors.New("the task a dedupe key names changed concurrently")
+
+// createTasks : run createTasksScript for the given tasks, creating as many as there is room for when
+// partial. The script is retried if a task the tasks dedupe against changes while it is being run
+func (s *StoreImpl) createTasks(tasks []model.Spec, capacity int64, partial bool, now time.Time) ([]*createdOutcome, error) {
+	batch := make([]model.Spec, len(tasks))
+	copy(batch, tasks)
+	for i := range batch {
+		if batch[i].ID != nil {
+			continue
+		}
+		id, err := s.uuidGen.GenV4()
+		if err != nil {
+			return nil, err
+		}
+		batch[i].ID = &id
+	}
+
+	last, err := s.redis.IncrBy(s.key(taskQueueSequenceName), int64(len(batch))).Result()
+	if err != nil {
+		return nil, err
+	}
+	first := last - int64(len(batch)) + 1
+
+	for i := 0; i < maxTransitionAttempts; i++ {
+		outcomes, err := s.runCreateTasks(batch, first, capacity, partial, now)
+		if err != errDedupeOwnerChanged {
+			return outcomes, err
+		}
+	}
+	return nil, fmt.Errorf("creating tasks failed : %s", errDedupeOwnerChanged.Error())
+}
+
+// dedupeOwners : the task each of the given tasks that opted in to dedupe would be merged into, in the
+// order given, or an empty string for a task that would not be
+func (s *StoreImpl) dedupeOwners(tasks []model.Spec) ([]string, error) {
+	owners := make([]string, len(tasks))
+	var keys []string
+	var positions []int
+	for i := range tasks {
+		if tasks[i].Dedupe != nil {
+			keys = append(keys, s.buildDedupeKey(tasks[i].DedupeHash()))
+			positions = append(positions, i)
+		}
+	}
+	if len(keys) == 0 {
+		return owners, nil
+	}
+
+	values, err := s.redis.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for j, value := range values {
+		owner, _ := value.(string)
+		owners[positions[j]] = owner
+	}
+	return owners, nil
+}
+
+// runCreateTasks : run createTasksScript once for the given tasks, queued with the sequence numbers from
+// first on. Each task's section of KEYS holds its task, state and parents keys, its dedupe key and the state
+// key of the task it would be merged into when it has them, the children and state keys of each task it
+// depends on and the keys of the indexes it belongs on. Its section of ARGV holds its id, spec, queue score,
+// due time, the number of dedupe keys, the task it would be merged into, the number of tasks it depends on
+// followed by their ids, and the number of indexes it belongs on
+func (s *StoreImpl) runCreateTasks(batch []model.Spec, first int64, capacity int64, partial bool, now time.Time) ([]*createdOutcome, error) {
+	owners, err := s.dedupeOwners(batch)
+	if err != nil {
+		return nil, fmt.Errorf("creating tasks failed : %s", err.Error())
+	}
+
+	var terminal []string
+	for _, state := range model.TerminalStates() {
+		terminal = append(terminal, string(state))
+	}
+	keys := []string{s.key(taskQueueName), s.key(delayedSetName), namespacesSetName, taskNamespacesName,
+		s.buildStateIndexKey(model.StateQueued), s.buildStateIndexKey(model.StateDelayed),
+		s.buildStateIndexKey(model.StateBlocked), s.buildStateIndexKey(model.StateSkipped)}
+	args := []interface{}{capacity, "0", s.namespace, toMillis(now), string(model.StateQueued), string(model.StateDelayed),
+		string(model.StateBlocked), string(model.StateSkipped), string(model.StateSucceeded), strings.Join(terminal, ","), len(batch)}
+	if partial {
+		args[1] = "1"
+	}
+
+	for i := range batch {
+		taskSpec := &batch[i]
+		data, err := taskSpec.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		due := ""
+		if taskSpec.RunAt != nil && taskSpec.RunAt.After(now) {
+			due = strconv.FormatInt(toMillis(*taskSpec.RunAt), 10)
+		}
+
+		keys = append(keys, s.buildTaskKey(taskSpec.ID), s.buildTaskStateKey(taskSpec.ID), s.buildTaskParentsKey(taskSpec.ID))
+		dedupeKeys := 0
+		if taskSpec.Dedupe != nil {
+			keys = append(keys, s.buildDedupeKey(taskSpec.DedupeHash()))
+			dedupeKeys++
+			if owners[i] != "" {
+				owner, err := uuid.FromString(owners[i])
+				if err != nil {
+					return nil, fmt.Errorf("failed to build id from %s deduping task %s", owners[i], taskSpec.ID.String())
+				}
+				keys = append(keys, s.buildTaskStateKey(&owner))
+				dedupeKeys++
+			}
+		}
+
+		args = append(args, taskSpec.ID.String(), data, strconv.FormatFloat(queueScore(taskSpec.Priority, first+int64(i)), 'f', -1, 64),
+			due, dedupeKeys, owners[i], len(taskSpec.DependsOn))
+		for j := range taskSpec.DependsOn {
+			parent := &taskSpec.DependsOn[j]
+			keys = append(keys, s.buildTaskChildrenKey(parent), s.buildTaskStateKey(parent))
+			args = append(args, parent.String())
+		}
+		indexes := s.taskIndexKeys(taskSpec)
+		keys = append(keys, indexes...)
+		args = append(args, len(indexes))
+	}
+
+	result, err := createTasksScript.Run(s.redis, keys, args...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("creating tasks failed : %s", err.Error())
+	}
+
+	values, _ := result.([]interface{})
+	if len(values) == 1 && values[0] == "changed" {
+		return nil, errDedupeOwnerChanged
+	}
+	if len(values) != 1+2*len(batch) {
+		return nil, fmt.Errorf("creating tasks failed : unexpected result %v", result)
+	}
+	size, _ := values[0].(int64)
+	outcomes := make([]*createdOutcome, len(batch))
+	for i := range batch {
+		outcome, _ := values[1+2*i].(string)
+		member, _ := values[2+2*i].(string)
+		id, err := uuid.FromString(member)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build id from %s returned for task %s", member, batch[i].ID.String())
+		}
+
+		created := &CreatedTask{ID: &id, QueueSize: size}
+		switch outcome {
+		case "merged":
+			created.Merged = true
+		case "full", "exists":
+		default:
+			created.State = model.State(outcome)
+		}
+		outcomes[i] = &createdOutcome{created: created, full: outcome == "full", exists: outcome == "exists"}
+	}
+	return outcomes, nil
+}
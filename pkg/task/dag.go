@@ -0,0 +1,158 @@
+package task
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// UnknownDependencyError : returned when a task depends on a task that does not exist
+type UnknownDependencyError struct {
+	ID *uuid.UUID
+}
+
+func (e *UnknownDependencyError) Error() string {
+	return fmt.Sprintf("dependency %s does not exist", e.ID.String())
+}
+
+// DependencyCycleError : returned when following a task's dependencies leads back to a task already on the path
+type DependencyCycleError struct {
+	ID *uuid.UUID
+}
+
+func (e *DependencyCycleError) Error() string {
+	return fmt.Sprintf("dependency %s is part of a cycle", e.ID.String())
+}
+
+// CheckDependencies : make sure every one of the given parents exists, and that none of
+// them is reachable from itself by following the dependencies of the stored tasks
+func CheckDependencies(store Store, parents []uuid.UUID) error {
+	checked := make(map[uuid.UUID]bool)
+	path := make(map[uuid.UUID]bool)
+
+	var visit func(id uuid.UUID) error
+	visit = func(id uuid.UUID) error {
+		if path[id] {
+			return &DependencyCycleError{ID: &id}
+		}
+		if checked[id] {
+			return nil
+		}
+		taskSpec, err := store.GetTask(&id)
+		if err != nil {
+			return &UnknownDependencyError{ID: &id}
+		}
+
+		path[id] = true
+		for _, parent := range taskSpec.DependsOn {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		delete(path, id)
+		checked[id] = true
+		return nil
+	}
+
+	for _, parent := range parents {
+		if err := visit(parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordDependencies : record that a newly created task is waiting for the given number of tasks it
+// depends on to succeed, or was skipped because one of them did not. Does nothing for other tasks
+func RecordDependencies(store Store, created *CreatedTask, parents int) {
+	switch created.State {
+	case model.StateBlocked:
+		fmt.Printf("Task %s blocked on %d dependencies\n", created.ID.String(), parents)
+		RecordEvent(store, created.ID, &model.Event{Type: model.EventBlocked, Source: model.SourceDependencies,
+			State: model.StateBlocked, Message: fmt.Sprintf("waiting for %d tasks to succeed", parents)})
+	case model.StateSkipped:
+		fmt.Printf("Task %s skipped, a task it depends on did not succeed\n", created.ID.String())
+		RecordEvent(store, created.ID, &model.Event{Type: model.EventCompleted, Source: model.SourceDependencies,
+			State: model.StateSkipped, Message: "a task it depends on did not succeed"})
+	}
+}
+
+// ResolveDependents : let the children of a task that has completed know the outcome. Children
+// whose parents have now all succeeded are released, children of a task that did not succeed
+// are skipped along with everything that depends on them
+func ResolveDependents(store Store, id *uuid.UUID, succeeded bool) {
+	children, err := store.GetTaskChildren(id)
+	if err != nil {
+		fmt.Printf("Failed to retrieve tasks depending on %s: %s\n", id.String(), err.Error())
+		return
+	}
+
+	for _, child := range children {
+		if !succeeded {
+			skipTask(store, child)
+			continue
+		}
+
+		remaining, err := store.ResolveTaskDependency(child, id)
+		if err != nil {
+			fmt.Printf("Failed to resolve dependency of task %s on %s: %s\n", child.String(), id.String(), err.Error())
+			continue
+		}
+		if remaining > 0 {
+			continue
+		}
+
+		err = releaseBlockedTask(store, child)
+		if err != nil {
+			fmt.Printf("Failed to release task %s: %s\n", child.String(), err.Error())
+		}
+	}
+}
+
+// releaseBlockedTask : queue a blocked task whose parents have all succeeded,
+// or delay it if it is not due yet
+func releaseBlockedTask(store Store, id *uuid.UUID) error {
+	taskSpec, err := store.GetTask(id)
+	if err != nil {
+		return err
+	}
+
+	if taskSpec.RunAt != nil && taskSpec.RunAt.After(time.Now()) {
+		err = store.TransitionTaskFrom(id, model.StateBlocked, model.StateDelayed)
+		if err != nil {
+			return err
+		}
+		err = store.DelayTask(id, *taskSpec.RunAt)
+		if err != nil {
+			return err
+		}
+		RecordEvent(store, id, &model.Event{Type: model.EventDelayed, Source: model.SourceDependencies,
+			State: model.StateDelayed, Message: "due at " + taskSpec.RunAt.Format(time.RFC3339)})
+		return nil
+	}
+
+	err = store.TransitionTaskFrom(id, model.StateBlocked, model.StateQueued)
+	if err != nil {
+		return err
+	}
+	_, err = store.PushTask(id)
+	if err != nil {
+		return err
+	}
+	RecordEvent(store, id, &model.Event{Type: model.EventQueued, Source: model.SourceDependencies,
+		State: model.StateQueued, Message: "the tasks it depends on have succeeded"})
+	return nil
+}
+
+func skipTask(store Store, id *uuid.UUID) {
+	err := store.TransitionTaskFrom(id, model.StateBlocked, model.StateSkipped)
+	if err != nil {
+		fmt.Printf("Not skipping task %s: %s\n", id.String(), err.Error())
+		return
+	}
+	fmt.Printf("Task %s skipped, a task it depends on did not succeed\n", id.String())
+	RecordEvent(store, id, &model.Event{Type: model.EventCompleted, Source: model.SourceDependencies,
+		State: model.StateSkipped, Message: "a task it depends on did not succeed"})
+	ResolveDependents(store, id, false)
+}
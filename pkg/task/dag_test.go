@@ -0,0 +1,185 @@
+package task_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("dependencies", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	givenTask := func(state model.State, parents ...uuid.UUID) uuid.UUID {
+		id := uuid.Must(uuid.NewV4())
+		_, err := taskStore.CreateTasks([]model.Spec{{ID: &id, Image: "alpine", DependsOn: parents}}, 10, time.Now())
+		failOnError(err)
+		_, err = taskStore.RemoveTaskFromQueue(&id)
+		failOnError(err)
+		directRedis.Set("task:"+id.String()+":state", string(state))
+		return id
+	}
+
+	givenBlockedTask := func(parents ...uuid.UUID) uuid.UUID {
+		id := uuid.Must(uuid.NewV4())
+		_, err := taskStore.CreateTasks([]model.Spec{{ID: &id, Image: "alpine", DependsOn: parents}}, 10, time.Now())
+		failOnError(err)
+		return id
+	}
+
+	stateOf := func(id uuid.UUID) model.State {
+		state, err := taskStore.GetTaskState(&id)
+		failOnError(err)
+		return state
+	}
+
+	Describe("checking dependencies", func() {
+		It("should accept parents that exist", func() {
+			// Arrange
+			grandparent := givenTask(model.StateSucceeded)
+			parent := givenTask(model.StateRunning, grandparent)
+
+			// Act
+			err := task.CheckDependencies(taskStore, []uuid.UUID{parent, grandparent})
+
+			// Assert
+			assert.Nil(context, err)
+		})
+
+		It("should reject a parent that does not exist", func() {
+			// Arrange
+			unknown := uuid.Must(uuid.NewV4())
+
+			// Act
+			err := task.CheckDependencies(taskStore, []uuid.UUID{unknown})
+
+			// Assert
+			assert.IsType(context, &task.UnknownDependencyError{}, err)
+		})
+
+		It("should reject parents that depend on each other in a cycle", func() {
+			// Arrange
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := givenTask(model.StateBlocked, firstID)
+			_, err := taskStore.CreateTasks([]model.Spec{{ID: &firstID, Image: "alpine", DependsOn: []uuid.UUID{secondID}}}, 10, time.Now())
+			failOnError(err)
+
+			// Act
+			err = task.CheckDependencies(taskStore, []uuid.UUID{firstID})
+
+			// Assert
+			assert.IsType(context, &task.DependencyCycleError{}, err)
+		})
+	})
+
+	Describe("recording dependencies", func() {
+		eventsOf := func(id uuid.UUID) []*model.Event {
+			events, err := taskStore.GetTaskEvents(&id)
+			failOnError(err)
+			return events
+		}
+
+		It("should record that a blocked task is waiting for its parents", func() {
+			// Arrange
+			parent := givenTask(model.StateRunning)
+			created, err := taskStore.CreateTask(model.Spec{Image: "alpine", DependsOn: []uuid.UUID{parent}}, 10, time.Now())
+			failOnError(err)
+
+			// Act
+			task.RecordDependencies(taskStore, created, 1)
+
+			// Assert
+			events := eventsOf(*created.ID)
+			assert.Len(context, events, 1)
+			assert.Equal(context, model.EventBlocked, events[0].Type)
+			assert.Equal(context, model.StateBlocked, events[0].State)
+			assert.Equal(context, "waiting for 1 tasks to succeed", events[0].Message)
+		})
+
+		It("should record that a task was skipped because a parent did not succeed", func() {
+			// Arrange
+			parent := givenTask(model.StateFailed)
+			created, err := taskStore.CreateTask(model.Spec{Image: "alpine", DependsOn: []uuid.UUID{parent}}, 10, time.Now())
+			failOnError(err)
+
+			// Act
+			task.RecordDependencies(taskStore, created, 1)
+
+			// Assert
+			events := eventsOf(*created.ID)
+			assert.Len(context, events, 1)
+			assert.Equal(context, model.EventCompleted, events[0].Type)
+			assert.Equal(context, model.StateSkipped, events[0].State)
+		})
+
+		It("should record nothing for a task whose parents have succeeded", func() {
+			// Arrange
+			parent := givenTask(model.StateSucceeded)
+			created, err := taskStore.CreateTask(model.Spec{Image: "alpine", DependsOn: []uuid.UUID{parent}}, 10, time.Now())
+			failOnError(err)
+
+			// Act
+			task.RecordDependencies(taskStore, created, 1)
+
+			// Assert
+			assert.Equal(context, model.StateQueued, created.State)
+			assert.Empty(context, eventsOf(*created.ID))
+		})
+	})
+
+	Describe("resolving dependents", func() {
+		It("should queue a child once all of its parents have succeeded", func() {
+			// Arrange
+			first := givenTask(model.StateRunning)
+			second := givenTask(model.StateRunning)
+			child := givenBlockedTask(first, second)
+
+			// Act
+			directRedis.Set("task:"+first.String()+":state", string(model.StateSucceeded))
+			task.ResolveDependents(taskStore, &first, true)
+			stillBlocked := stateOf(child)
+			directRedis.Set("task:"+second.String()+":state", string(model.StateSucceeded))
+			task.ResolveDependents(taskStore, &second, true)
+
+			// Assert
+			popped, err := taskStore.PopTask()
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateBlocked, stillBlocked)
+			assert.Equal(context, model.StateQueued, stateOf(child))
+			assert.Equal(context, child, *popped)
+		})
+
+		It("should skip every task downstream of a parent that did not succeed", func() {
+			// Arrange
+			parent := givenTask(model.StateRunning)
+			child := givenBlockedTask(parent)
+			grandchild := givenBlockedTask(child)
+
+			// Act
+			task.ResolveDependents(taskStore, &parent, false)
+
+			// Assert
+			assert.Equal(context, model.StateSkipped, stateOf(child))
+			assert.Equal(context, model.StateSkipped, stateOf(grandchild))
+		})
+	})
+})
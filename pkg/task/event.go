@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"github.com/execd/task-store/pkg/model"
 	"github.com/execd/task-store/pkg/rabbit"
+	"github.com/satori/go.uuid"
 )
 
 // EventManager : interface for an event listener
 type EventManager interface {
 	PublishWork(task *model.Spec) error
+	PublishCancel(id *uuid.UUID) error
 	ListenForProgress(quit <-chan int) (<-chan model.Info, <-chan error)
 }
 
@@ -29,7 +31,14 @@ func (e *EventManagerImpl) PublishWork(task *model.Spec) error {
 	return e.rabbit.PublishWork(task)
 }
 
-// ListenForProgress : listen for task progress
+// PublishCancel : ask the worker executing the given task to stop it
+func (e *EventManagerImpl) PublishCancel(id *uuid.UUID) error {
+	fmt.Printf("Publishing cancel request for task %s\n", id.String())
+	return e.rabbit.PublishCancel(id)
+}
+
+// ListenForProgress : listen for task progress, both the updates workers send while a task
+// is executing and the result they send once it has completed
 func (e *EventManagerImpl) ListenForProgress(quit <-chan int) (<-chan model.Info, <-chan error) {
 	status := make(chan model.Info, 100)
 	errors := make(chan error)
@@ -48,6 +57,8 @@ func (e *EventManagerImpl) ListenForProgress(quit <-chan int) (<-chan model.Info
 				if err != nil {
 					fmt.Println("error occurred unmarshalling data")
 					errors <- fmt.Errorf("error occurred unmarshalling data (%s) : %s", string(msg.Body()[:]), err.Error())
+				} else if err := info.Validate(); err != nil {
+					errors <- fmt.Errorf("received invalid task status (%s) : %s", string(msg.Body()[:]), err.Error())
 				} else {
 					i := *info
 					status <- i
@@ -99,6 +99,30 @@ var _ = Describe("event", func() {
 				assert.Fail(context, "Timed out waiting for channel to close, or error to be received")
 			}
 		})
+
+		It("should add error to error channel if the status is not one a worker may report", func() {
+			// Arrange
+			quit := make(chan int, 1)
+			defer close(quit)
+			id := uuid.Must(uuid.NewV4())
+			data, err := (&model.Info{ID: &id, Status: "paused"}).MarshalBinary()
+			assert.Nil(context, err)
+			rabbitMock.On("GetTaskStatusQueueChan").Return(buildMsgChan(data))
+			timeout := time.After(time.Millisecond * 50)
+
+			// Act
+			status, errors := eventListener.ListenForProgress(quit)
+
+			// Assert
+			select {
+			case <-status:
+				assert.Fail(context, "Should not read a status.")
+			case err := <-errors:
+				assert.Contains(context, err.Error(), "received invalid task status")
+			case <-timeout:
+				assert.Fail(context, "Timed out waiting for an error to be received")
+			}
+		})
 	})
 })
 
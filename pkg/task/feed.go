@@ -0,0 +1,131 @@
+package task
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/go-redis/redis"
+	"sync"
+)
+
+const statusChannelName = "tasks:status"
+
+// watcherBufferSize : how many statuses a watcher may fall behind by before it is dropped
+const watcherBufferSize = 64
+
+// StatusFeed : announces what happens to tasks to the clients watching them
+type StatusFeed interface {
+	Publish(status *model.TaskStatus) error
+	Subscribe() (<-chan *model.TaskStatus, func())
+}
+
+// statusHub : hands each status to every watcher of this process. A watcher that falls
+// behind is dropped by closing its channel rather than holding the others up
+type statusHub struct {
+	lock     sync.Mutex
+	watchers map[chan *model.TaskStatus]bool
+}
+
+func newStatusHub() *statusHub {
+	return &statusHub{watchers: make(map[chan *model.TaskStatus]bool)}
+}
+
+func (h *statusHub) subscribe() (<-chan *model.TaskStatus, func()) {
+	watcher := make(chan *model.TaskStatus, watcherBufferSize)
+	h.lock.Lock()
+	h.watchers[watcher] = true
+	h.lock.Unlock()
+	return watcher, func() { h.unsubscribe(watcher) }
+}
+
+func (h *statusHub) unsubscribe(watcher chan *model.TaskStatus) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.watchers[watcher] {
+		delete(h.watchers, watcher)
+		close(watcher)
+	}
+}
+
+func (h *statusHub) broadcast(status *model.TaskStatus) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for watcher := range h.watchers {
+		select {
+		case watcher <- status:
+		default:
+			fmt.Printf("Dropping a watcher that fell %d statuses behind\n", watcherBufferSize)
+			delete(h.watchers, watcher)
+			close(watcher)
+		}
+	}
+}
+
+// LocalStatusFeed : a StatusFeed that only reaches the clients watching this task-store
+type LocalStatusFeed struct {
+	hub *statusHub
+}
+
+// NewLocalStatusFeed : build a LocalStatusFeed
+func NewLocalStatusFeed() *LocalStatusFeed {
+	return &LocalStatusFeed{hub: newStatusHub()}
+}
+
+// Publish : announce the given status to the watchers of this task-store
+func (f *LocalStatusFeed) Publish(status *model.TaskStatus) error {
+	f.hub.broadcast(status)
+	return nil
+}
+
+// Subscribe : get a channel the statuses published from now on are pushed to, and a function that
+// stops them. The channel is closed once they are stopped, or if the watcher falls behind
+func (f *LocalStatusFeed) Subscribe() (<-chan *model.TaskStatus, func()) {
+	return f.hub.subscribe()
+}
+
+// RedisStatusFeed : a StatusFeed that reaches the clients watching any task-store sharing the redis
+// instance, through redis pub/sub. Each task-store holds a single subscription its watchers share
+type RedisStatusFeed struct {
+	redis *redis.Client
+	hub   *statusHub
+	relay sync.Once
+}
+
+// NewRedisStatusFeed : build a RedisStatusFeed
+func NewRedisStatusFeed(redis *redis.Client) *RedisStatusFeed {
+	return &RedisStatusFeed{redis: redis, hub: newStatusHub()}
+}
+
+// Publish : announce the given status to the watchers of every task-store
+func (f *RedisStatusFeed) Publish(status *model.TaskStatus) error {
+	data, err := status.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = f.redis.Publish(statusChannelName, data).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish status of task %s : %s", status.TaskID.String(), err.Error())
+	}
+	return nil
+}
+
+// Subscribe : get a channel the statuses published from now on are pushed to, and a function that
+// stops them. The channel is closed once they are stopped, or if the watcher falls behind
+func (f *RedisStatusFeed) Subscribe() (<-chan *model.TaskStatus, func()) {
+	f.relay.Do(func() {
+		go f.relayStatuses(f.redis.Subscribe(statusChannelName))
+	})
+	return f.hub.subscribe()
+}
+
+// relayStatuses : hand the statuses published by every task-store to the watchers of this one.
+// The subscription reconnects by itself if the connection to redis is lost
+func (f *RedisStatusFeed) relayStatuses(pubSub *redis.PubSub) {
+	for message := range pubSub.Channel() {
+		status := new(model.TaskStatus)
+		if err := status.UnmarshalBinary([]byte(message.Payload)); err != nil {
+			fmt.Printf("Failed to build task status from published data %s\n", message.Payload)
+			continue
+		}
+		f.hub.broadcast(status)
+	}
+}
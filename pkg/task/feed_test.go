@@ -0,0 +1,101 @@
+package task_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("status feed", func() {
+	var feed *task.LocalStatusFeed
+	var taskID uuid.UUID
+
+	BeforeEach(func() {
+		feed = task.NewLocalStatusFeed()
+		taskID = uuid.Must(uuid.NewV4())
+	})
+
+	It("should hand each status to every watcher", func() {
+		// Arrange
+		first, stopFirst := feed.Subscribe()
+		defer stopFirst()
+		second, stopSecond := feed.Subscribe()
+		defer stopSecond()
+		status := &model.TaskStatus{TaskID: &taskID, Event: model.Event{Type: model.EventCreated}}
+
+		// Act
+		err := feed.Publish(status)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Equal(context, status, <-first)
+		assert.Equal(context, status, <-second)
+	})
+
+	It("should close the channel of a watcher that stops watching", func() {
+		// Arrange
+		statuses, stop := feed.Subscribe()
+
+		// Act
+		stop()
+		stop()
+		failOnError(feed.Publish(&model.TaskStatus{TaskID: &taskID}))
+
+		// Assert
+		_, ok := <-statuses
+		assert.False(context, ok)
+	})
+
+	It("should drop a watcher that falls behind without holding up the others", func() {
+		// Arrange
+		slow, stopSlow := feed.Subscribe()
+		defer stopSlow()
+		for i := 0; i < 64; i++ {
+			failOnError(feed.Publish(&model.TaskStatus{TaskID: &taskID}))
+		}
+		fresh, stopFresh := feed.Subscribe()
+		defer stopFresh()
+
+		// Act
+		err := feed.Publish(&model.TaskStatus{TaskID: &taskID, Event: model.Event{Type: model.EventCompleted}})
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Equal(context, model.EventCompleted, (<-fresh).Type)
+		received := 0
+		for range slow {
+			received++
+		}
+		assert.Equal(context, 64, received)
+	})
+
+	It("should announce the events recorded in a store along with the task's namespace and metadata", func() {
+		// Arrange
+		s, err := miniredis.Run()
+		failOnError(err)
+		defer s.Close()
+		taskStore := task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl()).WithStatusFeed(feed)
+		namespaceStore := taskStore.InNamespace("team-a")
+		id, err := storeTask(namespaceStore, model.Spec{Image: "alpine", Metadata: map[string]string{"team": "a"}})
+		failOnError(err)
+		statuses, stop := taskStore.WatchTaskStatus()
+		defer stop()
+
+		// Act
+		err = namespaceStore.RecordTaskEvent(id, &model.Event{Type: model.EventCreated, State: model.StateQueued})
+
+		// Assert
+		assert.Nil(context, err)
+		status := <-statuses
+		assert.Equal(context, id, status.TaskID)
+		assert.Equal(context, "team-a", status.Namespace)
+		assert.Equal(context, map[string]string{"team": "a"}, status.Metadata)
+		assert.Equal(context, model.EventCreated, status.Type)
+		assert.Equal(context, model.StateQueued, status.State)
+	})
+})
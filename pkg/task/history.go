@@ -0,0 +1,20 @@
+package task
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// RecordEvent : add an event to the history of the given task. A failure to record it is only
+// logged, the history must not get in the way of managing the task
+func RecordEvent(store Store, id *uuid.UUID, event *model.Event) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+	err := store.RecordTaskEvent(id, event)
+	if err != nil {
+		fmt.Printf("Failed to record %s event of task %s: %s\n", event.Type, id.String(), err.Error())
+	}
+}
@@ -0,0 +1,259 @@
+package task
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+	"strconv"
+	"strings"
+)
+
+// Every index is a sorted set of task ids scored by when the task was created, so any of them can be walked
+// in the order tasks are listed in. Tasks stored before the indexes existed are not on them
+const createdIndexName = "tasks:created"
+const stateIndexPrefix = "tasks:state"
+const imageIndexPrefix = "tasks:image"
+const metadataIndexPrefix = "tasks:metadata"
+
+// listBatchSize : how many members of an index are read at a time while filling a page of tasks
+const listBatchSize = 100
+
+// ListTasks : a page of at most limit tasks matching the given filter, the most recently created first,
+// carrying on after the given cursor if there is one. The smallest of the indexes the filter applies to
+// is walked and every other one is checked for the tasks on it, so the keyspace is never scanned
+func (s *StoreImpl) ListTasks(filter *model.TaskFilter, after *model.TaskCursor, limit int) (*model.TaskPage, error) {
+	walked, others, err := s.smallestIndex(s.filterIndexKeys(filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks : %s", err.Error())
+	}
+
+	matches, err := s.walkIndex(walked, others, filter, after, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks : %s", err.Error())
+	}
+
+	page := &model.TaskPage{Tasks: []*model.TaskSummary{}}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		last := matches[len(matches)-1]
+		id, _ := uuid.FromString(last.Member.(string))
+		page.NextCursor = (&model.TaskCursor{CreatedAt: fromMillis(int64(last.Score)), ID: &id}).Encode()
+	}
+
+	page.Tasks, err = s.summarizeTasks(matches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks : %s", err.Error())
+	}
+	return page, nil
+}
+
+// taskIndexKeys : the indexes the given task belongs on, other than the one of its state
+func (s *StoreImpl) taskIndexKeys(taskSpec *model.Spec) []string {
+	keys := []string{s.key(createdIndexName)}
+	if taskSpec.Image != "" {
+		keys = append(keys, s.buildImageIndexKey(taskSpec.Image))
+	}
+	for key, value := range taskSpec.Metadata {
+		// a selector cannot name a key holding '=', and indexing it would clash with other keys
+		if !strings.Contains(key, "=") {
+			keys = append(keys, s.buildMetadataIndexKey(key, value))
+		}
+	}
+	return keys
+}
+
+// filterIndexKeys : the indexes a task must be on to match the given filter
+func (s *StoreImpl) filterIndexKeys(filter *model.TaskFilter) []string {
+	var keys []string
+	if filter.State != "" {
+		keys = append(keys, s.buildStateIndexKey(filter.State))
+	}
+	if filter.Image != "" {
+		keys = append(keys, s.buildImageIndexKey(filter.Image))
+	}
+	for key, value := range filter.Metadata {
+		keys = append(keys, s.buildMetadataIndexKey(key, value))
+	}
+	if len(keys) == 0 {
+		keys = append(keys, s.key(createdIndexName))
+	}
+	return keys
+}
+
+// smallestIndex : the given index with the fewest tasks on it, along with the rest of them
+func (s *StoreImpl) smallestIndex(indexes []string) (string, []string, error) {
+	sizes := make([]*redis.IntCmd, len(indexes))
+	_, err := s.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, index := range indexes {
+			sizes[i] = pipe.ZCard(index)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	smallest := 0
+	for i := range sizes {
+		if sizes[i].Val() < sizes[smallest].Val() {
+			smallest = i
+		}
+	}
+	others := make([]string, 0, len(indexes)-1)
+	others = append(others, indexes[:smallest]...)
+	others = append(others, indexes[smallest+1:]...)
+	return indexes[smallest], others, nil
+}
+
+// walkIndex : walk the given index from the most recently created task, collecting up to want of the
+// tasks that were created in the filter's range after the cursor and are also on every other index
+func (s *StoreImpl) walkIndex(index string, others []string, filter *model.TaskFilter, after *model.TaskCursor, want int) ([]redis.Z, error) {
+	min, max := "-inf", "+inf"
+	if filter.CreatedAfter != nil {
+		min = "(" + strconv.FormatInt(toMillis(*filter.CreatedAfter), 10)
+	}
+	if filter.CreatedBefore != nil {
+		max = "(" + strconv.FormatInt(toMillis(*filter.CreatedBefore), 10)
+	}
+	if after != nil && (filter.CreatedBefore == nil || toMillis(after.CreatedAt) < toMillis(*filter.CreatedBefore)) {
+		max = strconv.FormatInt(toMillis(after.CreatedAt), 10)
+	}
+
+	var matches []redis.Z
+	var offset int64
+	for len(matches) < want {
+		batch, err := s.redis.ZRevRangeByScoreWithScores(index, redis.ZRangeBy{Min: min, Max: max, Offset: offset, Count: listBatchSize}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		candidates := make([]redis.Z, 0, len(batch))
+		for _, member := range batch {
+			// tasks created in the same millisecond are listed in descending order of their ids
+			if after != nil && int64(member.Score) == toMillis(after.CreatedAt) && member.Member.(string) >= after.ID.String() {
+				continue
+			}
+			candidates = append(candidates, member)
+		}
+		found, err := s.onEveryIndex(candidates, others)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+
+		if len(batch) < listBatchSize {
+			break
+		}
+		// carry on from the last task read, skipping the ones read so far that were created at the same time
+		last := strconv.FormatInt(int64(batch[len(batch)-1].Score), 10)
+		if last == max {
+			offset += int64(len(batch))
+			continue
+		}
+		max, offset = last, 0
+		for _, member := range batch {
+			if strconv.FormatInt(int64(member.Score), 10) == last {
+				offset++
+			}
+		}
+	}
+
+	if len(matches) > want {
+		matches = matches[:want]
+	}
+	return matches, nil
+}
+
+// onEveryIndex : the given tasks that are on every one of the given indexes
+func (s *StoreImpl) onEveryIndex(candidates []redis.Z, indexes []string) ([]redis.Z, error) {
+	if len(candidates) == 0 || len(indexes) == 0 {
+		return candidates, nil
+	}
+
+	scores := make([][]*redis.FloatCmd, len(candidates))
+	_, err := s.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, candidate := range candidates {
+			for _, index := range indexes {
+				scores[i] = append(scores[i], pipe.ZScore(index, candidate.Member.(string)))
+			}
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	matches := make([]redis.Z, 0, len(candidates))
+	for i, candidate := range candidates {
+		onEvery := true
+		for _, score := range scores[i] {
+			if score.Err() == redis.Nil {
+				onEvery = false
+			} else if score.Err() != nil {
+				return nil, score.Err()
+			}
+		}
+		if onEvery {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches, nil
+}
+
+// summarizeTasks : the spec and state of each of the given tasks
+func (s *StoreImpl) summarizeTasks(members []redis.Z) ([]*model.TaskSummary, error) {
+	specs := make([]*redis.StringCmd, len(members))
+	states := make([]*redis.StringCmd, len(members))
+	ids := make([]*uuid.UUID, len(members))
+	for i, member := range members {
+		id, err := uuid.FromString(member.Member.(string))
+		if err != nil {
+			return nil, fmt.Errorf("malformed task id %v in index", member.Member)
+		}
+		ids[i] = &id
+	}
+	_, err := s.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			specs[i] = pipe.Get(s.buildTaskKey(id))
+			states[i] = pipe.Get(s.buildTaskStateKey(id))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	summaries := make([]*model.TaskSummary, 0, len(members))
+	for i, member := range members {
+		data, err := specs[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		taskSpec := new(model.Spec)
+		if err := taskSpec.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, fmt.Errorf("failed to build task with id %s from retrieved data %s", ids[i].String(), data)
+		}
+		summaries = append(summaries, &model.TaskSummary{
+			Spec:      taskSpec,
+			State:     model.State(states[i].Val()),
+			CreatedAt: fromMillis(int64(member.Score)).UTC(),
+		})
+	}
+	return summaries, nil
+}
+
+func (s *StoreImpl) buildStateIndexKey(state model.State) string {
+	return s.key(fmt.Sprintf("%s:%s", stateIndexPrefix, state))
+}
+
+func (s *StoreImpl) buildImageIndexKey(image string) string {
+	return s.key(fmt.Sprintf("%s:%s", imageIndexPrefix, image))
+}
+
+func (s *StoreImpl) buildMetadataIndexKey(key string, value string) string {
+	return s.key(fmt.Sprintf("%s:%s=%s", metadataIndexPrefix, key, value))
+}
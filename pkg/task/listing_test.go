@@ -0,0 +1,166 @@
+package task_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("listing tasks", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var now time.Time
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		now = time.Now().UTC().Round(time.Millisecond)
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	givenTask := func(spec model.Spec, createdAt time.Time) *uuid.UUID {
+		created, err := taskStore.CreateTask(spec, 1000, createdAt)
+		failOnError(err)
+		return created.ID
+	}
+
+	listedIDs := func(page *model.TaskPage) []*uuid.UUID {
+		ids := make([]*uuid.UUID, 0, len(page.Tasks))
+		for _, summary := range page.Tasks {
+			ids = append(ids, summary.ID)
+		}
+		return ids
+	}
+
+	It("should list every task, the most recently created first", func() {
+		// Arrange
+		first := givenTask(model.Spec{Image: "alpine"}, now)
+		second := givenTask(model.Spec{Image: "busybox"}, now.Add(time.Second))
+
+		// Act
+		page, err := taskStore.ListTasks(&model.TaskFilter{}, nil, 10)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Equal(context, []*uuid.UUID{second, first}, listedIDs(page))
+		assert.Equal(context, model.StateQueued, page.Tasks[0].State)
+		assert.Equal(context, "busybox", page.Tasks[0].Image)
+		assert.True(context, now.Add(time.Second).Equal(page.Tasks[0].CreatedAt))
+		assert.Empty(context, page.NextCursor)
+	})
+
+	It("should list the tasks matching every filter", func() {
+		// Arrange
+		match := givenTask(model.Spec{Image: "alpine", Metadata: map[string]string{"team": "a", "env": "prod"}}, now)
+		givenTask(model.Spec{Image: "busybox", Metadata: map[string]string{"team": "a", "env": "prod"}}, now)
+		givenTask(model.Spec{Image: "alpine", Metadata: map[string]string{"team": "b", "env": "prod"}}, now)
+		scheduled := givenTask(model.Spec{Image: "alpine", Metadata: map[string]string{"team": "a", "env": "prod"}}, now)
+		failOnError(taskStore.TransitionTask(scheduled, model.StateScheduled))
+		filter := &model.TaskFilter{
+			State:    model.StateQueued,
+			Image:    "alpine",
+			Metadata: model.Selector{"team": "a", "env": "prod"},
+		}
+
+		// Act
+		page, err := taskStore.ListTasks(filter, nil, 10)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Equal(context, []*uuid.UUID{match}, listedIDs(page))
+	})
+
+	It("should keep the state index up to date as tasks move", func() {
+		// Arrange
+		id := givenTask(model.Spec{Image: "alpine"}, now)
+		failOnError(taskStore.TransitionTask(id, model.StateScheduled))
+		failOnError(taskStore.TransitionTask(id, model.StateSucceeded))
+
+		// Act
+		queued, err := taskStore.ListTasks(&model.TaskFilter{State: model.StateQueued}, nil, 10)
+		failOnError(err)
+		succeeded, err := taskStore.ListTasks(&model.TaskFilter{State: model.StateSucceeded}, nil, 10)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Empty(context, queued.Tasks)
+		assert.Equal(context, []*uuid.UUID{id}, listedIDs(succeeded))
+		assert.Equal(context, model.StateSucceeded, succeeded.Tasks[0].State)
+	})
+
+	It("should list the tasks created within the given range", func() {
+		// Arrange
+		givenTask(model.Spec{Image: "alpine"}, now)
+		inside := givenTask(model.Spec{Image: "alpine"}, now.Add(time.Minute))
+		givenTask(model.Spec{Image: "alpine"}, now.Add(2*time.Minute))
+		after, before := now, now.Add(2*time.Minute)
+
+		// Act
+		page, err := taskStore.ListTasks(&model.TaskFilter{CreatedAfter: &after, CreatedBefore: &before}, nil, 10)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Equal(context, []*uuid.UUID{inside}, listedIDs(page))
+	})
+
+	It("should page through every task exactly once, even those created at the same time", func() {
+		// Arrange
+		specs := make([]model.Spec, 250)
+		for i := range specs {
+			specs[i] = model.Spec{Image: "alpine"}
+		}
+		_, err := taskStore.StoreTaskBatch(specs, 1000, now)
+		failOnError(err)
+		_, err = taskStore.StoreTaskBatch(specs[:10], 1000, now.Add(time.Second))
+		failOnError(err)
+
+		// Act
+		seen := map[uuid.UUID]bool{}
+		var cursor *model.TaskCursor
+		pages := 0
+		for {
+			page, err := taskStore.ListTasks(&model.TaskFilter{Image: "alpine"}, cursor, 30)
+			failOnError(err)
+			pages++
+			for _, summary := range page.Tasks {
+				assert.False(context, seen[*summary.ID], "task %s listed twice", summary.ID.String())
+				seen[*summary.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor, err = model.ParseTaskCursor(page.NextCursor)
+			failOnError(err)
+		}
+
+		// Assert
+		assert.Len(context, seen, 260)
+		assert.Equal(context, 9, pages)
+	})
+
+	It("should return error if listing tasks fails", func() {
+		// Arrange
+		directRedis.Close()
+
+		// Act
+		page, err := taskStore.ListTasks(&model.TaskFilter{}, nil, 10)
+
+		// Assert
+		assert.Nil(context, page)
+		assert.NotNil(context, err)
+		assert.Contains(context, err.Error(), "failed to list tasks")
+	})
+})
@@ -6,94 +6,378 @@ import (
 	"github.com/execd/task-store/pkg/util"
 	"github.com/go-redis/redis"
 	"github.com/satori/go.uuid"
+	"sort"
+	"strconv"
+	"time"
 )
 
 const taskQueueName = "taskQ"
-const executingQueueName = "executing"
+const taskQueueSequenceName = "taskQ:seq"
+const leaseSetName = "leases"
+const delayedSetName = "delayed"
+const deadlineSetName = "deadlines"
 const taskPrefix = "task"
 const infoPostFix = "info"
+const statePostFix = "state"
+const attemptsPostFix = "attempts"
+const childrenPostFix = "children"
+const parentsPostFix = "parents"
+const idempotencyPrefix = "idempotency"
+const dedupePrefix = "dedupe"
+const mergedPostFix = "merged"
+const resourcesPostFix = "resources"
+const leasePostFix = "lease"
+const progressPostFix = "progress"
+const eventsPostFix = "events"
+const resourcesUsedName = "resources:used"
+const namespacePrefix = "namespace"
+const namespacesSetName = "namespaces"
+const taskNamespacesName = "namespaces:tasks"
+const maxTransitionAttempts = 5
+
+// maxTaskEvents : the most events kept in the history of a task, the oldest are dropped first
+const maxTaskEvents = 1000
+
+// priorityScale : separates priorities in the task queue's scores, tasks of the same
+// priority are ordered by a sequence number below this scale so they stay first in first out
+const priorityScale = 1e12
+
+// idempotencyReservationTTL : how long an idempotency key is held for a request still being handled,
+// so that a key reserved by a request that never finished can be used again before long
+const idempotencyReservationTTL = time.Minute
+
+// leaseForever : the expiry, in milliseconds, of a lease that never expires
+const leaseForever = 1 << 53
+
+// popDueScript : atomically removes and returns the members of a sorted set
+// scored at or below the given score
+var popDueScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+end
+return due
+`)
+
+// reserveResourcesScript : atomically reserves the requested resources for a task if every one of
+// them fits in what the pool has left, recording the reservation against the task. ARGV holds a
+// name, requested amount and capacity for each resource. Returns 1 if the resources are reserved
+var reserveResourcesScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 1
+end
+for i = 1, #ARGV, 3 do
+	local used = tonumber(redis.call('HGET', KEYS[1], ARGV[i]) or '0')
+	if used + tonumber(ARGV[i + 1]) > tonumber(ARGV[i + 2]) then
+		return 0
+	end
+end
+for i = 1, #ARGV, 3 do
+	redis.call('HINCRBY', KEYS[1], ARGV[i], ARGV[i + 1])
+	redis.call('HSET', KEYS[2], ARGV[i], ARGV[i + 1])
+end
+return 1
+`)
+
+// releaseResourcesScript : atomically returns the resources reserved for a task to the pool
+var releaseResourcesScript = redis.NewScript(`
+local reserved = redis.call('HGETALL', KEYS[2])
+for i = 1, #reserved, 2 do
+	redis.call('HINCRBY', KEYS[1], reserved[i], -tonumber(reserved[i + 1]))
+end
+redis.call('DEL', KEYS[2])
+return #reserved / 2
+`)
+
+// renewLeaseScript : atomically extends the live lease of a task on behalf of a worker, recording the
+// worker as its holder. ARGV holds the task's id, the current time, the new expiry, or an empty string
+// to keep the current one, and the worker's id. Returns 0 if the task holds no live lease and -1 if
+// the lease is held by another worker
+var renewLeaseScript = redis.NewScript(`
+local expiry = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not expiry or tonumber(expiry) <= tonumber(ARGV[2]) then
+	return 0
+end
+local holder = redis.call('HGET', KEYS[2], 'worker')
+if holder and holder ~= ARGV[4] then
+	return -1
+end
+redis.call('HSET', KEYS[2], 'worker', ARGV[4])
+if ARGV[3] ~= '' then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+end
+return 1
+`)
 
 // Store : a Store allows pushing popping and reading
 // of task information from a queue
 type Store interface {
-	StoreTask(task model.Spec) (*uuid.UUID, error)
+	InNamespace(namespace string) Store
+	Namespace() string
+	ListNamespaces() ([]string, error)
+	GetTaskNamespace(id *uuid.UUID) (string, error)
+
+	CreateTask(task model.Spec, capacity int64, now time.Time) (*CreatedTask, error)
+	CreateTasks(tasks []model.Spec, capacity int64, now time.Time) ([]*CreatedTask, error)
+	StoreTaskBatch(tasks []model.Spec, capacity int64, now time.Time) ([]*uuid.UUID, error)
 	GetTask(id *uuid.UUID) (*model.Spec, error)
+	ListTasks(filter *model.TaskFilter, after *model.TaskCursor, limit int) (*model.TaskPage, error)
 
 	PushTask(id *uuid.UUID) (int64, error)
+	ReturnTask(id *uuid.UUID) error
 	PopTask() (*uuid.UUID, error)
+	RemoveTaskFromQueue(id *uuid.UUID) (bool, error)
 	TaskQueueSize() (int64, error)
+	TaskQueueSizeForPriority(priority int) (int64, error)
 
-	AddTaskToExecutingSet(id *uuid.UUID) error
+	AddTaskToExecutingSet(id *uuid.UUID, leaseUntil time.Time) error
 	RemoveTaskFromExecutingSet(id *uuid.UUID) error
 	ExecutingSetSize() (int64, error)
 	IsTaskExecuting(id *uuid.UUID) (bool, error)
+	RenewLease(id *uuid.UUID, workerID string, until time.Time) (*model.Lease, error)
+	GetLease(id *uuid.UUID) (*model.Lease, error)
+	PopExpiredLeases(now time.Time) ([]*uuid.UUID, error)
+	ReserveResources(id *uuid.UUID, requests model.Resources, capacity model.Resources) (bool, error)
+	ReleaseResources(id *uuid.UUID) error
+	GetResourceUsage() (model.Resources, error)
+	SetTaskDeadline(id *uuid.UUID, deadline time.Time) error
+	PopExpiredTasks(now time.Time) ([]*uuid.UUID, error)
+
+	RegisterWorker(worker *model.Worker, now time.Time) error
+	RecordHeartbeat(workerID string, tasks []*uuid.UUID, now time.Time) (bool, error)
+	ListWorkers() ([]*model.Worker, error)
+	GetTaskWorker(id *uuid.UUID) (string, error)
+	PopLapsedWorkers(since time.Time) ([]*model.Worker, error)
+
+	DelayTask(id *uuid.UUID, until time.Time) error
+	PopDueTasks(now time.Time) ([]*uuid.UUID, error)
+	RemoveDelayedTask(id *uuid.UUID) (bool, error)
+	GetTaskDueTime(id *uuid.UUID) (*time.Time, error)
 
 	PublishTaskCreatedEvent(id *uuid.UUID)
 	ListenForTaskCreatedEvents() <-chan *uuid.UUID
 	UpdateTaskInfo(info *model.Info) error
+	GetTaskInfo(id *uuid.UUID) (*model.Info, error)
+	UpdateTaskProgress(info *model.Info, at time.Time) error
+	GetTaskProgress(id *uuid.UUID) (*model.Progress, error)
+	RecordTaskEvent(id *uuid.UUID, event *model.Event) error
+	GetTaskEvents(id *uuid.UUID) ([]*model.Event, error)
+	WatchTaskStatus() (<-chan *model.TaskStatus, func())
+	ScheduleCallback(id *uuid.UUID, at time.Time) (bool, error)
+	UpdateCallback(callback *model.Callback) error
+	GetCallback(id *uuid.UUID) (*model.Callback, error)
+	PopDueCallbacks(now time.Time) ([]*uuid.UUID, error)
+	ListDeadCallbacks() ([]*model.Callback, error)
+	RecordTaskAttempt(info *model.Info) (int64, error)
+	GetTaskAttempts(id *uuid.UUID) ([]*model.Info, error)
+
+	GetTaskState(id *uuid.UUID) (model.State, error)
+	TransitionTask(id *uuid.UUID, to model.State) error
+	TransitionTaskFrom(id *uuid.UUID, from model.State, to model.State) error
+
+	ResolveTaskDependency(id *uuid.UUID, parent *uuid.UUID) (int64, error)
+	GetPendingDependencies(id *uuid.UUID) ([]*uuid.UUID, error)
+	GetTaskChildren(id *uuid.UUID) ([]*uuid.UUID, error)
+
+	ReserveIdempotencyKey(key string) (bool, *uuid.UUID, error)
+	BindIdempotencyKey(key string, id *uuid.UUID, window time.Duration) error
+	ReleaseIdempotencyKey(key string) error
+
+	RecordMergedCaller(id *uuid.UUID, caller *model.MergedCaller) error
+	GetMergedCallers(id *uuid.UUID) ([]*model.MergedCaller, error)
+}
+
+// InvalidTransitionError : returned when a task is asked to move
+// to a state that is not reachable from its current state
+type InvalidTransitionError struct {
+	ID   *uuid.UUID
+	From model.State
+	To   model.State
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("task %s cannot transition from %q to %q", e.ID.String(), e.From, e.To)
+}
+
+// LeaseLostError : returned when a lease is renewed for a task that holds no live lease,
+// as it has completed or its lease has expired
+type LeaseLostError struct {
+	ID *uuid.UUID
+}
+
+func (e *LeaseLostError) Error() string {
+	return fmt.Sprintf("task %s holds no live lease", e.ID.String())
+}
+
+// LeaseHeldError : returned when a lease is renewed by a worker other than the one holding it
+type LeaseHeldError struct {
+	ID     *uuid.UUID
+	Worker string
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("the lease of task %s is held by another worker", e.ID.String())
+}
+
+// TaskQueueFullError : returned when a task cannot be created because the task queue has reached its limit
+type TaskQueueFullError struct {
+	Capacity int64
+}
+
+func (e *TaskQueueFullError) Error() string {
+	return fmt.Sprintf("task queue has reached its limit of %d tasks", e.Capacity)
+}
+
+// TaskNotFoundError : returned when a task does not exist
+type TaskNotFoundError struct {
+	ID *uuid.UUID
+}
+
+func (e *TaskNotFoundError) Error() string {
+	return fmt.Sprintf("failed to retrieve task with id %s", e.ID.String())
+}
+
+// CorruptTaskError : returned when the stored spec of a task cannot be read
+type CorruptTaskError struct {
+	ID   *uuid.UUID
+	Data string
+}
+
+func (e *CorruptTaskError) Error() string {
+	return fmt.Sprintf("failed to build task with id %s from retrieved data %s", e.ID.String(), e.Data)
 }
 
 // NewStoreImpl : build a StoreImpl
 func NewStoreImpl(redis *redis.Client, uuidGen util.UUIDGen) *StoreImpl {
 	createCh := make(chan *uuid.UUID, 100)
-	return &StoreImpl{redis: redis, uuidGen: uuidGen, createCh: createCh}
+	return &StoreImpl{redis: redis, uuidGen: uuidGen, createCh: createCh, feed: NewLocalStatusFeed()}
 }
 
 // StoreImpl : redis implementation of a Store.
 type StoreImpl struct {
-	redis    *redis.Client
-	uuidGen  util.UUIDGen
-	createCh chan *uuid.UUID
+	redis     *redis.Client
+	uuidGen   util.UUIDGen
+	createCh  chan *uuid.UUID
+	feed      StatusFeed
+	namespace string
+}
+
+// WithStatusFeed : announce the events recorded in the store on the given feed rather than only to the
+// clients watching this task-store
+func (s *StoreImpl) WithStatusFeed(feed StatusFeed) *StoreImpl {
+	s.feed = feed
+	return s
+}
+
+// InNamespace : a store for the tasks of the given namespace, sharing this store's connection, task
+// created events and status feed. The keys of the default namespace, named by the empty string, are not prefixed
+func (s *StoreImpl) InNamespace(namespace string) Store {
+	return &StoreImpl{redis: s.redis, uuidGen: s.uuidGen, createCh: s.createCh, feed: s.feed, namespace: namespace}
 }
 
-// StoreTask : store the given task
-func (s *StoreImpl) StoreTask(task model.Spec) (*uuid.UUID, error) {
-	id, err := s.uuidGen.GenV4()
+// Namespace : the namespace of the tasks in the store, empty for the default namespace
+func (s *StoreImpl) Namespace() string {
+	return s.namespace
+}
+
+// ListNamespaces : the namespaces tasks have been created in, other than the default namespace
+func (s *StoreImpl) ListNamespaces() ([]string, error) {
+	namespaces, err := s.redis.SMembers(namespacesSetName).Result()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to retrieve namespaces : %s", err.Error())
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// GetTaskNamespace : the namespace the task with the given id was created in, empty for the default namespace
+func (s *StoreImpl) GetTaskNamespace(id *uuid.UUID) (string, error) {
+	namespace, err := s.redis.HGet(taskNamespacesName, id.String()).Result()
+	if err == redis.Nil {
+		return "", nil
 	}
-	task.ID = &id
-	created, err := s.redis.SetNX(buildTaskKey(&id), &task, 0).Result()
 	if err != nil {
-		return nil, fmt.Errorf("storing task with id %s failed", task.ID)
+		return "", fmt.Errorf("failed to retrieve namespace of task %s : %s", id.String(), err.Error())
 	}
-	if !created {
-		return nil, fmt.Errorf("task with id %s already exists", task.ID.String())
+	return namespace, nil
+}
+
+func (s *StoreImpl) key(name string) string {
+	if s.namespace == "" {
+		return name
 	}
-	return task.ID, nil
+	return fmt.Sprintf("%s:%s:%s", namespacePrefix, s.namespace, name)
 }
 
-// GetTask : retrieve the task with the given id
+// GetTask : retrieve the task with the given id. Returns a TaskNotFoundError if the task does not exist
+// and a CorruptTaskError if its spec cannot be read
 func (s *StoreImpl) GetTask(id *uuid.UUID) (*model.Spec, error) {
-	task, err := s.redis.Get(buildTaskKey(id)).Result()
+	task, err := s.redis.Get(s.buildTaskKey(id)).Result()
+	if err == redis.Nil {
+		return nil, &TaskNotFoundError{ID: id}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve task with id %s", id.String())
+		return nil, fmt.Errorf("failed to retrieve task with id %s : %s", id.String(), err.Error())
 	}
 
 	taskSpec := new(model.Spec)
 	if err := taskSpec.UnmarshalBinary([]byte(task)); err != nil {
-		return nil, fmt.Errorf("failed to build task with id %s from retrieved data %s", id.String(), task)
+		return nil, &CorruptTaskError{ID: id, Data: task}
 	}
 	return taskSpec, nil
 }
 
-// PushTask : push the given TaskSpec on the task queue, returning the size after the push
+// PushTask : push the given TaskSpec on the task queue, returning the size after the push.
+// Tasks are queued behind tasks of a higher or the same priority
 func (s *StoreImpl) PushTask(id *uuid.UUID) (int64, error) {
-	size, err := s.redis.LPush(taskQueueName, id.String()).Result()
+	priority, err := s.priorityOf(id)
 	if err != nil {
 		return 0, err
 	}
-	return size, nil
+
+	seq, err := s.redis.Incr(s.key(taskQueueSequenceName)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var size *redis.IntCmd
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(s.key(taskQueueName), redis.Z{Score: queueScore(priority, seq), Member: id.String()})
+		size = pipe.ZCard(s.key(taskQueueName))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size.Val(), nil
+}
+
+// ReturnTask : put a task that was taken off the task queue, but could not be dispatched,
+// back at the front of the tasks of its priority
+func (s *StoreImpl) ReturnTask(id *uuid.UUID) error {
+	priority, err := s.priorityOf(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.redis.ZAdd(s.key(taskQueueName), redis.Z{Score: queueScore(priority, 0), Member: id.String()}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to return task %s to the task queue : %s", id.String(), err.Error())
+	}
+	return nil
 }
 
-// PopTask : get the next task
+// PopTask : get the next task, the oldest of the highest priority, nil if the task queue is empty
 func (s *StoreImpl) PopTask() (*uuid.UUID, error) {
-	results, err := s.redis.BRPop(0, taskQueueName).Result()
+	results, err := s.redis.ZPopMin(s.key(taskQueueName)).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve next task to execute : %s", err.Error())
 	}
+	if len(results) == 0 {
+		return nil, nil
+	}
 
-	stringID := results[1]
+	stringID := results[0].Member.(string)
 
 	id := new(uuid.UUID)
 	_ = id.UnmarshalText([]byte(stringID))
@@ -101,37 +385,281 @@ func (s *StoreImpl) PopTask() (*uuid.UUID, error) {
 	return id, nil
 }
 
+// RemoveTaskFromQueue : remove the given task from the task queue,
+// returning false if it was not on the queue
+func (s *StoreImpl) RemoveTaskFromQueue(id *uuid.UUID) (bool, error) {
+	removed, err := s.redis.ZRem(s.key(taskQueueName), id.String()).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove task %s from task queue : %s", id.String(), err.Error())
+	}
+	return removed > 0, nil
+}
+
 // TaskQueueSize : get the size of the task queue
 func (s *StoreImpl) TaskQueueSize() (int64, error) {
-	return s.redis.LLen(taskQueueName).Result()
+	return s.redis.ZCard(s.key(taskQueueName)).Result()
+}
+
+// TaskQueueSizeForPriority : get the number of queued tasks with the given priority
+func (s *StoreImpl) TaskQueueSizeForPriority(priority int) (int64, error) {
+	lowest := queueScore(priority, 0)
+	min := strconv.FormatFloat(lowest, 'f', -1, 64)
+	max := "(" + strconv.FormatFloat(lowest+priorityScale, 'f', -1, 64)
+	return s.redis.ZCount(s.key(taskQueueName), min, max).Result()
 }
 
-// AddTaskToExecutingSet : move a task to the executing set
-func (s *StoreImpl) AddTaskToExecutingSet(id *uuid.UUID) error {
-	_, err := s.redis.SAdd(executingQueueName, id.String()).Result()
+func (s *StoreImpl) priorityOf(id *uuid.UUID) (int, error) {
+	data, err := s.redis.Get(s.buildTaskKey(id)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve priority of task with id %s : %s", id.String(), err.Error())
+	}
+
+	taskSpec := new(model.Spec)
+	if err := taskSpec.UnmarshalBinary([]byte(data)); err != nil {
+		return 0, fmt.Errorf("failed to build task with id %s from retrieved data %s", id.String(), data)
+	}
+	return taskSpec.Priority, nil
+}
+
+// AddTaskToExecutingSet : move a task to the executing set, granting it a lease that expires at the given
+// time unless it is renewed. A zero time grants a lease that never expires
+func (s *StoreImpl) AddTaskToExecutingSet(id *uuid.UUID, leaseUntil time.Time) error {
+	_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(s.key(leaseSetName), redis.Z{Score: leaseScore(leaseUntil), Member: id.String()})
+		pipe.Del(s.buildTaskLeaseKey(id), s.buildTaskProgressKey(id))
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to add task to executing set : %s", err.Error())
 	}
 	return nil
 }
 
-// RemoveTaskFromExecutingSet : remove task from the executing set
+// RemoveTaskFromExecutingSet : remove task from the executing set, along with its lease and deadline,
+// and return the resources reserved for it to the pool
 func (s *StoreImpl) RemoveTaskFromExecutingSet(id *uuid.UUID) error {
-	_, err := s.redis.SRem(executingQueueName, id.String()).Result()
+	_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZRem(s.key(leaseSetName), id.String())
+		pipe.Del(s.buildTaskLeaseKey(id))
+		pipe.ZRem(s.key(deadlineSetName), id.String())
+		releaseResourcesScript.Eval(pipe, []string{resourcesUsedName, s.buildTaskResourcesKey(id)})
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to remove task %s : %s", id.String(), err.Error())
 	}
 	return nil
 }
 
-// ExecutingSetSize : get the size of the executing set
+// ReserveResources : reserve the requested resources for the given task if they fit in what is
+// left of the given capacity, returning false if they do not. The pool is shared by every namespace,
+// and reserving again for a task that already holds its resources has no effect
+func (s *StoreImpl) ReserveResources(id *uuid.UUID, requests model.Resources, capacity model.Resources) (bool, error) {
+	args := make([]interface{}, 0, 3*len(requests))
+	for name, amount := range requests {
+		if amount > 0 {
+			args = append(args, name, amount, capacity[name])
+		}
+	}
+	if len(args) == 0 {
+		return true, nil
+	}
+
+	reserved, err := reserveResourcesScript.Run(s.redis, []string{resourcesUsedName, s.buildTaskResourcesKey(id)}, args...).Int64()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve resources for task %s : %s", id.String(), err.Error())
+	}
+	return reserved == 1, nil
+}
+
+// ReleaseResources : return the resources reserved for the given task to the pool
+func (s *StoreImpl) ReleaseResources(id *uuid.UUID) error {
+	_, err := releaseResourcesScript.Run(s.redis, []string{resourcesUsedName, s.buildTaskResourcesKey(id)}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to release resources of task %s : %s", id.String(), err.Error())
+	}
+	return nil
+}
+
+// GetResourceUsage : the amount of each resource reserved by executing tasks
+func (s *StoreImpl) GetResourceUsage() (model.Resources, error) {
+	results, err := s.redis.HGetAll(resourcesUsedName).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve resource usage : %s", err.Error())
+	}
+
+	usage := make(model.Resources, len(results))
+	for name, value := range results {
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read usage %s of resource %s", value, name)
+		}
+		usage[name] = amount
+	}
+	return usage, nil
+}
+
+// ExecutingSetSize : get the number of tasks in the executing set whose lease has not expired
 func (s *StoreImpl) ExecutingSetSize() (int64, error) {
-	return s.redis.SCard(executingQueueName).Result()
+	return s.redis.ZCount(s.key(leaseSetName), fmt.Sprintf("(%d", toMillis(time.Now())), "+inf").Result()
 }
 
-// IsTaskExecuting : true if a task is executing, false otherwise
+// IsTaskExecuting : true if a task is executing and its lease has not expired, false otherwise
 func (s *StoreImpl) IsTaskExecuting(id *uuid.UUID) (bool, error) {
-	return s.redis.SIsMember(executingQueueName, id.String()).Result()
+	expiry, err := s.redis.ZScore(s.key(leaseSetName), id.String()).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return expiry > float64(toMillis(time.Now())), nil
+}
+
+// RenewLease : extend the live lease of the given task to the given time on behalf of the given worker,
+// which becomes the lease's holder. A zero time keeps the lease's current expiry. Returns a LeaseLostError
+// if the task holds no live lease and a LeaseHeldError if another worker holds it
+func (s *StoreImpl) RenewLease(id *uuid.UUID, workerID string, until time.Time) (*model.Lease, error) {
+	expiry := ""
+	if !until.IsZero() {
+		expiry = strconv.FormatInt(toMillis(until), 10)
+	}
+
+	keys := []string{s.key(leaseSetName), s.buildTaskLeaseKey(id)}
+	renewed, err := renewLeaseScript.Run(s.redis, keys, id.String(), toMillis(time.Now()), expiry, workerID).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew lease of task %s : %s", id.String(), err.Error())
+	}
+	switch renewed {
+	case 0:
+		return nil, &LeaseLostError{ID: id}
+	case -1:
+		return nil, &LeaseHeldError{ID: id, Worker: workerID}
+	}
+	return s.GetLease(id)
+}
+
+// GetLease : the lease of the given executing task, nil if the task is not executing
+func (s *StoreImpl) GetLease(id *uuid.UUID) (*model.Lease, error) {
+	var expiry *redis.FloatCmd
+	var holder *redis.StringCmd
+	_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		expiry = pipe.ZScore(s.key(leaseSetName), id.String())
+		holder = pipe.HGet(s.buildTaskLeaseKey(id), "worker")
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to retrieve lease of task %s : %s", id.String(), err.Error())
+	}
+	if expiry.Err() == redis.Nil {
+		return nil, nil
+	}
+
+	lease := &model.Lease{TaskID: id, Worker: holder.Val()}
+	if millis := int64(expiry.Val()); millis < leaseForever {
+		expiresAt := fromMillis(millis).UTC()
+		lease.ExpiresAt = &expiresAt
+	}
+	return lease, nil
+}
+
+// PopExpiredLeases : remove and return the executing tasks whose lease has expired at the given time
+func (s *StoreImpl) PopExpiredLeases(now time.Time) ([]*uuid.UUID, error) {
+	ids, err := s.popDue(s.key(leaseSetName), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve expired leases : %s", err.Error())
+	}
+	return ids, nil
+}
+
+func leaseScore(until time.Time) float64 {
+	if until.IsZero() {
+		return leaseForever
+	}
+	return float64(toMillis(until))
+}
+
+// SetTaskDeadline : record the time by which the given executing task must complete
+func (s *StoreImpl) SetTaskDeadline(id *uuid.UUID, deadline time.Time) error {
+	member := redis.Z{Score: float64(toMillis(deadline)), Member: id.String()}
+	_, err := s.redis.ZAdd(s.key(deadlineSetName), member).Result()
+	if err != nil {
+		return fmt.Errorf("failed to set deadline for task %s : %s", id.String(), err.Error())
+	}
+	return nil
+}
+
+// PopExpiredTasks : remove and return the executing tasks whose deadline has passed at the given time
+func (s *StoreImpl) PopExpiredTasks(now time.Time) ([]*uuid.UUID, error) {
+	ids, err := s.popDue(s.key(deadlineSetName), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve expired tasks : %s", err.Error())
+	}
+	return ids, nil
+}
+
+// DelayTask : hold the given task back until the given time
+func (s *StoreImpl) DelayTask(id *uuid.UUID, until time.Time) error {
+	member := redis.Z{Score: float64(toMillis(until)), Member: id.String()}
+	_, err := s.redis.ZAdd(s.key(delayedSetName), member).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delay task %s : %s", id.String(), err.Error())
+	}
+	return nil
+}
+
+// PopDueTasks : remove and return the delayed tasks that are due at the given time
+func (s *StoreImpl) PopDueTasks(now time.Time) ([]*uuid.UUID, error) {
+	ids, err := s.popDue(s.key(delayedSetName), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve due tasks : %s", err.Error())
+	}
+	return ids, nil
+}
+
+func (s *StoreImpl) popDue(setName string, now time.Time) ([]*uuid.UUID, error) {
+	result, err := popDueScript.Run(s.redis, []string{setName}, toMillis(now)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members, _ := result.([]interface{})
+	ids := make([]*uuid.UUID, 0, len(members))
+	for _, member := range members {
+		id, err := uuid.FromString(member.(string))
+		if err != nil {
+			fmt.Printf("Dropping malformed task id %v from %s\n", member, setName)
+			continue
+		}
+		ids = append(ids, &id)
+	}
+	return ids, nil
+}
+
+// RemoveDelayedTask : remove the given task from the delayed tasks,
+// returning false if it was not delayed
+func (s *StoreImpl) RemoveDelayedTask(id *uuid.UUID) (bool, error) {
+	removed, err := s.redis.ZRem(s.key(delayedSetName), id.String()).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove delayed task %s : %s", id.String(), err.Error())
+	}
+	return removed > 0, nil
+}
+
+// GetTaskDueTime : the time the given delayed task is due, nil if it is not delayed
+func (s *StoreImpl) GetTaskDueTime(id *uuid.UUID) (*time.Time, error) {
+	score, err := s.redis.ZScore(s.key(delayedSetName), id.String()).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve due time of task %s : %s", id.String(), err.Error())
+	}
+	dueAt := fromMillis(int64(score))
+	return &dueAt, nil
 }
 
 // PublishTaskCreatedEvent : publish a task created event to the
@@ -147,17 +675,397 @@ func (s *StoreImpl) ListenForTaskCreatedEvents() <-chan *uuid.UUID {
 	return s.createCh
 }
 
-// UpdateTaskInfo : update task information
+// UpdateTaskInfo : record the result of the given task, the first result recorded is kept.
+// Updates from the worker while the task is executing are recorded with UpdateTaskProgress
 func (s *StoreImpl) UpdateTaskInfo(info *model.Info) error {
 	bytes, _ := info.MarshalBinary()
-	_, err := s.redis.SetNX(buildTaskInfoKey(info), string(bytes[:]), 0).Result()
+	_, err := s.redis.SetNX(s.buildTaskInfoKey(info.ID), string(bytes[:]), 0).Result()
 	return err
 }
 
-func buildTaskKey(id *uuid.UUID) string {
-	return fmt.Sprintf("%s:%s", taskPrefix, id.String())
+// UpdateTaskProgress : record an update from the worker executing the given task about how it is getting on.
+// Progress is kept for the current attempt only
+func (s *StoreImpl) UpdateTaskProgress(info *model.Info, at time.Time) error {
+	fields := map[string]interface{}{"updatedAt": toMillis(at)}
+	if info.Status == model.InfoStarted {
+		fields["startedAt"] = toMillis(at)
+	}
+	if info.Percent != nil {
+		fields["percent"] = strconv.FormatFloat(*info.Percent, 'f', -1, 64)
+	}
+	if info.Phase != "" {
+		fields["phase"] = info.Phase
+	}
+	if info.Message != "" {
+		fields["message"] = info.Message
+	}
+
+	_, err := s.redis.HMSet(s.buildTaskProgressKey(info.ID), fields).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record progress of task %s : %s", info.ID.String(), err.Error())
+	}
+	return nil
+}
+
+// GetTaskProgress : retrieve the latest progress of the given task, nil if its worker has sent none
+func (s *StoreImpl) GetTaskProgress(id *uuid.UUID) (*model.Progress, error) {
+	fields, err := s.redis.HGetAll(s.buildTaskProgressKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve progress of task %s : %s", id.String(), err.Error())
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	progress := &model.Progress{Phase: fields["phase"], Message: fields["message"]}
+	if updatedAt, err := strconv.ParseInt(fields["updatedAt"], 10, 64); err == nil {
+		progress.UpdatedAt = fromMillis(updatedAt).UTC()
+	}
+	if startedAt, err := strconv.ParseInt(fields["startedAt"], 10, 64); err == nil {
+		started := fromMillis(startedAt).UTC()
+		progress.StartedAt = &started
+	}
+	if percent, err := strconv.ParseFloat(fields["percent"], 64); err == nil {
+		progress.Percent = &percent
+	}
+	return progress, nil
+}
+
+// RecordTaskEvent : add an event to the end of the history of the given task
+// and announce it to the clients watching the task
+func (s *StoreImpl) RecordTaskEvent(id *uuid.UUID, event *model.Event) error {
+	data, err := event.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	key := s.buildTaskEventsKey(id)
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(key, data)
+		pipe.LTrim(key, -maxTaskEvents, -1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record event of task %s : %s", id.String(), err.Error())
+	}
+
+	status := &model.TaskStatus{TaskID: id, Namespace: s.namespace, Event: *event}
+	if taskSpec, err := s.GetTask(id); err == nil {
+		status.Metadata = taskSpec.Metadata
+	}
+	return s.feed.Publish(status)
+}
+
+// WatchTaskStatus : get a channel the statuses of the tasks of every namespace are pushed to from now on,
+// and a function that stops them. The channel is closed once they are stopped, or if the watcher falls behind
+func (s *StoreImpl) WatchTaskStatus() (<-chan *model.TaskStatus, func()) {
+	return s.feed.Subscribe()
+}
+
+// GetTaskEvents : retrieve the history of the given task, oldest event first
+func (s *StoreImpl) GetTaskEvents(id *uuid.UUID) ([]*model.Event, error) {
+	results, err := s.redis.LRange(s.buildTaskEventsKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve events of task %s : %s", id.String(), err.Error())
+	}
+
+	events := make([]*model.Event, 0, len(results))
+	for _, data := range results {
+		event := new(model.Event)
+		if err := event.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, fmt.Errorf("failed to build event of task %s from retrieved data %s", id.String(), data)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// GetTaskInfo : retrieve the result of the given task, nil if it has not completed
+func (s *StoreImpl) GetTaskInfo(id *uuid.UUID) (*model.Info, error) {
+	data, err := s.redis.Get(s.buildTaskInfoKey(id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve info of task with id %s : %s", id.String(), err.Error())
+	}
+
+	info := new(model.Info)
+	if err := info.UnmarshalBinary([]byte(data)); err != nil {
+		return nil, fmt.Errorf("failed to build info of task with id %s from retrieved data %s", id.String(), data)
+	}
+	return info, nil
+}
+
+// RecordTaskAttempt : append the result of a failed attempt to the task's attempt
+// history, returning the number of attempts recorded so far
+func (s *StoreImpl) RecordTaskAttempt(info *model.Info) (int64, error) {
+	attempts, err := s.redis.RPush(s.buildTaskAttemptsKey(info.ID), info).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record attempt for task %s : %s", info.ID.String(), err.Error())
+	}
+	return attempts, nil
+}
+
+// GetTaskAttempts : retrieve the results of the task's failed attempts, oldest first
+func (s *StoreImpl) GetTaskAttempts(id *uuid.UUID) ([]*model.Info, error) {
+	results, err := s.redis.LRange(s.buildTaskAttemptsKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve attempts for task %s : %s", id.String(), err.Error())
+	}
+
+	attempts := make([]*model.Info, 0, len(results))
+	for _, result := range results {
+		info := new(model.Info)
+		if err := info.UnmarshalBinary([]byte(result)); err != nil {
+			return nil, fmt.Errorf("failed to build attempt for task %s from retrieved data %s", id.String(), result)
+		}
+		attempts = append(attempts, info)
+	}
+	return attempts, nil
+}
+
+// GetTaskState : retrieve the lifecycle state of the task with the given id
+func (s *StoreImpl) GetTaskState(id *uuid.UUID) (model.State, error) {
+	state, err := s.redis.Get(s.buildTaskStateKey(id)).Result()
+	if err == redis.Nil {
+		return "", fmt.Errorf("no state found for task with id %s", id.String())
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve state of task with id %s : %s", id.String(), err.Error())
+	}
+	return model.State(state), nil
+}
+
+// TransitionTask : move the task with the given id to the given state,
+// an InvalidTransitionError is returned if the move is not allowed
+func (s *StoreImpl) TransitionTask(id *uuid.UUID, to model.State) error {
+	return s.transitionTask(id, to, func(model.State) bool { return true })
+}
+
+// TransitionTaskFrom : move the task with the given id to the given state only
+// if it is currently in the from state, an InvalidTransitionError is returned otherwise
+func (s *StoreImpl) TransitionTaskFrom(id *uuid.UUID, from model.State, to model.State) error {
+	return s.transitionTask(id, to, func(current model.State) bool { return current == from })
+}
+
+func (s *StoreImpl) transitionTask(id *uuid.UUID, to model.State, expected func(model.State) bool) error {
+	key := s.buildTaskStateKey(id)
+	transition := func(tx *redis.Tx) error {
+		current, err := tx.Get(key).Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to retrieve state of task with id %s : %s", id.String(), err.Error())
+		}
+		from := model.State(current)
+		if !expected(from) || !from.CanTransitionTo(to) {
+			return &InvalidTransitionError{ID: id, From: from, To: to}
+		}
+		created, err := tx.ZScore(s.key(createdIndexName), id.String()).Result()
+		indexed := err == nil
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to retrieve creation time of task with id %s : %s", id.String(), err.Error())
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, string(to), 0)
+			if indexed && from != "" {
+				pipe.ZRem(s.buildStateIndexKey(from), id.String())
+			}
+			if indexed {
+				pipe.ZAdd(s.buildStateIndexKey(to), redis.Z{Score: created, Member: id.String()})
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTransitionAttempts; i++ {
+		err := s.redis.Watch(transition, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to transition task %s to %q : state changed concurrently", id.String(), to)
+}
+
+// ResolveTaskDependency : mark the given parent of a task as no longer pending,
+// returning the number of the task's parents that are still pending
+func (s *StoreImpl) ResolveTaskDependency(id *uuid.UUID, parent *uuid.UUID) (int64, error) {
+	var remaining *redis.IntCmd
+	_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SRem(s.buildTaskParentsKey(id), parent.String())
+		remaining = pipe.SCard(s.buildTaskParentsKey(id))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve dependency of task %s on %s : %s", id.String(), parent.String(), err.Error())
+	}
+	return remaining.Val(), nil
+}
+
+// GetPendingDependencies : retrieve the parents of the given task that have not yet been resolved
+func (s *StoreImpl) GetPendingDependencies(id *uuid.UUID) ([]*uuid.UUID, error) {
+	return s.members(s.buildTaskParentsKey(id))
+}
+
+// GetTaskChildren : retrieve the tasks that depend on the given task
+func (s *StoreImpl) GetTaskChildren(id *uuid.UUID) ([]*uuid.UUID, error) {
+	return s.members(s.buildTaskChildrenKey(id))
+}
+
+func (s *StoreImpl) members(setName string) ([]*uuid.UUID, error) {
+	members, err := s.redis.SMembers(setName).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve members of %s : %s", setName, err.Error())
+	}
+	return parseTaskIDs(members, setName), nil
+}
+
+func parseTaskIDs(members []string, source string) []*uuid.UUID {
+	ids := make([]*uuid.UUID, 0, len(members))
+	for _, member := range members {
+		id, err := uuid.FromString(member)
+		if err != nil {
+			fmt.Printf("Dropping malformed task id %v from %s\n", member, source)
+			continue
+		}
+		ids = append(ids, &id)
+	}
+	return ids
+}
+
+// ReserveIdempotencyKey : claim the given key for a creation request while it is being handled, until
+// the key is bound or released or idempotencyReservationTTL passes. If the key is already claimed false
+// is returned along with the task created under it, which is nil while the request that claimed it is
+// still being handled
+func (s *StoreImpl) ReserveIdempotencyKey(key string) (bool, *uuid.UUID, error) {
+	reserved, err := s.redis.SetNX(s.buildIdempotencyKey(key), "", idempotencyReservationTTL).Result()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to reserve idempotency key %q : %s", key, err.Error())
+	}
+	if reserved {
+		return true, nil, nil
+	}
+
+	original, err := s.redis.Get(s.buildIdempotencyKey(key)).Result()
+	if err != nil && err != redis.Nil {
+		return false, nil, fmt.Errorf("failed to retrieve task for idempotency key %q : %s", key, err.Error())
+	}
+	if original == "" {
+		return false, nil, nil
+	}
+	id, err := uuid.FromString(original)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to build id from %s stored for idempotency key %q", original, key)
+	}
+	return false, &id, nil
+}
+
+// BindIdempotencyKey : record the task created under the given reserved key, remembering it for the given window
+func (s *StoreImpl) BindIdempotencyKey(key string, id *uuid.UUID, window time.Duration) error {
+	_, err := s.redis.Set(s.buildIdempotencyKey(key), id.String(), window).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record task %s for idempotency key %q : %s", id.String(), key, err.Error())
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey : give up the given reserved key so that the request can be retried
+func (s *StoreImpl) ReleaseIdempotencyKey(key string) error {
+	_, err := s.redis.Del(s.buildIdempotencyKey(key)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key %q : %s", key, err.Error())
+	}
+	return nil
+}
+
+// RecordMergedCaller : record a request that was merged into the given task
+func (s *StoreImpl) RecordMergedCaller(id *uuid.UUID, caller *model.MergedCaller) error {
+	_, err := s.redis.RPush(s.buildTaskMergedKey(id), caller).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record merged caller for task %s : %s", id.String(), err.Error())
+	}
+	return nil
+}
+
+// GetMergedCallers : retrieve the requests merged into the given task, oldest first
+func (s *StoreImpl) GetMergedCallers(id *uuid.UUID) ([]*model.MergedCaller, error) {
+	results, err := s.redis.LRange(s.buildTaskMergedKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve merged callers for task %s : %s", id.String(), err.Error())
+	}
+
+	callers := make([]*model.MergedCaller, 0, len(results))
+	for _, result := range results {
+		caller := new(model.MergedCaller)
+		if err := caller.UnmarshalBinary([]byte(result)); err != nil {
+			return nil, fmt.Errorf("failed to build merged caller for task %s from retrieved data %s", id.String(), result)
+		}
+		callers = append(callers, caller)
+	}
+	return callers, nil
+}
+
+func (s *StoreImpl) buildDedupeKey(hash string) string {
+	return s.key(fmt.Sprintf("%s:%s", dedupePrefix, hash))
+}
+
+func (s *StoreImpl) buildTaskMergedKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), mergedPostFix))
+}
+
+func (s *StoreImpl) buildIdempotencyKey(key string) string {
+	return s.key(fmt.Sprintf("%s:%s", idempotencyPrefix, key))
+}
+
+func (s *StoreImpl) buildTaskEventsKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), eventsPostFix))
+}
+
+func (s *StoreImpl) buildTaskProgressKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), progressPostFix))
+}
+
+func (s *StoreImpl) buildTaskLeaseKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), leasePostFix))
+}
+
+func (s *StoreImpl) buildTaskKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s", taskPrefix, id.String()))
+}
+
+func (s *StoreImpl) buildTaskStateKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), statePostFix))
+}
+
+func (s *StoreImpl) buildTaskInfoKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), infoPostFix))
+}
+
+func (s *StoreImpl) buildTaskAttemptsKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), attemptsPostFix))
+}
+
+func (s *StoreImpl) buildTaskChildrenKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), childrenPostFix))
+}
+
+func (s *StoreImpl) buildTaskResourcesKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), resourcesPostFix))
+}
+
+func (s *StoreImpl) buildTaskParentsKey(id *uuid.UUID) string {
+	return s.key(fmt.Sprintf("%s:%s:%s", taskPrefix, id.String(), parentsPostFix))
+}
+
+// queueScore : the score of a task in the task queue, lower scores are popped first
+func queueScore(priority int, seq int64) float64 {
+	return float64(-priority)*priorityScale + float64(seq)
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
 }
 
-func buildTaskInfoKey(info *model.Info) string {
-	return fmt.Sprintf("%s:%s:%s", taskPrefix, info.ID.String(), infoPostFix)
+func fromMillis(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/execd/task-store/pkg/model"
 	"github.com/execd/task-store/pkg/redis"
 	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	goredis "github.com/go-redis/redis"
 	. "github.com/onsi/ginkgo"
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
@@ -95,307 +97,1720 @@ var _ = Describe("store", func() {
 			assert.Equal(context, &givenId, id)
 		})
 
+		It("should return nil if the queue is empty", func() {
+			// Act
+			id, err := taskStore.PopTask()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Nil(context, id)
+		})
+
+		It("should return the oldest task first", func() {
+			// Arrange
+			first := uuid.Must(uuid.NewV4())
+			second := uuid.Must(uuid.NewV4())
+			_, err := taskStore.PushTask(&first)
+			failOnError(err)
+			_, err = taskStore.PushTask(&second)
+			failOnError(err)
+
+			// Act
+			id, err := taskStore.PopTask()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, &first, id)
+		})
+
+		It("should return the highest priority task first", func() {
+			// Arrange
+			uuidGenMock.ExpectedCalls = nil
+			lowID := uuid.Must(uuid.NewV4())
+			highID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(lowID, nil).Once()
+			uuidGenMock.On("GenV4").Return(highID, nil).Once()
+			givenTaskSpec.Priority = -5
+			_, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+			givenTaskSpec.Priority = 5
+			_, err = storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+
+			// Act
+			first, err := taskStore.PopTask()
+			failOnError(err)
+			second, err := taskStore.PopTask()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, &highID, first)
+			assert.Equal(context, &lowID, second)
+		})
+
 		It("should return an error if popping task fails", func() {
 			// Arrange
 			directRedis.Close()
 
 			// Act
-			_, err := taskStore.PopTask()
+			_, err := taskStore.PopTask()
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to retrieve next task to execute :")
+		})
+	})
+
+	Describe("removing a task from the queue", func() {
+		It("should remove the task and report it was queued", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			_, err := taskStore.PushTask(&givenID)
+			failOnError(err)
+
+			// Act
+			removed, err := taskStore.RemoveTaskFromQueue(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, removed)
+			size, err := taskStore.TaskQueueSize()
+			assert.Nil(context, err)
+			assert.Equal(context, int64(0), size)
+		})
+
+		It("should report the task was not queued", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			removed, err := taskStore.RemoveTaskFromQueue(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.False(context, removed)
+		})
+
+		It("should return error if removing fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := taskStore.RemoveTaskFromQueue(&givenID)
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to remove task")
+		})
+	})
+
+	Describe("adding a task to executing set", func() {
+
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should return error if adding fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenId := uuid.Must(uuid.NewV4())
+
+			// Act
+
+			err := taskStore.AddTaskToExecutingSet(&givenId, time.Time{})
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to add task to executing set")
+		})
+	})
+
+	Describe("creating a task", func() {
+		It("should store the task and queue it", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+
+			// Act
+			created, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, &givenID, created.ID)
+			assert.Equal(context, model.StateQueued, created.State)
+			assert.Equal(context, int64(1), created.QueueSize)
+			stored, err := taskStore.GetTask(&givenID)
+			failOnError(err)
+			assert.Equal(context, &givenID, stored.ID)
+			state, err := taskStore.GetTaskState(&givenID)
+			failOnError(err)
+			assert.Equal(context, model.StateQueued, state)
+			popped, err := taskStore.PopTask()
+			failOnError(err)
+			assert.Equal(context, &givenID, popped)
+		})
+
+		It("should delay a task that is not yet due", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+			now := time.Now()
+			later := now.Add(time.Hour)
+			givenTaskSpec.RunAt = &later
+
+			// Act
+			created, err := taskStore.CreateTask(givenTaskSpec, 10, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateDelayed, created.State)
+			assert.Equal(context, int64(0), created.QueueSize)
+			state, err := taskStore.GetTaskState(&givenID)
+			failOnError(err)
+			assert.Equal(context, model.StateDelayed, state)
+			dueAt, err := taskStore.GetTaskDueTime(&givenID)
+			failOnError(err)
+			assert.WithinDuration(context, later, *dueAt, time.Millisecond)
+		})
+
+		It("should not store the task if the task queue is full", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+			queuedID := uuid.Must(uuid.NewV4())
+			_, err := taskStore.PushTask(&queuedID)
+			failOnError(err)
+
+			// Act
+			_, err = taskStore.CreateTask(givenTaskSpec, 1, time.Now())
+
+			// Assert
+			assert.IsType(context, &task.TaskQueueFullError{}, err)
+			assert.False(context, directRedis.Exists("task:"+givenID.String()))
+		})
+
+		It("should return error if creating the task fails", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			directRedis.Close()
+
+			// Act
+			_, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+
+		It("should return error if a task with the id already exists", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+			_, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+			failOnError(err)
+
+			// Act
+			_, err = taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Equal(context, fmt.Sprintf("task with id %s already exists", &givenID), err.Error())
+		})
+
+		It("should block a task until the tasks it depends on have succeeded", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+			parent := uuid.Must(uuid.NewV4())
+			directRedis.Set("task:"+parent.String()+":state", string(model.StateRunning))
+			givenTaskSpec.DependsOn = []uuid.UUID{parent}
+
+			// Act
+			created, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateBlocked, created.State)
+			assert.Equal(context, int64(0), created.QueueSize)
+			parents, err := directRedis.Members("task:" + givenID.String() + ":parents")
+			failOnError(err)
+			assert.Equal(context, []string{parent.String()}, parents)
+			children, err := taskStore.GetTaskChildren(&parent)
+			failOnError(err)
+			assert.Equal(context, []*uuid.UUID{&givenID}, children)
+		})
+
+		It("should skip a task that depends on a task that did not succeed", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			parent := uuid.Must(uuid.NewV4())
+			directRedis.Set("task:"+parent.String()+":state", string(model.StateFailed))
+			givenTaskSpec.DependsOn = []uuid.UUID{parent}
+
+			// Act
+			created, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateSkipped, created.State)
+		})
+
+		It("should merge a duplicate into the identical task that has not completed", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			duplicateID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil).Once()
+			uuidGenMock.On("GenV4").Return(duplicateID, nil).Once()
+			givenTaskSpec.Dedupe = &model.Dedupe{}
+			_, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+			failOnError(err)
+
+			// Act
+			created, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, created.Merged)
+			assert.Equal(context, &givenID, created.ID)
+			assert.False(context, directRedis.Exists("task:"+duplicateID.String()))
+			size, err := taskStore.TaskQueueSize()
+			failOnError(err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should not merge a duplicate into an identical task that has completed", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			duplicateID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil).Once()
+			uuidGenMock.On("GenV4").Return(duplicateID, nil).Once()
+			givenTaskSpec.Dedupe = &model.Dedupe{}
+			_, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+			failOnError(err)
+			directRedis.Set("task:"+givenID.String()+":state", string(model.StateSucceeded))
+
+			// Act
+			created, err := taskStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.False(context, created.Merged)
+			assert.Equal(context, &duplicateID, created.ID)
+		})
+	})
+
+	Describe("creating tasks together", func() {
+		It("should create every task, keeping the ids they were given", func() {
+			// Arrange
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := uuid.Must(uuid.NewV4())
+			second := givenTaskSpec
+			second.ID = &secondID
+			second.DependsOn = []uuid.UUID{firstID}
+			first := givenTaskSpec
+			first.ID = &firstID
+
+			// Act
+			created, err := taskStore.CreateTasks([]model.Spec{first, second}, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, &firstID, created[0].ID)
+			assert.Equal(context, model.StateQueued, created[0].State)
+			assert.Equal(context, &secondID, created[1].ID)
+			assert.Equal(context, model.StateBlocked, created[1].State)
+		})
+
+		It("should merge a duplicate into the identical task created before it in the same call", func() {
+			// Arrange
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := uuid.Must(uuid.NewV4())
+			givenTaskSpec.Dedupe = &model.Dedupe{}
+			first := givenTaskSpec
+			first.ID = &firstID
+			second := givenTaskSpec
+			second.ID = &secondID
+
+			// Act
+			created, err := taskStore.CreateTasks([]model.Spec{first, second}, 1, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.False(context, created[0].Merged)
+			assert.True(context, created[1].Merged)
+			assert.Equal(context, &firstID, created[1].ID)
+			assert.False(context, directRedis.Exists("task:"+secondID.String()))
+			owner, err := directRedis.Get("dedupe:" + givenTaskSpec.DedupeHash())
+			failOnError(err)
+			assert.Equal(context, firstID.String(), owner)
+		})
+
+		It("should create none of the tasks if the task queue does not have room for every one", func() {
+			// Arrange
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := uuid.Must(uuid.NewV4())
+			first := givenTaskSpec
+			first.ID = &firstID
+			second := givenTaskSpec
+			second.ID = &secondID
+
+			// Act
+			_, err := taskStore.CreateTasks([]model.Spec{first, second}, 1, time.Now())
+
+			// Assert
+			assert.IsType(context, &task.TaskQueueFullError{}, err)
+			assert.False(context, directRedis.Exists("task:"+firstID.String()))
+			assert.False(context, directRedis.Exists("task:"+secondID.String()))
+		})
+
+		It("should refuse every task created once the task queue is at its capacity", func() {
+			// Arrange
+			var refusedIDs []*uuid.UUID
+
+			// Act
+			// miniredis releases its lock while a script runs, so concurrent callers cannot be tested against it,
+			// the test below checks the tasks are written by the one script that Redis runs atomically instead
+			for i := 0; i < 20; i++ {
+				id := uuid.Must(uuid.NewV4())
+				spec := givenTaskSpec
+				spec.ID = &id
+				_, err := taskStore.CreateTasks([]model.Spec{spec}, 5, time.Now())
+				if _, full := err.(*task.TaskQueueFullError); full {
+					refusedIDs = append(refusedIDs, &id)
+				}
+			}
+
+			// Assert
+			assert.Len(context, refusedIDs, 15)
+			for _, id := range refusedIDs {
+				assert.False(context, directRedis.Exists("task:"+id.String()))
+			}
+			size, err := taskStore.TaskQueueSize()
+			failOnError(err)
+			assert.Equal(context, int64(5), size)
+		})
+
+		It("should write the tasks with nothing but the creation script once the queue sequence is reserved and dedupe keys read", func() {
+			// Arrange
+			client := redis.NewClient(directRedis.Addr())
+			var commands []string
+			client.WrapProcess(func(process func(cmd goredis.Cmder) error) func(cmd goredis.Cmder) error {
+				return func(cmd goredis.Cmder) error {
+					commands = append(commands, cmd.Name())
+					return process(cmd)
+				}
+			})
+			store := task.NewStoreImpl(client, util.NewUUIDGenImpl())
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := store.CreateTasks([]model.Spec{{ID: &firstID, Image: "alpine"}, {ID: &secondID, Image: "alpine",
+				DependsOn: []uuid.UUID{firstID}, Dedupe: &model.Dedupe{}}}, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			var others []string
+			for _, command := range commands {
+				if command != "evalsha" && command != "eval" {
+					others = append(others, command)
+				}
+			}
+			assert.Equal(context, []string{"incrby", "mget"}, others)
+		})
+
+		It("should merge a duplicate into the task its dedupe key names once the key changes under it", func() {
+			// Arrange
+			ownerID := uuid.Must(uuid.NewV4())
+			directRedis.Set("task:"+ownerID.String()+":state", string(model.StateRunning))
+			givenTaskSpec.Dedupe = &model.Dedupe{}
+			dedupeKey := "dedupe:" + givenTaskSpec.DedupeHash()
+			client := redis.NewClient(directRedis.Addr())
+			client.WrapProcess(func(process func(cmd goredis.Cmder) error) func(cmd goredis.Cmder) error {
+				return func(cmd goredis.Cmder) error {
+					err := process(cmd)
+					if cmd.Name() == "mget" && !directRedis.Exists(dedupeKey) {
+						directRedis.Set(dedupeKey, ownerID.String())
+					}
+					return err
+				}
+			})
+			store := task.NewStoreImpl(client, util.NewUUIDGenImpl())
+
+			// Act
+			created, err := store.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, created.Merged)
+			assert.Equal(context, &ownerID, created.ID)
+		})
+	})
+
+	Describe("namespaces", func() {
+		It("should keep the tasks and queues of a namespace apart from the default namespace", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+			namespaceStore := taskStore.InNamespace("team-a")
+
+			// Act
+			_, err := namespaceStore.CreateTask(givenTaskSpec, 10, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, "team-a", namespaceStore.Namespace())
+			assert.True(context, directRedis.Exists("namespace:team-a:task:"+givenID.String()))
+			_, err = taskStore.GetTask(&givenID)
+			assert.NotNil(context, err)
+			size, err := taskStore.TaskQueueSize()
+			failOnError(err)
+			assert.Equal(context, int64(0), size)
+			size, err = namespaceStore.TaskQueueSize()
+			failOnError(err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should record the namespaces tasks were created in", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			otherID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil).Once()
+			uuidGenMock.On("GenV4").Return(otherID, nil).Once()
+			_, err := storeTask(taskStore.InNamespace("team-b"), givenTaskSpec)
+			failOnError(err)
+			_, err = storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+
+			// Act
+			namespaces, err := taskStore.ListNamespaces()
+			failOnError(err)
+			namespace, err := taskStore.GetTaskNamespace(&givenID)
+			failOnError(err)
+			defaultNamespace, err := taskStore.GetTaskNamespace(&otherID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, []string{"team-b"}, namespaces)
+			assert.Equal(context, "team-b", namespace)
+			assert.Equal(context, "", defaultNamespace)
+		})
+
+		It("should not record the namespace of a task refused for a full task queue", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+			namespaceStore := taskStore.InNamespace("team-c")
+
+			// Act
+			_, err := namespaceStore.CreateTask(givenTaskSpec, 0, time.Now())
+
+			// Assert
+			assert.IsType(context, &task.TaskQueueFullError{}, err)
+			namespaces, err := taskStore.ListNamespaces()
+			failOnError(err)
+			assert.Empty(context, namespaces)
+			assert.False(context, directRedis.Exists("namespaces:tasks"))
+		})
+	})
+
+	Describe("storing a batch of tasks", func() {
+		It("should store and queue every task, delaying the ones that are not due", func() {
+			// Arrange
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(firstID, nil).Once()
+			uuidGenMock.On("GenV4").Return(secondID, nil).Once()
+			now := time.Now()
+			later := now.Add(time.Hour)
+			delayedSpec := givenTaskSpec
+			delayedSpec.RunAt = &later
+
+			// Act
+			ids, err := taskStore.StoreTaskBatch([]model.Spec{givenTaskSpec, delayedSpec}, 10, now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, []*uuid.UUID{&firstID, &secondID}, ids)
+			stored, err := taskStore.GetTask(&firstID)
+			failOnError(err)
+			assert.Equal(context, "alpine", stored.Image)
+			state, err := taskStore.GetTaskState(&firstID)
+			failOnError(err)
+			assert.Equal(context, model.StateQueued, state)
+			state, err = taskStore.GetTaskState(&secondID)
+			failOnError(err)
+			assert.Equal(context, model.StateDelayed, state)
+			popped, err := taskStore.PopTask()
+			failOnError(err)
+			assert.Equal(context, &firstID, popped)
+			size, err := taskStore.TaskQueueSize()
+			failOnError(err)
+			assert.Equal(context, int64(0), size)
+		})
+
+		It("should queue the tasks of a batch in priority order, then in the order given", func() {
+			// Arrange
+			ids := []uuid.UUID{uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())}
+			for _, id := range ids {
+				uuidGenMock.On("GenV4").Return(id, nil).Once()
+			}
+			urgentSpec := givenTaskSpec
+			urgentSpec.Priority = 5
+
+			// Act
+			_, err := taskStore.StoreTaskBatch([]model.Spec{givenTaskSpec, givenTaskSpec, urgentSpec}, 10, time.Now())
+			failOnError(err)
+
+			// Assert
+			for _, expected := range []uuid.UUID{ids[2], ids[0], ids[1]} {
+				popped, err := taskStore.PopTask()
+				failOnError(err)
+				assert.Equal(context, expected, *popped)
+			}
+		})
+
+		It("should return error if storing the batch fails", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			directRedis.Close()
+
+			// Act
+			_, err := taskStore.StoreTaskBatch([]model.Spec{givenTaskSpec}, 10, time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+
+		It("should store as many tasks as the task queue has room for", func() {
+			// Arrange
+			firstID := uuid.Must(uuid.NewV4())
+			secondID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(firstID, nil).Once()
+			uuidGenMock.On("GenV4").Return(secondID, nil).Once()
+
+			// Act
+			ids, err := taskStore.StoreTaskBatch([]model.Spec{givenTaskSpec, givenTaskSpec}, 1, time.Now())
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, []*uuid.UUID{&firstID, nil}, ids)
+			assert.False(context, directRedis.Exists("task:"+secondID.String()))
+			size, err := taskStore.TaskQueueSize()
+			failOnError(err)
+			assert.Equal(context, int64(1), size)
+		})
+	})
+
+	Describe("retrieving  a task", func() {
+
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should return the task related to the given id", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+
+			// Act
+			task, err := taskStore.GetTask(id)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, id, task.ID)
+			assert.Equal(context, givenTaskSpec.Init, task.Init)
+			assert.Equal(context, givenTaskSpec.InitArgs, task.InitArgs)
+			assert.Equal(context, givenTaskSpec.Image, task.Image)
+		})
+
+		It("should return an error if task with given id does not exist", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := taskStore.GetTask(&givenID)
+
+			// Assert
+			assert.IsType(context, &task.TaskNotFoundError{}, err)
+			assert.Equal(context, fmt.Sprintf("failed to retrieve task with id %s", givenID.String()), err.Error())
+		})
+
+		It("should return an error if retrieved task fails to be re-constructed", func() {
+			// Arrange
+			badData := "test"
+			id, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+			directRedis.Set("task:"+id.String(), badData)
+
+			// Act
+			_, err = taskStore.GetTask(id)
+
+			// Assert
+			assert.IsType(context, &task.CorruptTaskError{}, err)
+			assert.Equal(context,
+				fmt.Sprintf("failed to build task with id %s from retrieved data %s", id.String(), badData),
+				err.Error())
+		})
+	})
+
+	Describe("publishing and listening for a task created event", func() {
+
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should receive published task", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+			timeout := time.After(time.Second)
+
+			// Act
+			go func() {
+				taskStore.PublishTaskCreatedEvent(&id)
+			}()
+
+			// Assert
+			select {
+			case actualId := <-taskStore.ListenForTaskCreatedEvents():
+				assert.Equal(context, actualId, &id)
+			case <-timeout:
+				assert.Fail(context, "Timed out waiting for channel to close, or error to be received")
+			}
+		})
+	})
+
+	Describe("remove task from executing set", func() {
+
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should return error if remove fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			err := taskStore.RemoveTaskFromExecutingSet(&givenID)
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to remove task")
+		})
+	})
+
+	Describe("is task executing", func() {
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should be true if task is executing", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			assert.Nil(context, err)
+			taskStore.AddTaskToExecutingSet(id, time.Time{})
+
+			// Act
+			executing, err := taskStore.IsTaskExecuting(id)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, executing)
+		})
+
+		It("should return false if task is not executing", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			executing, err := taskStore.IsTaskExecuting(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.False(context, executing)
+		})
+
+		It("should return error if check for executing fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := taskStore.IsTaskExecuting(&givenID)
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("update task info", func() {
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should return error if updating info fails", func() {
+			// Arrange
+			directRedis.Close()
+			id := uuid.Must(uuid.NewV4())
+			info := &model.Info{
+				ID: &id,
+			}
+
+			// Act
+			err := taskStore.UpdateTaskInfo(info)
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+
+		It("should read back the stored info", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+			process := model.FailureStatus{Type: "process", Name: "cc1", Message: "killed"}
+			container := model.FailureStatus{Type: "container", Name: "compile", Reason: "OOMKilled", ChildStatus: []model.FailureStatus{process}}
+			info := &model.Info{
+				ID:           &id,
+				FailureStats: &model.FailureStatus{Type: "pod", Name: "build", Reason: "OOMKilled", ChildStatus: []model.FailureStatus{container}},
+			}
+			err := taskStore.UpdateTaskInfo(info)
+			failOnError(err)
+
+			// Act
+			stored, err := taskStore.GetTaskInfo(&id)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, info, stored)
+		})
+
+		It("should return nil if the task has no info", func() {
+			// Arrange
+			id := uuid.Must(uuid.NewV4())
+
+			// Act
+			stored, err := taskStore.GetTaskInfo(&id)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Nil(context, stored)
+		})
+	})
+
+	Describe("task state", func() {
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should be queued once the task is stored", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+
+			// Act
+			state, err := taskStore.GetTaskState(id)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateQueued, state)
+		})
+
+		It("should move the task to the given state if the transition is allowed", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+
+			// Act
+			err = taskStore.TransitionTask(id, model.StateScheduled)
+
+			// Assert
+			assert.Nil(context, err)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateScheduled, state)
+		})
+
+		It("should return an invalid transition error if the transition is not allowed", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+			failOnError(taskStore.TransitionTask(id, model.StateCancelled))
+
+			// Act
+			err = taskStore.TransitionTask(id, model.StateScheduled)
+
+			// Assert
+			transitionErr, ok := err.(*task.InvalidTransitionError)
+			assert.True(context, ok)
+			assert.Equal(context, model.StateCancelled, transitionErr.From)
+			assert.Equal(context, model.StateScheduled, transitionErr.To)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateCancelled, state)
+		})
+
+		It("should only move the task if it is in the expected state", func() {
+			// Arrange
+			id, err := storeTask(taskStore, givenTaskSpec)
+			failOnError(err)
+			failOnError(taskStore.TransitionTask(id, model.StateScheduled))
+
+			// Act
+			err = taskStore.TransitionTaskFrom(id, model.StateQueued, model.StateCancelled)
+
+			// Assert
+			transitionErr, ok := err.(*task.InvalidTransitionError)
+			assert.True(context, ok)
+			assert.Equal(context, model.StateScheduled, transitionErr.From)
+			state, err := taskStore.GetTaskState(id)
+			assert.Nil(context, err)
+			assert.Equal(context, model.StateScheduled, state)
+		})
+
+		It("should return an invalid transition error if the task does not exist", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			err := taskStore.TransitionTask(&givenID, model.StateRunning)
+
+			// Assert
+			_, ok := err.(*task.InvalidTransitionError)
+			assert.True(context, ok)
+		})
+
+		It("should return error if the task has no state", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := taskStore.GetTaskState(&givenID)
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Equal(context, fmt.Sprintf("no state found for task with id %s", givenID.String()), err.Error())
+		})
+
+		It("should return error if retrieving the state fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := taskStore.GetTaskState(&givenID)
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to retrieve state of task")
+		})
+	})
+
+	Describe("task deadlines", func() {
+		It("should only return the task once its deadline has passed", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			now := time.Now()
+			failOnError(taskStore.SetTaskDeadline(&givenID, now.Add(time.Minute)))
+
+			// Act
+			early, err := taskStore.PopExpiredTasks(now)
+			failOnError(err)
+			expired, err := taskStore.PopExpiredTasks(now.Add(time.Minute))
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Empty(context, early)
+			assert.Equal(context, []*uuid.UUID{&givenID}, expired)
+		})
+
+		It("should clear the deadline when the task leaves the executing set", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			now := time.Now()
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Time{}))
+			failOnError(taskStore.SetTaskDeadline(&givenID, now))
+
+			// Act
+			err := taskStore.RemoveTaskFromExecutingSet(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			expired, err := taskStore.PopExpiredTasks(now)
+			assert.Nil(context, err)
+			assert.Empty(context, expired)
+		})
+
+		It("should return error if setting the deadline fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			err := taskStore.SetTaskDeadline(&givenID, time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to set deadline")
+		})
+
+		It("should return error if retrieving expired tasks fails", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			_, err := taskStore.PopExpiredTasks(time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to retrieve expired tasks")
+		})
+	})
+
+	Describe("delaying a task", func() {
+		It("should only return the task once it is due", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			now := time.Now()
+			failOnError(taskStore.DelayTask(&givenID, now.Add(time.Minute)))
+
+			// Act
+			early, err := taskStore.PopDueTasks(now)
+			failOnError(err)
+			due, err := taskStore.PopDueTasks(now.Add(time.Minute))
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Empty(context, early)
+			assert.Equal(context, []*uuid.UUID{&givenID}, due)
+		})
+
+		It("should not return a due task twice", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			now := time.Now()
+			failOnError(taskStore.DelayTask(&givenID, now))
+			_, err := taskStore.PopDueTasks(now)
+			failOnError(err)
+
+			// Act
+			due, err := taskStore.PopDueTasks(now)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Empty(context, due)
+		})
+
+		It("should remove a delayed task", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			now := time.Now()
+			failOnError(taskStore.DelayTask(&givenID, now))
+
+			// Act
+			removed, err := taskStore.RemoveDelayedTask(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, removed)
+			due, err := taskStore.PopDueTasks(now)
+			assert.Nil(context, err)
+			assert.Empty(context, due)
+		})
+
+		It("should return the time a delayed task is due", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			dueAt := time.Now().Add(time.Minute)
+			failOnError(taskStore.DelayTask(&givenID, dueAt))
+
+			// Act
+			actual, err := taskStore.GetTaskDueTime(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.WithinDuration(context, dueAt, *actual, time.Millisecond)
+		})
+
+		It("should return no due time if the task is not delayed", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			actual, err := taskStore.GetTaskDueTime(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Nil(context, actual)
+		})
+
+		It("should return error if delaying fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			err := taskStore.DelayTask(&givenID, time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to delay task")
+		})
+
+		It("should return error if retrieving due tasks fails", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			_, err := taskStore.PopDueTasks(time.Now())
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to retrieve due tasks")
+		})
+	})
+
+	Describe("task attempts", func() {
+		It("should return the recorded attempts in order", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			first := &model.Info{ID: &givenID, FailureStats: &model.FailureStatus{Type: "pod", Name: "first"}}
+			second := &model.Info{ID: &givenID, FailureStats: &model.FailureStatus{Type: "pod", Name: "second"}}
+			_, err := taskStore.RecordTaskAttempt(first)
+			failOnError(err)
+
+			// Act
+			count, err := taskStore.RecordTaskAttempt(second)
+			failOnError(err)
+			attempts, err := taskStore.GetTaskAttempts(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, int64(2), count)
+			assert.Equal(context, []*model.Info{first, second}, attempts)
+		})
+
+		It("should return error if recording an attempt fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			_, err := taskStore.RecordTaskAttempt(&model.Info{ID: &givenID})
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to record attempt")
+		})
+	})
+
+	Describe("task events", func() {
+		It("should return the recorded events in order", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			at := time.Now().UTC().Truncate(time.Millisecond)
+			created := &model.Event{Type: model.EventCreated, At: at, Source: model.SourceAPI, State: model.StateQueued}
+			dispatched := &model.Event{Type: model.EventDispatched, At: at.Add(time.Second), Source: model.SourceManager, State: model.StateScheduled}
+			failOnError(taskStore.RecordTaskEvent(&givenID, created))
+
+			// Act
+			err := taskStore.RecordTaskEvent(&givenID, dispatched)
+			failOnError(err)
+			events, err := taskStore.GetTaskEvents(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, []*model.Event{created, dispatched}, events)
+		})
+
+		It("should only keep the most recent events", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			for i := 0; i < 1005; i++ {
+				failOnError(taskStore.RecordTaskEvent(&givenID, &model.Event{Type: model.EventProgress, Message: fmt.Sprintf("%d", i)}))
+			}
+
+			// Act
+			events, err := taskStore.GetTaskEvents(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Len(context, events, 1000)
+			assert.Equal(context, "5", events[0].Message)
+			assert.Equal(context, "1004", events[999].Message)
+		})
+
+		It("should return no events for a task without history", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			events, err := taskStore.GetTaskEvents(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Empty(context, events)
+		})
+
+		It("should return error if recording an event fails", func() {
+			// Arrange
+			directRedis.Close()
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			err := taskStore.RecordTaskEvent(&givenID, &model.Event{Type: model.EventCreated})
+
+			// Assert
+			assert.NotNil(context, err)
+			assert.Contains(context, err.Error(), "failed to record event")
+		})
+	})
+
+	Describe("get task queue size", func() {
+		BeforeEach(func() {
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		})
+
+		It("should return the queue size", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			_, err := taskStore.PushTask(&givenID)
+			assert.Nil(context, err)
+
+			// Act
+			size, err := taskStore.TaskQueueSize()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should return error if getting queue size fails", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			_, err := taskStore.TaskQueueSize()
+
+			// Assert
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("get task queue size for a priority", func() {
+		It("should only count tasks with the given priority", func() {
+			// Arrange
+			uuidGenMock.ExpectedCalls = nil
+			for _, priority := range []int{model.MaxPriority, 1, 1, 0, model.MinPriority} {
+				givenID := uuid.Must(uuid.NewV4())
+				uuidGenMock.On("GenV4").Return(givenID, nil).Once()
+				givenTaskSpec.Priority = priority
+				_, err := storeTask(taskStore, givenTaskSpec)
+				failOnError(err)
+			}
+
+			// Act
+			highest, err := taskStore.TaskQueueSizeForPriority(model.MaxPriority)
+			failOnError(err)
+			one, err := taskStore.TaskQueueSizeForPriority(1)
+			failOnError(err)
+			lowest, err := taskStore.TaskQueueSizeForPriority(model.MinPriority)
+			failOnError(err)
+			none, err := taskStore.TaskQueueSizeForPriority(2)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), highest)
+			assert.Equal(context, int64(2), one)
+			assert.Equal(context, int64(1), lowest)
+			assert.Equal(context, int64(0), none)
+		})
+
+		It("should return error if counting fails", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			_, err := taskStore.TaskQueueSizeForPriority(0)
 
 			// Assert
 			assert.NotNil(context, err)
-			assert.Contains(context, err.Error(), "failed to retrieve next task to execute :")
 		})
 	})
 
-	Describe("adding a task to executing set", func() {
-
+	Describe("get executing set size", func() {
 		BeforeEach(func() {
 			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
 		})
 
-		It("should return error if adding fails", func() {
+		It("should return the set size", func() {
 			// Arrange
-			directRedis.Close()
-			givenId := uuid.Must(uuid.NewV4())
+			givenID := uuid.Must(uuid.NewV4())
+			err := taskStore.AddTaskToExecutingSet(&givenID, time.Time{})
+			assert.Nil(context, err)
 
 			// Act
+			size, err := taskStore.ExecutingSetSize()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+		})
+
+		It("should return error if getting queue size fails", func() {
+			// Arrange
+			directRedis.Close()
 
-			err := taskStore.AddTaskToExecutingSet(&givenId)
+			// Act
+			_, err := taskStore.ExecutingSetSize()
 
 			// Assert
 			assert.NotNil(context, err)
-			assert.Contains(context, err.Error(), "failed to add task to executing set")
 		})
 	})
 
-	Describe("storing a task", func() {
-		It("should return task id", func() {
-			// Arrange
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+	Describe("task dependencies", func() {
+		var childID uuid.UUID
+		var succeededID uuid.UUID
+		var runningID uuid.UUID
 
+		BeforeEach(func() {
+			childID = uuid.Must(uuid.NewV4())
+			succeededID = uuid.Must(uuid.NewV4())
+			runningID = uuid.Must(uuid.NewV4())
+			directRedis.Set("task:"+succeededID.String()+":state", string(model.StateSucceeded))
+			directRedis.Set("task:"+runningID.String()+":state", string(model.StateRunning))
+		})
+
+		createChild := func(parents ...uuid.UUID) {
+			_, err := taskStore.CreateTasks([]model.Spec{{ID: &childID, Image: "alpine", DependsOn: parents}}, 10, time.Now())
+			failOnError(err)
+		}
+
+		It("should leave the parents that have not succeeded pending", func() {
 			// Act
-			id, err := taskStore.StoreTask(givenTaskSpec)
+			createChild(succeededID, runningID)
+			pending, err := taskStore.GetPendingDependencies(&childID)
 
 			// Assert
 			assert.Nil(context, err)
-			assert.NotNil(context, id)
-			assert.NotEqual(context, id, uuid.Nil)
+			assert.Equal(context, []*uuid.UUID{&runningID}, pending)
+		})
+
+		It("should record the task as a child of each parent", func() {
+			// Act
+			createChild(succeededID, runningID)
+			succeededChildren, err := taskStore.GetTaskChildren(&succeededID)
+			failOnError(err)
+			runningChildren, err := taskStore.GetTaskChildren(&runningID)
+			failOnError(err)
+
+			// Assert
+			assert.Equal(context, []*uuid.UUID{&childID}, succeededChildren)
+			assert.Equal(context, []*uuid.UUID{&childID}, runningChildren)
 		})
 
-		It("should return error if task with id already exists", func() {
+		It("should count the parents still pending once one is resolved", func() {
 			// Arrange
-			givenID := uuid.Must(uuid.NewV4())
-			uuidGenMock.On("GenV4").Return(givenID, nil)
+			otherID := uuid.Must(uuid.NewV4())
+			createChild(runningID, otherID)
+
+			// Act
+			first, err := taskStore.ResolveTaskDependency(&childID, &runningID)
+			failOnError(err)
+			second, err := taskStore.ResolveTaskDependency(&childID, &otherID)
 
-			_, err := taskStore.StoreTask(givenTaskSpec)
+			// Assert
 			assert.Nil(context, err)
+			assert.Equal(context, int64(1), first)
+			assert.Equal(context, int64(0), second)
+		})
+	})
 
+	Describe("idempotency keys", func() {
+		It("should reserve a key that has not been used", func() {
 			// Act
-			_, err = taskStore.StoreTask(givenTaskSpec)
+			reserved, original, err := taskStore.ReserveIdempotencyKey("create-1")
 
 			// Assert
-			assert.NotNil(context, err)
-			assert.Equal(context, fmt.Sprintf("task with id %s already exists", &givenID), err.Error())
+			assert.Nil(context, err)
+			assert.True(context, reserved)
+			assert.Nil(context, original)
 		})
 
-		It("should return error if storing task fails", func() {
+		It("should not reserve a key that is still being handled", func() {
 			// Arrange
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
-			directRedis.Close()
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
+			failOnError(err)
 
 			// Act
-			_, err := taskStore.StoreTask(givenTaskSpec)
+			reserved, original, err := taskStore.ReserveIdempotencyKey("create-1")
 
 			// Assert
-			assert.NotNil(context, err)
-			assert.Contains(context, err.Error(), "storing task with id")
+			assert.Nil(context, err)
+			assert.False(context, reserved)
+			assert.Nil(context, original)
 		})
-	})
 
-	Describe("retrieving  a task", func() {
+		It("should return the task bound to a key that has been used", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
+			failOnError(err)
+			failOnError(taskStore.BindIdempotencyKey("create-1", &givenID, time.Hour))
 
-		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			// Act
+			reserved, original, err := taskStore.ReserveIdempotencyKey("create-1")
+
+			// Assert
+			assert.Nil(context, err)
+			assert.False(context, reserved)
+			assert.Equal(context, givenID, *original)
 		})
 
-		It("should return the task related to the given id", func() {
+		It("should forget a key once its window has passed", func() {
 			// Arrange
-			id, err := taskStore.StoreTask(givenTaskSpec)
+			givenID := uuid.Must(uuid.NewV4())
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
 			failOnError(err)
+			failOnError(taskStore.BindIdempotencyKey("create-1", &givenID, time.Hour))
+			directRedis.FastForward(2 * time.Hour)
 
 			// Act
-			task, err := taskStore.GetTask(id)
+			reserved, _, err := taskStore.ReserveIdempotencyKey("create-1")
 
 			// Assert
 			assert.Nil(context, err)
-			assert.Equal(context, id, task.ID)
-			assert.Equal(context, givenTaskSpec.Init, task.Init)
-			assert.Equal(context, givenTaskSpec.InitArgs, task.InitArgs)
-			assert.Equal(context, givenTaskSpec.Image, task.Image)
+			assert.True(context, reserved)
 		})
 
-		It("should return an error if task with given id does not exist", func() {
+		It("should reserve a key again once a request that never finished has held it for long enough", func() {
 			// Arrange
-			givenID := uuid.Must(uuid.NewV4())
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
+			failOnError(err)
+			directRedis.FastForward(2 * time.Minute)
 
 			// Act
-			_, err := taskStore.GetTask(&givenID)
+			reserved, _, err := taskStore.ReserveIdempotencyKey("create-1")
 
 			// Assert
-			assert.NotNil(context, err)
-			assert.Equal(context, fmt.Sprintf("failed to retrieve task with id %s", givenID.String()), err.Error())
+			assert.Nil(context, err)
+			assert.True(context, reserved)
 		})
 
-		It("should return an error if retrieved task fails to be re-constructed", func() {
+		It("should reserve a key again once it is released", func() {
 			// Arrange
-			badData := "test"
-			id, err := taskStore.StoreTask(givenTaskSpec)
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
 			failOnError(err)
-			taskID := directRedis.Keys()[0]
-			directRedis.Set(taskID, badData)
+			failOnError(taskStore.ReleaseIdempotencyKey("create-1"))
 
 			// Act
-			_, err = taskStore.GetTask(id)
+			reserved, _, err := taskStore.ReserveIdempotencyKey("create-1")
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, reserved)
+		})
+
+		It("should return error if reserving fails", func() {
+			// Arrange
+			directRedis.Close()
+
+			// Act
+			_, _, err := taskStore.ReserveIdempotencyKey("create-1")
 
 			// Assert
 			assert.NotNil(context, err)
-			assert.Equal(context,
-				fmt.Sprintf("failed to build task with id %s from retrieved data %s", id.String(), badData),
-				err.Error())
 		})
 	})
 
-	Describe("publishing and listening for a task created event", func() {
+	Describe("dedupe", func() {
+		var givenID uuid.UUID
+		var otherID uuid.UUID
 
 		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			givenID = uuid.Must(uuid.NewV4())
+			otherID = uuid.Must(uuid.NewV4())
+			directRedis.Set("task:"+givenID.String()+":state", string(model.StateQueued))
+			directRedis.Set("task:"+otherID.String()+":state", string(model.StateQueued))
 		})
 
-		It("should receive published task", func() {
+		It("should record the callers merged into a task", func() {
 			// Arrange
-			id := uuid.Must(uuid.NewV4())
-			timeout := time.After(time.Second)
+			caller := &model.MergedCaller{At: time.Now().UTC().Round(time.Second), Source: "10.0.0.1:5000"}
 
 			// Act
-			go func() {
-				taskStore.PublishTaskCreatedEvent(&id)
-			}()
+			err := taskStore.RecordMergedCaller(&givenID, caller)
+			failOnError(err)
+			callers, err := taskStore.GetMergedCallers(&givenID)
 
 			// Assert
-			select {
-			case actualId := <-taskStore.ListenForTaskCreatedEvents():
-				assert.Equal(context, actualId, &id)
-			case <-timeout:
-				assert.Fail(context, "Timed out waiting for channel to close, or error to be received")
-			}
+			assert.Nil(context, err)
+			assert.Equal(context, []*model.MergedCaller{caller}, callers)
 		})
 	})
 
-	Describe("remove task from executing set", func() {
+	Describe("resources", func() {
+		var givenID uuid.UUID
+		var otherID uuid.UUID
+		var capacity model.Resources
 
 		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			givenID = uuid.Must(uuid.NewV4())
+			otherID = uuid.Must(uuid.NewV4())
+			capacity = model.Resources{model.ResourceCPU: 4000, "licenses": 1}
 		})
 
-		It("should return error if remove fails", func() {
+		It("should reserve resources that fit in what is left of the pool", func() {
+			// Act
+			reserved, err := taskStore.ReserveResources(&givenID, model.Resources{model.ResourceCPU: 3000}, capacity)
+			failOnError(err)
+			usage, err := taskStore.GetResourceUsage()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, reserved)
+			assert.Equal(context, model.Resources{model.ResourceCPU: 3000}, usage)
+		})
+
+		It("should reserve nothing if any resource does not fit", func() {
 			// Arrange
-			directRedis.Close()
-			givenID := uuid.Must(uuid.NewV4())
+			_, err := taskStore.ReserveResources(&givenID, model.Resources{"licenses": 1}, capacity)
+			failOnError(err)
 
 			// Act
-			err := taskStore.RemoveTaskFromExecutingSet(&givenID)
+			reserved, err := taskStore.ReserveResources(&otherID,
+				model.Resources{model.ResourceCPU: 1000, "licenses": 1}, capacity)
+			failOnError(err)
+			usage, err := taskStore.GetResourceUsage()
 
 			// Assert
-			assert.NotNil(context, err)
-			assert.Contains(context, err.Error(), "failed to remove task")
+			assert.Nil(context, err)
+			assert.False(context, reserved)
+			assert.Equal(context, int64(0), usage[model.ResourceCPU])
+			assert.Equal(context, int64(1), usage["licenses"])
 		})
-	})
 
-	Describe("is task executing", func() {
-		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		It("should not reserve twice for the same task", func() {
+			// Arrange
+			_, err := taskStore.ReserveResources(&givenID, model.Resources{model.ResourceCPU: 3000}, capacity)
+			failOnError(err)
+
+			// Act
+			reserved, err := taskStore.ReserveResources(&givenID, model.Resources{model.ResourceCPU: 3000}, capacity)
+			failOnError(err)
+			usage, err := taskStore.GetResourceUsage()
+
+			// Assert
+			assert.Nil(context, err)
+			assert.True(context, reserved)
+			assert.Equal(context, int64(3000), usage[model.ResourceCPU])
 		})
 
-		It("should be true if task is executing", func() {
+		It("should return resources to the pool when the task leaves the executing set", func() {
 			// Arrange
-			id, err := taskStore.StoreTask(givenTaskSpec)
-			assert.Nil(context, err)
-			taskStore.AddTaskToExecutingSet(id)
+			_, err := taskStore.ReserveResources(&givenID, model.Resources{model.ResourceCPU: 4000}, capacity)
+			failOnError(err)
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Time{}))
 
 			// Act
-			executing, err := taskStore.IsTaskExecuting(id)
+			err = taskStore.RemoveTaskFromExecutingSet(&givenID)
+			failOnError(err)
+			reserved, err := taskStore.ReserveResources(&otherID, model.Resources{model.ResourceCPU: 4000}, capacity)
 
 			// Assert
 			assert.Nil(context, err)
-			assert.True(context, executing)
+			assert.True(context, reserved)
 		})
 
-		It("should return false if task is not executing", func() {
+		It("should release only once", func() {
 			// Arrange
-			givenID := uuid.Must(uuid.NewV4())
+			_, err := taskStore.ReserveResources(&givenID, model.Resources{model.ResourceCPU: 1000}, capacity)
+			failOnError(err)
+			_, err = taskStore.ReserveResources(&otherID, model.Resources{model.ResourceCPU: 1000}, capacity)
+			failOnError(err)
 
 			// Act
-			executing, err := taskStore.IsTaskExecuting(&givenID)
+			failOnError(taskStore.ReleaseResources(&givenID))
+			failOnError(taskStore.ReleaseResources(&givenID))
+			usage, err := taskStore.GetResourceUsage()
 
 			// Assert
 			assert.Nil(context, err)
-			assert.False(context, executing)
+			assert.Equal(context, int64(1000), usage[model.ResourceCPU])
 		})
 
-		It("should return error if check for executing fails", func() {
+		It("should return error if reserving fails", func() {
 			// Arrange
 			directRedis.Close()
-			givenID := uuid.Must(uuid.NewV4())
 
 			// Act
-			_, err := taskStore.IsTaskExecuting(&givenID)
+			_, err := taskStore.ReserveResources(&givenID, model.Resources{model.ResourceCPU: 1000}, capacity)
 
 			// Assert
 			assert.NotNil(context, err)
 		})
 	})
 
-	Describe("update task info", func() {
+	Describe("leases", func() {
+		var givenID uuid.UUID
+
 		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			givenID = uuid.Must(uuid.NewV4())
 		})
 
-		It("should return error if updating info fails", func() {
+		It("should not count a task whose lease has expired as executing", func() {
 			// Arrange
-			directRedis.Close()
-			id := uuid.Must(uuid.NewV4())
-			info := &model.Info{
-				ID: &id,
-			}
+			otherID := uuid.Must(uuid.NewV4())
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Now().Add(-time.Second)))
+			failOnError(taskStore.AddTaskToExecutingSet(&otherID, time.Now().Add(time.Minute)))
 
 			// Act
-			err := taskStore.UpdateTaskInfo(info)
+			size, err := taskStore.ExecutingSetSize()
+			failOnError(err)
+			executing, err := taskStore.IsTaskExecuting(&givenID)
 
 			// Assert
-			assert.NotNil(context, err)
+			assert.Nil(context, err)
+			assert.Equal(context, int64(1), size)
+			assert.False(context, executing)
 		})
-	})
 
-	Describe("get task queue size", func() {
-		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+		It("should extend a live lease and record the worker renewing it", func() {
+			// Arrange
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Now().Add(time.Second)))
+			until := time.Now().Add(time.Minute).UTC().Round(time.Millisecond)
+
+			// Act
+			lease, err := taskStore.RenewLease(&givenID, "worker-1", until)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Equal(context, "worker-1", lease.Worker)
+			assert.Equal(context, until, *lease.ExpiresAt)
 		})
 
-		It("should return the queue size", func() {
+		It("should not renew a lease held by another worker", func() {
 			// Arrange
-			givenID := uuid.Must(uuid.NewV4())
-			_, err := taskStore.PushTask(&givenID)
-			assert.Nil(context, err)
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Time{}))
+			_, err := taskStore.RenewLease(&givenID, "worker-1", time.Time{})
+			failOnError(err)
 
 			// Act
-			size, err := taskStore.TaskQueueSize()
+			_, err = taskStore.RenewLease(&givenID, "worker-2", time.Time{})
+
+			// Assert
+			assert.IsType(context, &task.LeaseHeldError{}, err)
+		})
+
+		It("should not renew a lease that has expired", func() {
+			// Arrange
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Now().Add(-time.Second)))
+
+			// Act
+			_, err := taskStore.RenewLease(&givenID, "worker-1", time.Now().Add(time.Minute))
+
+			// Assert
+			assert.IsType(context, &task.LeaseLostError{}, err)
+		})
+
+		It("should keep a lease that never expires until the task leaves the executing set", func() {
+			// Arrange
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Time{}))
+
+			// Act
+			expired, err := taskStore.PopExpiredLeases(time.Now().Add(24 * time.Hour))
+			failOnError(err)
+			lease, err := taskStore.GetLease(&givenID)
+			failOnError(err)
+			failOnError(taskStore.RemoveTaskFromExecutingSet(&givenID))
+			released, err := taskStore.GetLease(&givenID)
 
 			// Assert
 			assert.Nil(context, err)
-			assert.Equal(context, int64(1), size)
+			assert.Empty(context, expired)
+			assert.Nil(context, lease.ExpiresAt)
+			assert.Nil(context, released)
 		})
 
-		It("should return error if getting queue size fails", func() {
+		It("should pop the tasks whose lease has expired", func() {
 			// Arrange
-			directRedis.Close()
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Now().Add(time.Second)))
 
 			// Act
-			_, err := taskStore.TaskQueueSize()
+			expired, err := taskStore.PopExpiredLeases(time.Now().Add(time.Minute))
+			failOnError(err)
+			size, err := taskStore.ExecutingSetSize()
 
 			// Assert
-			assert.NotNil(context, err)
+			assert.Nil(context, err)
+			assert.Equal(context, []*uuid.UUID{&givenID}, expired)
+			assert.Equal(context, int64(0), size)
 		})
 	})
 
-	Describe("get executing set size", func() {
+	Describe("task progress", func() {
+		var givenID uuid.UUID
+
 		BeforeEach(func() {
-			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			givenID = uuid.Must(uuid.NewV4())
 		})
 
-		It("should return the set size", func() {
+		It("should keep what earlier updates reported unless a later one replaces it", func() {
 			// Arrange
-			givenID := uuid.Must(uuid.NewV4())
-			err := taskStore.AddTaskToExecutingSet(&givenID)
+			startedAt := time.Now().UTC().Round(time.Millisecond)
+			percent := 25.0
+			failOnError(taskStore.UpdateTaskProgress(&model.Info{ID: &givenID, Status: model.InfoStarted, Phase: "fetching"}, startedAt))
+
+			// Act
+			err := taskStore.UpdateTaskProgress(&model.Info{ID: &givenID, Status: model.InfoProgress, Percent: &percent},
+				startedAt.Add(time.Second))
+			failOnError(err)
+			progress, err := taskStore.GetTaskProgress(&givenID)
+
+			// Assert
 			assert.Nil(context, err)
+			assert.Equal(context, &model.Progress{
+				StartedAt: &startedAt,
+				Percent:   &percent,
+				Phase:     "fetching",
+				UpdatedAt: startedAt.Add(time.Second),
+			}, progress)
+		})
+
+		It("should forget the progress of an earlier attempt once the task is executing again", func() {
+			// Arrange
+			failOnError(taskStore.UpdateTaskProgress(&model.Info{ID: &givenID, Status: model.InfoStarted}, time.Now()))
 
 			// Act
-			size, err := taskStore.ExecutingSetSize()
+			failOnError(taskStore.AddTaskToExecutingSet(&givenID, time.Time{}))
+			progress, err := taskStore.GetTaskProgress(&givenID)
 
 			// Assert
 			assert.Nil(context, err)
-			assert.Equal(context, int64(1), size)
+			assert.Nil(context, progress)
 		})
+	})
 
-		It("should return error if getting queue size fails", func() {
+	Describe("return task", func() {
+		It("should put the task back ahead of the queued tasks of its priority", func() {
 			// Arrange
-			directRedis.Close()
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil).Once()
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil).Once()
+			first, err := storeTask(taskStore, model.Spec{Priority: 0})
+			failOnError(err)
+			_, err = storeTask(taskStore, model.Spec{Priority: 0})
+			failOnError(err)
+			popped, err := taskStore.PopTask()
+			failOnError(err)
 
 			// Act
-			_, err := taskStore.ExecutingSetSize()
+			err = taskStore.ReturnTask(popped)
+			failOnError(err)
+			next, err := taskStore.PopTask()
 
 			// Assert
-			assert.NotNil(context, err)
+			assert.Nil(context, err)
+			assert.Equal(context, *first, *next)
 		})
 	})
 })
@@ -405,3 +1820,12 @@ func failOnError(err error) {
 		log.Fatal(err.Error())
 	}
 }
+
+// storeTask : create the given task in the given store, returning its id
+func storeTask(store task.Store, taskSpec model.Spec) (*uuid.UUID, error) {
+	created, err := store.CreateTask(taskSpec, 100, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return created.ID, nil
+}
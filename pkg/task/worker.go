@@ -0,0 +1,191 @@
+package task
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+	"sort"
+	"time"
+)
+
+const workersSetName = "workers"
+const workerPrefix = "worker"
+const workerTasksPostFix = "tasks"
+const taskWorkersName = "workers:tasks"
+
+// heartbeatScript : atomically records a heartbeat from a registered worker, replacing the tasks
+// it holds with the ones it reports. ARGV holds the worker's id, the heartbeat's score and the ids
+// of the tasks. Returns 0 if the worker is not registered, as it has never been or it lapsed
+var heartbeatScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+for _, held in ipairs(redis.call('SMEMBERS', KEYS[2])) do
+	if redis.call('HGET', KEYS[3], held) == ARGV[1] then
+		redis.call('HDEL', KEYS[3], held)
+	end
+end
+redis.call('DEL', KEYS[2])
+for i = 3, #ARGV do
+	redis.call('SADD', KEYS[2], ARGV[i])
+	redis.call('HSET', KEYS[3], ARGV[i], ARGV[1])
+end
+return 1
+`)
+
+// removeLapsedWorkerScript : atomically forgets a worker whose last heartbeat is scored at or below
+// ARGV[2], returning the tasks it held that no other worker has reported holding since.
+// Returns nil if the worker has sent a heartbeat since
+var removeLapsedWorkerScript = redis.NewScript(`
+local last = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not last or tonumber(last) > tonumber(ARGV[2]) then
+	return nil
+end
+local held = {}
+for _, id in ipairs(redis.call('SMEMBERS', KEYS[3])) do
+	if redis.call('HGET', KEYS[4], id) == ARGV[1] then
+		redis.call('HDEL', KEYS[4], id)
+		table.insert(held, id)
+	end
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('DEL', KEYS[2], KEYS[3])
+return held
+`)
+
+// RegisterWorker : announce the given worker, it is expected to send heartbeats from now on.
+// Registering again keeps the tasks the worker holds until its next heartbeat
+func (s *StoreImpl) RegisterWorker(worker *model.Worker, now time.Time) error {
+	worker.RegisteredAt = now.UTC()
+	worker.LastHeartbeat = now.UTC()
+	data, err := worker.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(buildWorkerKey(worker.ID), data, 0)
+		pipe.ZAdd(workersSetName, redis.Z{Score: float64(toMillis(now)), Member: worker.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register worker %s : %s", worker.ID, err.Error())
+	}
+	return nil
+}
+
+// RecordHeartbeat : record that the given worker is alive and holds the given tasks,
+// returning false if the worker is not registered
+func (s *StoreImpl) RecordHeartbeat(workerID string, tasks []*uuid.UUID, now time.Time) (bool, error) {
+	args := []interface{}{workerID, toMillis(now)}
+	for _, id := range tasks {
+		args = append(args, id.String())
+	}
+
+	keys := []string{workersSetName, buildWorkerTasksKey(workerID), taskWorkersName}
+	recorded, err := heartbeatScript.Run(s.redis, keys, args...).Int64()
+	if err != nil {
+		return false, fmt.Errorf("failed to record heartbeat of worker %s : %s", workerID, err.Error())
+	}
+	return recorded == 1, nil
+}
+
+// ListWorkers : the registered workers ordered by id, along with the tasks each holds
+func (s *StoreImpl) ListWorkers() ([]*model.Worker, error) {
+	registered, err := s.redis.ZRangeWithScores(workersSetName, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve workers : %s", err.Error())
+	}
+
+	workers := make([]*model.Worker, 0, len(registered))
+	for _, member := range registered {
+		workerID := member.Member.(string)
+		worker, err := s.getWorker(workerID)
+		if err != nil {
+			return nil, err
+		}
+		worker.LastHeartbeat = fromMillis(int64(member.Score)).UTC()
+		workers = append(workers, worker)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers, nil
+}
+
+func (s *StoreImpl) getWorker(workerID string) (*model.Worker, error) {
+	worker := &model.Worker{ID: workerID}
+	data, err := s.redis.Get(buildWorkerKey(workerID)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to retrieve worker %s : %s", workerID, err.Error())
+	}
+	if err == nil {
+		if err := worker.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, fmt.Errorf("failed to build worker %s from retrieved data %s", workerID, data)
+		}
+	}
+
+	worker.Tasks, err = s.members(buildWorkerTasksKey(workerID))
+	if err != nil {
+		return nil, err
+	}
+	return worker, nil
+}
+
+// GetTaskWorker : the id of the worker that last reported holding the given task, empty if none has
+func (s *StoreImpl) GetTaskWorker(id *uuid.UUID) (string, error) {
+	workerID, err := s.redis.HGet(taskWorkersName, id.String()).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve worker of task %s : %s", id.String(), err.Error())
+	}
+	return workerID, nil
+}
+
+// PopLapsedWorkers : forget and return the workers that have not sent a heartbeat since the given time,
+// along with the tasks each held
+func (s *StoreImpl) PopLapsedWorkers(since time.Time) ([]*model.Worker, error) {
+	cutoff := toMillis(since)
+	lapsed, err := s.redis.ZRangeByScoreWithScores(workersSetName, redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", cutoff),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve lapsed workers : %s", err.Error())
+	}
+
+	workers := make([]*model.Worker, 0, len(lapsed))
+	for _, member := range lapsed {
+		workerID := member.Member.(string)
+		keys := []string{workersSetName, buildWorkerKey(workerID), buildWorkerTasksKey(workerID), taskWorkersName}
+		result, err := removeLapsedWorkerScript.Run(s.redis, keys, workerID, cutoff).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove lapsed worker %s : %s", workerID, err.Error())
+		}
+
+		members, _ := result.([]interface{})
+		held := make([]string, 0, len(members))
+		for _, id := range members {
+			held = append(held, id.(string))
+		}
+		workers = append(workers, &model.Worker{
+			ID:            workerID,
+			LastHeartbeat: fromMillis(int64(member.Score)).UTC(),
+			Tasks:         parseTaskIDs(held, buildWorkerTasksKey(workerID)),
+		})
+	}
+	return workers, nil
+}
+
+func buildWorkerKey(workerID string) string {
+	return fmt.Sprintf("%s:%s", workerPrefix, workerID)
+}
+
+func buildWorkerTasksKey(workerID string) string {
+	return fmt.Sprintf("%s:%s:%s", workerPrefix, workerID, workerTasksPostFix)
+}
@@ -0,0 +1,124 @@
+package task_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/task"
+	"github.com/execd/task-store/pkg/util"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"time"
+)
+
+var _ = Describe("worker registry", func() {
+	var taskStore *task.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var now time.Time
+	var taskID uuid.UUID
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+		directRedis = s
+		taskStore = task.NewStoreImpl(redis.NewClient(s.Addr()), util.NewUUIDGenImpl())
+		now = time.Now().UTC().Round(time.Millisecond)
+		taskID = uuid.Must(uuid.NewV4())
+	})
+
+	AfterEach(func() {
+		directRedis.Close()
+	})
+
+	It("should list registered workers with the tasks they hold", func() {
+		// Arrange
+		failOnError(taskStore.RegisterWorker(&model.Worker{ID: "worker-b"}, now))
+		failOnError(taskStore.RegisterWorker(&model.Worker{ID: "worker-a", Hostname: "host-a"}, now))
+		_, err := taskStore.RecordHeartbeat("worker-a", []*uuid.UUID{&taskID}, now.Add(time.Second))
+		failOnError(err)
+
+		// Act
+		workers, err := taskStore.ListWorkers()
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Len(context, workers, 2)
+		assert.Equal(context, "worker-a", workers[0].ID)
+		assert.Equal(context, "host-a", workers[0].Hostname)
+		assert.Equal(context, now, workers[0].RegisteredAt)
+		assert.Equal(context, now.Add(time.Second), workers[0].LastHeartbeat)
+		assert.Equal(context, []*uuid.UUID{&taskID}, workers[0].Tasks)
+		assert.Empty(context, workers[1].Tasks)
+	})
+
+	It("should not record a heartbeat from a worker that is not registered", func() {
+		// Act
+		recorded, err := taskStore.RecordHeartbeat("worker-a", []*uuid.UUID{&taskID}, now)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.False(context, recorded)
+		holder, _ := taskStore.GetTaskWorker(&taskID)
+		assert.Equal(context, "", holder)
+	})
+
+	It("should replace the tasks a worker holds with the ones it last reported", func() {
+		// Arrange
+		otherID := uuid.Must(uuid.NewV4())
+		failOnError(taskStore.RegisterWorker(&model.Worker{ID: "worker-a"}, now))
+		_, err := taskStore.RecordHeartbeat("worker-a", []*uuid.UUID{&taskID}, now)
+		failOnError(err)
+
+		// Act
+		_, err = taskStore.RecordHeartbeat("worker-a", []*uuid.UUID{&otherID}, now)
+		failOnError(err)
+		holder, err := taskStore.GetTaskWorker(&taskID)
+		failOnError(err)
+		otherHolder, err := taskStore.GetTaskWorker(&otherID)
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Equal(context, "", holder)
+		assert.Equal(context, "worker-a", otherHolder)
+	})
+
+	It("should forget lapsed workers and return the tasks only they hold", func() {
+		// Arrange
+		otherID := uuid.Must(uuid.NewV4())
+		failOnError(taskStore.RegisterWorker(&model.Worker{ID: "worker-a"}, now))
+		failOnError(taskStore.RegisterWorker(&model.Worker{ID: "worker-b"}, now))
+		_, err := taskStore.RecordHeartbeat("worker-a", []*uuid.UUID{&taskID, &otherID}, now)
+		failOnError(err)
+		_, err = taskStore.RecordHeartbeat("worker-b", []*uuid.UUID{&otherID}, now.Add(time.Minute))
+		failOnError(err)
+
+		// Act
+		lapsed, err := taskStore.PopLapsedWorkers(now.Add(time.Second))
+		failOnError(err)
+		workers, err := taskStore.ListWorkers()
+
+		// Assert
+		assert.Nil(context, err)
+		assert.Len(context, lapsed, 1)
+		assert.Equal(context, "worker-a", lapsed[0].ID)
+		assert.Equal(context, []*uuid.UUID{&taskID}, lapsed[0].Tasks)
+		assert.Len(context, workers, 1)
+		assert.Equal(context, "worker-b", workers[0].ID)
+		recorded, _ := taskStore.RecordHeartbeat("worker-a", nil, now.Add(time.Minute))
+		assert.False(context, recorded)
+	})
+
+	It("should return error if listing workers fails", func() {
+		// Arrange
+		directRedis.Close()
+
+		// Act
+		_, err := taskStore.ListWorkers()
+
+		// Assert
+		assert.NotNil(context, err)
+	})
+})
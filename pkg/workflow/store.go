@@ -0,0 +1,89 @@
+package workflow
+
+import (
+	"fmt"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/util"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+)
+
+const workflowPrefix = "workflow"
+
+// Store : a Store allows saving and reading workflows
+type Store interface {
+	StoreWorkflow(workflow model.Workflow) (*uuid.UUID, error)
+	GetWorkflow(id *uuid.UUID) (*model.Workflow, error)
+	UpdateWorkflow(workflow *model.Workflow) error
+	DeleteWorkflow(id *uuid.UUID) error
+}
+
+// NewStoreImpl : build a StoreImpl
+func NewStoreImpl(redis *redis.Client, uuidGen util.UUIDGen) *StoreImpl {
+	return &StoreImpl{redis: redis, uuidGen: uuidGen}
+}
+
+// StoreImpl : redis implementation of a Store.
+type StoreImpl struct {
+	redis   *redis.Client
+	uuidGen util.UUIDGen
+}
+
+// StoreWorkflow : store the given workflow, a workflow given an id keeps it
+func (s *StoreImpl) StoreWorkflow(workflow model.Workflow) (*uuid.UUID, error) {
+	if workflow.ID == nil {
+		id, err := s.uuidGen.GenV4()
+		if err != nil {
+			return nil, err
+		}
+		workflow.ID = &id
+	}
+	id := workflow.ID
+	created, err := s.redis.SetNX(buildWorkflowKey(id), &workflow, 0).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storing workflow with id %s failed", id.String())
+	}
+	if !created {
+		return nil, fmt.Errorf("workflow with id %s already exists", id.String())
+	}
+	return workflow.ID, nil
+}
+
+// GetWorkflow : retrieve the workflow with the given id, nil if there is no such workflow
+func (s *StoreImpl) GetWorkflow(id *uuid.UUID) (*model.Workflow, error) {
+	data, err := s.redis.Get(buildWorkflowKey(id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve workflow with id %s", id.String())
+	}
+
+	workflow := new(model.Workflow)
+	if err := workflow.UnmarshalBinary([]byte(data)); err != nil {
+		return nil, fmt.Errorf("failed to build workflow with id %s from retrieved data %s", id.String(), data)
+	}
+	return workflow, nil
+}
+
+// UpdateWorkflow : save the given workflow, along with the tasks created for its steps
+func (s *StoreImpl) UpdateWorkflow(workflow *model.Workflow) error {
+	_, err := s.redis.Set(buildWorkflowKey(workflow.ID), workflow, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to update workflow with id %s : %s", workflow.ID.String(), err.Error())
+	}
+	return nil
+}
+
+// DeleteWorkflow : remove the workflow with the given id
+func (s *StoreImpl) DeleteWorkflow(id *uuid.UUID) error {
+	_, err := s.redis.Del(buildWorkflowKey(id)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete workflow with id %s : %s", id.String(), err.Error())
+	}
+	return nil
+}
+
+func buildWorkflowKey(id *uuid.UUID) string {
+	return fmt.Sprintf("%s:%s", workflowPrefix, id.String())
+}
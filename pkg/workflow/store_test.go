@@ -0,0 +1,134 @@
+package workflow_test
+
+import (
+	"github.com/alicebob/miniredis"
+	"github.com/execd/task-store/mocks"
+	"github.com/execd/task-store/pkg/model"
+	"github.com/execd/task-store/pkg/redis"
+	"github.com/execd/task-store/pkg/workflow"
+	. "github.com/onsi/ginkgo"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"log"
+)
+
+var context = GinkgoT()
+
+var _ = Describe("store", func() {
+	var workflowStore *workflow.StoreImpl
+	var directRedis *miniredis.Miniredis
+	var givenWorkflow model.Workflow
+	var uuidGenMock mocks.UUIDGen
+
+	BeforeEach(func() {
+		s, err := miniredis.Run()
+		if err != nil {
+			panic(err)
+		}
+
+		redis := redis.NewClient(s.Addr())
+		uuidGenMock = mocks.UUIDGen{}
+		workflowStore = workflow.NewStoreImpl(redis, &uuidGenMock)
+		directRedis = s
+		givenWorkflow = model.Workflow{
+			Name:  "release",
+			Steps: []model.Step{{Name: "build", Spec: model.Spec{Image: "alpine"}}},
+		}
+	})
+
+	AfterEach(func() {
+		defer directRedis.Close()
+	})
+
+	Describe("storing a workflow", func() {
+		It("should store the workflow under a new id", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+			uuidGenMock.On("GenV4").Return(givenID, nil)
+
+			// Act
+			id, err := workflowStore.StoreWorkflow(givenWorkflow)
+			failOnError(err)
+			stored, err := workflowStore.GetWorkflow(id)
+			failOnError(err)
+
+			// Assert
+			assert.Equal(context, givenID, *id)
+			assert.Equal(context, givenID, *stored.ID)
+			assert.Equal(context, "release", stored.Name)
+			assert.Equal(context, "build", stored.Steps[0].Name)
+		})
+
+		It("should return an error if storing fails", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			directRedis.Close()
+
+			// Act
+			id, err := workflowStore.StoreWorkflow(givenWorkflow)
+
+			// Assert
+			assert.Nil(context, id)
+			assert.NotNil(context, err)
+		})
+	})
+
+	Describe("getting a workflow", func() {
+		It("should return nil if there is no such workflow", func() {
+			// Arrange
+			givenID := uuid.Must(uuid.NewV4())
+
+			// Act
+			stored, err := workflowStore.GetWorkflow(&givenID)
+
+			// Assert
+			assert.Nil(context, err)
+			assert.Nil(context, stored)
+		})
+	})
+
+	Describe("updating a workflow", func() {
+		It("should save the tasks created for its steps", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			id, err := workflowStore.StoreWorkflow(givenWorkflow)
+			failOnError(err)
+			givenTaskID := uuid.Must(uuid.NewV4())
+			givenWorkflow.ID = id
+			givenWorkflow.Tasks = map[string]*uuid.UUID{"build": &givenTaskID}
+
+			// Act
+			err = workflowStore.UpdateWorkflow(&givenWorkflow)
+			failOnError(err)
+			stored, err := workflowStore.GetWorkflow(id)
+			failOnError(err)
+
+			// Assert
+			assert.Equal(context, givenTaskID, *stored.Tasks["build"])
+		})
+	})
+
+	Describe("deleting a workflow", func() {
+		It("should remove the workflow", func() {
+			// Arrange
+			uuidGenMock.On("GenV4").Return(uuid.Must(uuid.NewV4()), nil)
+			id, err := workflowStore.StoreWorkflow(givenWorkflow)
+			failOnError(err)
+
+			// Act
+			err = workflowStore.DeleteWorkflow(id)
+
+			// Assert
+			assert.Nil(context, err)
+			stored, err := workflowStore.GetWorkflow(id)
+			assert.Nil(context, err)
+			assert.Nil(context, stored)
+		})
+	})
+})
+
+func failOnError(err error) {
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}